@@ -2,6 +2,10 @@ package cgroups
 
 import (
 	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
 )
 
 // cgroup根路径
@@ -42,12 +46,61 @@ func (c *CgroupManager) Remove() {
 	for _, subSysIns := range SubsystemIns {
 		err := subSysIns.Remove(c.Path)
 		if err != nil {
-			log.Fatalf("删除 cgroup 失败 %v", err)
-			return
+			log.Printf("删除 cgroup 失败 %v", err)
 		}
 	}
 }
 
+// OOMKilled cgroup 中是否有进程因为内存不足被杀死，需要在 Remove 之前调用
+func (c *CgroupManager) OOMKilled() bool {
+	return (&MemorySubSystem{}).OOMKilled(c.Path)
+}
+
+// Paths cgroup 在各个 subsystem 中的目录，key 是 subsystem 名称
+func (c *CgroupManager) Paths() map[string]string {
+	paths := map[string]string{}
+	for _, subSysIns := range SubsystemIns {
+		if root := FindCgroupMountPoint(subSysIns.Name()); root != "" {
+			paths[subSysIns.Name()] = path.Join(root, c.Path)
+		}
+	}
+	return paths
+}
+
+// Freeze 冻结 cgroup 中的所有进程
+func (c *CgroupManager) Freeze() error {
+	return (&FreezerSubSystem{}).Freeze(c.Path)
+}
+
+// Thaw 恢复 cgroup 中被冻结的进程
+func (c *CgroupManager) Thaw() error {
+	return (&FreezerSubSystem{}).Thaw(c.Path)
+}
+
+// Pids cgroup 中所有进程的 pid，所有的 subsystem 中进程相同，从 memory subsystem 中读取
+func (c *CgroupManager) Pids() ([]int, error) {
+	subsysCgroupPath, err := GetCgroupPath((&MemorySubSystem{}).Name(), c.Path, false)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path.Join(subsysCgroupPath, "cgroup.procs"))
+	if err != nil {
+		// 旧的内核没有 cgroup.procs，从 tasks 中读取
+		if content, err = os.ReadFile(path.Join(subsysCgroupPath, "tasks")); err != nil {
+			return nil, err
+		}
+	}
+	var pids []int
+	for _, line := range strings.Fields(string(content)) {
+		pid, err := strconv.Atoi(line)
+		if err != nil {
+			continue
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
 func ProcessCgroup(containerId string, pid int, res *ResourceConfig) {
 	// 创建cgroup manager
 	cgroupManager := NewCgroupManager(RooutCgroupPath + containerId)
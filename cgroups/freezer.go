@@ -0,0 +1,124 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FreezerSubSystem 冻结和恢复 cgroup 中的所有进程，用于 pause 和 unpause
+// 优先使用 cgroup v1 的 freezer subsystem，没有挂载时使用 cgroup v2 的 cgroup.freeze
+type FreezerSubSystem struct {
+}
+
+// 等待 cgroup 中的进程全部冻结的时间
+const freezeTimeout = 10 * time.Second
+
+func (f *FreezerSubSystem) Name() string {
+	return "freezer"
+}
+
+// Set freezer 没有资源限制，只创建 cgroup
+func (f *FreezerSubSystem) Set(cgroupPath string, res *ResourceConfig) error {
+	_, _, err := f.cgroupPath(cgroupPath, true)
+	return err
+}
+
+func (f *FreezerSubSystem) Apply(cgroupPath string, pid int) error {
+	subsysCgroupPath, v2, err := f.cgroupPath(cgroupPath, false)
+	if err != nil {
+		return fmt.Errorf("获取 cgroup %s 失败: %v", cgroupPath, err)
+	}
+	procs := "tasks"
+	if v2 {
+		procs = "cgroup.procs"
+	}
+	if err := os.WriteFile(path.Join(subsysCgroupPath, procs), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return fmt.Errorf("设置 cgroup proc 失败 %v", err)
+	}
+	return nil
+}
+
+func (f *FreezerSubSystem) Remove(cgroupPath string) error {
+	subsysCgroupPath, _, err := f.cgroupPath(cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return os.Remove(subsysCgroupPath)
+}
+
+// Freeze 冻结 cgroup 中的所有进程，阻塞到所有进程都被冻结
+func (f *FreezerSubSystem) Freeze(cgroupPath string) error {
+	return f.setState(cgroupPath, true)
+}
+
+// Thaw 恢复 cgroup 中被冻结的进程
+func (f *FreezerSubSystem) Thaw(cgroupPath string) error {
+	return f.setState(cgroupPath, false)
+}
+
+// Frozen cgroup 中的进程是否被冻结
+func (f *FreezerSubSystem) Frozen(cgroupPath string) bool {
+	subsysCgroupPath, v2, err := f.cgroupPath(cgroupPath, false)
+	if err != nil {
+		return false
+	}
+	if v2 {
+		// cgroup.events 的内容格式如下
+		// populated 1
+		// frozen 1
+		content, err := os.ReadFile(path.Join(subsysCgroupPath, "cgroup.events"))
+		if err != nil {
+			return false
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "frozen" {
+				return fields[1] == "1"
+			}
+		}
+		return false
+	}
+	content, err := os.ReadFile(path.Join(subsysCgroupPath, "freezer.state"))
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(content)) == "FROZEN"
+}
+
+func (f *FreezerSubSystem) setState(cgroupPath string, freeze bool) error {
+	subsysCgroupPath, v2, err := f.cgroupPath(cgroupPath, false)
+	if err != nil {
+		return fmt.Errorf("获取 cgroup %s 失败: %v", cgroupPath, err)
+	}
+	// v1 写入 FROZEN/THAWED, v2 写入 1/0
+	file, state := "freezer.state", "THAWED"
+	if freeze {
+		state = "FROZEN"
+	}
+	if v2 {
+		file, state = "cgroup.freeze", "0"
+		if freeze {
+			state = "1"
+		}
+	}
+	if err := os.WriteFile(path.Join(subsysCgroupPath, file), []byte(state), 0644); err != nil {
+		return fmt.Errorf("设置 cgroup %s 失败 %v", file, err)
+	}
+	// 冻结是异步的，v1 中间状态是 FREEZING，需要等待所有进程都被冻结
+	deadline := time.Now().Add(freezeTimeout)
+	for f.Frozen(cgroupPath) != freeze {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("等待 cgroup %s 的状态变为 %s 超时", cgroupPath, state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+// freezer cgroup 的目录，以及是否是 cgroup v2
+func (f *FreezerSubSystem) cgroupPath(cgroupPath string, autoCreate bool) (string, bool, error) {
+	return SubsystemPath(f.Name(), cgroupPath, autoCreate)
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 	"strconv"
+	"strings"
 )
 
 type MemorySubSystem struct {
@@ -48,3 +49,27 @@ func (m *MemorySubSystem) Remove(cgroupPath string) error {
 		return err
 	}
 }
+
+// OOMKilled cgroup 中是否有进程因为内存不足被杀死
+func (m *MemorySubSystem) OOMKilled(cgroupPath string) bool {
+	subsysCgroupPath, err := GetCgroupPath(m.Name(), cgroupPath, false)
+	if err != nil {
+		return false
+	}
+	content, err := os.ReadFile(path.Join(subsysCgroupPath, "memory.oom_control"))
+	if err != nil {
+		return false
+	}
+	// 内容格式如下，oom_kill 是被杀死的进程数量
+	// oom_kill_disable 0
+	// under_oom 0
+	// oom_kill 1
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			count, _ := strconv.Atoi(fields[1])
+			return count > 0
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// statSubSystem 只用于统计资源使用量的 subsystem，例如 cpuacct, pids, blkio，不设置资源限制
+type statSubSystem struct {
+	name string
+}
+
+func (s *statSubSystem) Name() string {
+	return s.name
+}
+
+// Set 没有资源限制，只创建 cgroup
+func (s *statSubSystem) Set(cgroupPath string, res *ResourceConfig) error {
+	_, _, err := SubsystemPath(s.name, cgroupPath, true)
+	return err
+}
+
+func (s *statSubSystem) Apply(cgroupPath string, pid int) error {
+	subsysCgroupPath, v2, err := SubsystemPath(s.name, cgroupPath, false)
+	if err != nil {
+		return fmt.Errorf("获取 cgroup %s 失败: %v", cgroupPath, err)
+	}
+	procs := "tasks"
+	if v2 {
+		procs = "cgroup.procs"
+	}
+	if err := os.WriteFile(path.Join(subsysCgroupPath, procs), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return fmt.Errorf("设置 cgroup proc 失败 %v", err)
+	}
+	return nil
+}
+
+func (s *statSubSystem) Remove(cgroupPath string) error {
+	subsysCgroupPath, _, err := SubsystemPath(s.name, cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	// cgroup v2 中多个 subsystem 是同一个目录，可能已经被删除
+	if err := os.Remove(subsysCgroupPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Stats cgroup 中进程的资源使用量
+type Stats struct {
+	// 累计使用的 cpu 时间，单位是纳秒
+	CpuUsage uint64 `json:"cpuUsage"`
+	// 使用的内存，不包括不活跃的文件缓存，单位是字节
+	MemoryUsage uint64 `json:"memoryUsage"`
+	// 内存限制，0 表示没有限制
+	MemoryLimit uint64 `json:"memoryLimit"`
+	// 进程数量
+	Pids uint64 `json:"pids"`
+	// 块设备累计读写的字节数
+	BlockRead  uint64 `json:"blockRead"`
+	BlockWrite uint64 `json:"blockWrite"`
+}
+
+// 内存限制大于这个值时认为没有限制，cgroup v1 中没有限制时是一个接近 int64 最大值的数
+const unlimitedMemory = 1 << 62
+
+// Stats 读取 cgroup 中进程的资源使用量，读取失败的统计项为 0，例如 mydocker 升级之前启动的容器没有加入 pids cgroup
+func (c *CgroupManager) Stats() *Stats {
+	stats := &Stats{}
+	// cpu
+	if dir, v2, err := SubsystemPath("cpuacct", c.Path, false); err == nil {
+		if v2 {
+			stats.CpuUsage = readKeyValue(path.Join(dir, "cpu.stat"), "usage_usec") * 1000
+		} else {
+			stats.CpuUsage = readUint(path.Join(dir, "cpuacct.usage"))
+		}
+	}
+	// 内存
+	if dir, v2, err := SubsystemPath("memory", c.Path, false); err == nil {
+		usageFile, limitFile, inactiveKey := "memory.usage_in_bytes", "memory.limit_in_bytes", "total_inactive_file"
+		if v2 {
+			usageFile, limitFile, inactiveKey = "memory.current", "memory.max", "inactive_file"
+		}
+		usage := readUint(path.Join(dir, usageFile))
+		if inactive := readKeyValue(path.Join(dir, "memory.stat"), inactiveKey); inactive < usage {
+			usage -= inactive
+		}
+		stats.MemoryUsage = usage
+		// cgroup v2 没有限制时是 max，解析失败为 0
+		if limit := readUint(path.Join(dir, limitFile)); limit < unlimitedMemory {
+			stats.MemoryLimit = limit
+		}
+	}
+	// 进程数量
+	if dir, _, err := SubsystemPath("pids", c.Path, false); err == nil {
+		stats.Pids = readUint(path.Join(dir, "pids.current"))
+	}
+	// 块设备读写
+	if dir, v2, err := SubsystemPath("blkio", c.Path, false); err == nil {
+		if v2 {
+			stats.BlockRead, stats.BlockWrite = readIoStat(path.Join(dir, "io.stat"))
+		} else {
+			stats.BlockRead, stats.BlockWrite = readBlkioServiceBytes(path.Join(dir, "blkio.throttle.io_service_bytes"))
+		}
+	}
+	return stats
+}
+
+// 读取只有一个数字的文件
+func readUint(file string) uint64 {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return 0
+	}
+	value, _ := strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+	return value
+}
+
+// 读取每行格式为 key value 的文件中 key 对应的值，例如 memory.stat
+func readKeyValue(file string, key string) uint64 {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == key {
+			value, _ := strconv.ParseUint(fields[1], 10, 64)
+			return value
+		}
+	}
+	return 0
+}
+
+// cgroup v1 blkio.throttle.io_service_bytes 的格式如下，累加所有设备的读写字节数
+// 8:0 Read 4096
+// 8:0 Write 0
+// Total 4096
+func readBlkioServiceBytes(file string) (uint64, uint64) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return 0, 0
+	}
+	var read, write uint64
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		value, _ := strconv.ParseUint(fields[2], 10, 64)
+		switch fields[1] {
+		case "Read":
+			read += value
+		case "Write":
+			write += value
+		}
+	}
+	return read, write
+}
+
+// cgroup v2 io.stat 的格式如下，累加所有设备的读写字节数
+// 8:0 rbytes=4096 wbytes=0 rios=1 wios=0 dbytes=0 dios=0
+func readIoStat(file string) (uint64, uint64) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return 0, 0
+	}
+	var read, write uint64
+	for _, line := range strings.Split(string(content), "\n") {
+		for _, field := range strings.Fields(line) {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			value, _ := strconv.ParseUint(kv[1], 10, 64)
+			switch kv[0] {
+			case "rbytes":
+				read += value
+			case "wbytes":
+				write += value
+			}
+		}
+	}
+	return read, write
+}
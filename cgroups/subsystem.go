@@ -2,9 +2,9 @@ package cgroups
 
 // ResourceConfig 传递资源限制的结构体 内存限制，cpu时间权重，cpu核数
 type ResourceConfig struct {
-	MemoryLimit string
-	CpuShare    string
-	CpuSet      string
+	MemoryLimit string `json:"memoryLimit"`
+	CpuShare    string `json:"cpuShare"`
+	CpuSet      string `json:"cpuSet"`
 }
 
 type Subsystem interface {
@@ -24,5 +24,9 @@ var (
 		&CpuSetSubsystem{},
 		&MemorySubSystem{},
 		&CpuSubSystem{},
+		&FreezerSubSystem{},
+		&statSubSystem{name: "cpuacct"},
+		&statSubSystem{name: "pids"},
+		&statSubSystem{name: "blkio"},
 	}
 )
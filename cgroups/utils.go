@@ -2,6 +2,7 @@ package cgroups
 
 import (
 	"bufio"
+	"fmt"
 	"log"
 	"os"
 	"path"
@@ -38,6 +39,27 @@ func FindCgroupMountPoint(subsystem string) string {
 	}
 	return ""
 }
+
+// FindCgroup2MountPoint 获取 cgroup v2 的挂载目录，没有挂载时返回空
+func FindCgroup2MountPoint() string {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	// 挂载信息格式如下, - 之后是文件系统类型
+	// 35 25 0:31 / /sys/fs/cgroup/unified rw,nosuid,nodev,noexec,relatime shared:10 - cgroup2 cgroup2 rw
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), " ")
+		for i, field := range fields {
+			if field == "-" && i+1 < len(fields) && fields[i+1] == "cgroup2" {
+				return fields[4]
+			}
+		}
+	}
+	return ""
+}
 func GetCgroupPath(subsystem string, cgroupPath string, autoCreate bool) (string, error) {
 	// 获取cgroup顶层目录
 	cgroupRoot := FindCgroupMountPoint(subsystem)
@@ -56,3 +78,26 @@ func GetCgroupPath(subsystem string, cgroupPath string, autoCreate bool) (string
 		return "", err
 	}
 }
+
+// SubsystemPath subsystem 中 cgroup 的目录，以及是否是 cgroup v2
+// 优先使用 cgroup v1 中挂载的 subsystem，没有挂载时使用 cgroup v2
+func SubsystemPath(subsystem string, cgroupPath string, autoCreate bool) (string, bool, error) {
+	if FindCgroupMountPoint(subsystem) != "" {
+		subsysCgroupPath, err := GetCgroupPath(subsystem, cgroupPath, autoCreate)
+		return subsysCgroupPath, false, err
+	}
+	root := FindCgroup2MountPoint()
+	if root == "" {
+		return "", false, fmt.Errorf("没有挂载 %s subsystem 或者 cgroup v2", subsystem)
+	}
+	subsysCgroupPath := path.Join(root, cgroupPath)
+	if _, err := os.Stat(subsysCgroupPath); err != nil {
+		if !autoCreate || !os.IsNotExist(err) {
+			return "", true, err
+		}
+		if err := os.MkdirAll(subsysCgroupPath, 0755); err != nil {
+			return "", true, err
+		}
+	}
+	return subsysCgroupPath, true, nil
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"bufio"
+	"containers"
+	"daemon"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// AttachOptions 附加到容器的标准输入输出时的参数
+type AttachOptions struct {
+	// 写入容器的标准输入，为空时不附加标准输入
+	Stdin io.Reader
+	// 容器的标准输出和标准错误写到这里
+	Stdout io.Writer
+	Stderr io.Writer
+	// 分离按键，为空时使用 containers.DefaultDetachKeys
+	DetachKeys string
+	// 容器使用终端时，从这里读取本地终端的窗口大小并调整容器终端的大小
+	Resize <-chan *containers.WindowSize
+}
+
+// Attach 附加到运行中的容器的标准输入输出，阻塞到按下分离按键或者容器退出
+func (c *Client) Attach(idOrName string, options *AttachOptions) (*containers.AttachResult, error) {
+	return c.attach(containerPath(idOrName, "attach"), nil, options)
+}
+
+// StartAttached 启动容器并附加到容器的标准输入输出，阻塞到按下分离按键或者容器退出
+func (c *Client) StartAttached(idOrName string, options *AttachOptions) (*containers.AttachResult, error) {
+	return c.attach(containerPath(idOrName, "start"), nil, options)
+}
+
+// RunAttached 创建并启动容器，附加到容器的标准输入输出，阻塞到按下分离按键或者容器退出
+// 前台交互式启动的容器退出后会被删除
+func (c *Client) RunAttached(config *containers.RunContainerConfig, options *AttachOptions) (*containers.AttachResult, error) {
+	return c.attach("/containers", config, options)
+}
+
+// ExecTerminal 分配伪终端在容器中执行命令，阻塞到命令结束，返回命令的退出码，不支持分离按键
+func (c *Client) ExecTerminal(idOrName string, cmd []string, options *AttachOptions) (*containers.AttachResult, error) {
+	return c.attach(containerPath(idOrName, "exec"), &daemon.ExecRequest{Cmd: cmd, Tty: true}, options)
+}
+
+// 调用 attach 接口，把 options.Stdin 写入容器的标准输入，容器的输出写到 options.Stdout 和 options.Stderr
+func (c *Client) attach(path string, in interface{}, options *AttachOptions) (*containers.AttachResult, error) {
+	query := url.Values{}
+	if options.Stdin != nil {
+		query.Set("stdin", "true")
+	}
+	if options.DetachKeys != "" {
+		query.Set("detachKeys", options.DetachKeys)
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	conn, err := net.Dial("unix", c.socket)
+	if err != nil {
+		return nil, c.connectError(err)
+	}
+	defer conn.Close()
+	req, err := c.newRequest(http.MethodPost, path, in)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", daemon.AttachUpgrade)
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("发送请求失败: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, fmt.Errorf("读取返回结果失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+	writer := &frameWriter{conn: conn}
+	if options.Stdin != nil {
+		go func() {
+			_, _ = io.Copy(writer, options.Stdin)
+			// 标准输入结束，关闭连接的写端，仍然可以读取容器的输出
+			_ = conn.(*net.UnixConn).CloseWrite()
+		}()
+	}
+	if options.Resize != nil {
+		go func() {
+			for size := range options.Resize {
+				if writer.resize(size) != nil {
+					return
+				}
+			}
+		}()
+	}
+	for {
+		stream, data, err := containers.ReadFrame(reader)
+		if err != nil {
+			return nil, fmt.Errorf("与 daemon 的连接中断: %v", err)
+		}
+		switch stream {
+		case containers.AttachStdout:
+			_, _ = options.Stdout.Write(data)
+		case containers.AttachStderr:
+			_, _ = options.Stderr.Write(data)
+		case containers.AttachEnd:
+			var result containers.AttachResult
+			if err := json.Unmarshal(data, &result); err != nil {
+				return nil, fmt.Errorf("解析 attach 结果失败: %v", err)
+			}
+			if result.Message != "" {
+				return &result, &Error{Message: result.Message}
+			}
+			return &result, nil
+		}
+	}
+}
+
+// 把标准输入和窗口大小作为数据帧写到 attach 连接
+type frameWriter struct {
+	conn net.Conn
+	lock sync.Mutex
+}
+
+// Write 写入一帧标准输入
+func (w *frameWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if err := containers.WriteFrame(w.conn, containers.AttachStdin, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *frameWriter) resize(size *containers.WindowSize) error {
+	content, err := json.Marshal(size)
+	if err != nil {
+		return err
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return containers.WriteFrame(w.conn, containers.AttachResize, content)
+}
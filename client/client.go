@@ -0,0 +1,142 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"daemon"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// Client 通过 unix socket 访问 mydocker daemon 的客户端
+// 所有的方法都返回结构化的结果和错误，不会输出内容，也不会退出进程
+type Client struct {
+	socket string
+	http   *http.Client
+}
+
+// Error daemon 返回的错误
+type Error struct {
+	// http 状态码
+	StatusCode int
+	// 错误信息
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// IsNotFound 错误是否是资源不存在，例如容器，网络不存在
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+// New 创建客户端, socket 为 daemon 监听的 unix socket, 为空时使用默认的 socket
+func New(socket string) *Client {
+	if socket == "" {
+		socket = daemon.DefaultSocket
+	}
+	return &Client{
+		socket: socket,
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// Version 获取 daemon 的接口版本
+func (c *Client) Version() (*daemon.VersionResponse, error) {
+	var version daemon.VersionResponse
+	if err := c.get("/version", &version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func (c *Client) get(path string, out interface{}) error {
+	return c.do(http.MethodGet, path, nil, out)
+}
+
+func (c *Client) post(path string, in interface{}, out interface{}) error {
+	return c.do(http.MethodPost, path, in, out)
+}
+
+func (c *Client) delete(path string) error {
+	return c.do(http.MethodDelete, path, nil, nil)
+}
+
+func (c *Client) do(method string, path string, in interface{}, out interface{}) error {
+	resp, err := c.send(method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("解析返回结果失败: %v", err)
+	}
+	return nil
+}
+
+// 发送请求，状态码表示失败时返回 *Error
+func (c *Client) send(method string, path string, in interface{}) (*http.Response, error) {
+	req, err := c.newRequest(method, path, in)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, c.connectError(err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+	return resp, nil
+}
+
+func (c *Client) newRequest(method string, path string, in interface{}) (*http.Request, error) {
+	var body io.Reader
+	if in != nil {
+		content, err := json.Marshal(in)
+		if err != nil {
+			return nil, fmt.Errorf("序列化请求参数失败: %v", err)
+		}
+		body = bytes.NewReader(content)
+	}
+	// 使用 unix socket 连接，host 只是占位
+	req, err := http.NewRequest(method, "http://mydocker/"+daemon.ApiVersion+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func (c *Client) connectError(err error) error {
+	return fmt.Errorf("无法连接到 mydocker daemon(%s), 请先执行 mydocker daemon 启动: %v", c.socket, err)
+}
+
+// 解析接口返回的错误信息
+func readError(resp *http.Response) error {
+	var e daemon.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Message == "" {
+		return &Error{StatusCode: resp.StatusCode, Message: fmt.Sprintf("请求失败: %s", resp.Status)}
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: e.Message}
+}
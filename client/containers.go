@@ -0,0 +1,303 @@
+package client
+
+import (
+	"containers"
+	"daemon"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// ListContainers 列出容器，all 为 false 时只列出运行中的容器
+// filters 是 key=value 格式的过滤条件，支持 status, name, image, label, health
+func (c *Client) ListContainers(all bool, filters []string) ([]*containers.ContainerInfo, error) {
+	query := url.Values{}
+	if all {
+		query.Set("all", "true")
+	}
+	for _, f := range filters {
+		query.Add("filter", f)
+	}
+	p := "/containers"
+	if len(query) > 0 {
+		p += "?" + query.Encode()
+	}
+	var list []*containers.ContainerInfo
+	if err := c.get(p, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// InspectContainer 根据容器id或者名称获取容器的详细信息
+func (c *Client) InspectContainer(idOrName string) (*containers.ContainerInspect, error) {
+	var info containers.ContainerInspect
+	if err := c.get(containerPath(idOrName, ""), &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// CreateContainer 创建容器，只记录配置，需要调用 Start 启动
+func (c *Client) CreateContainer(config *containers.RunContainerConfig) (*containers.ContainerInfo, error) {
+	var info containers.ContainerInfo
+	if err := c.post("/containers/create", config, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Start 启动新创建的或者已经停止的容器，容器的输出写到日志文件中
+func (c *Client) Start(idOrName string) (*containers.ContainerInfo, error) {
+	var info containers.ContainerInfo
+	if err := c.post(containerPath(idOrName, "start"), nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Restart 重新启动容器，运行中的容器先停止，超过 timeout 秒没有退出时强制杀死，timeout 小于0时使用 daemon 的默认值
+func (c *Client) Restart(idOrName string, timeout int) (*containers.ContainerInfo, error) {
+	var info containers.ContainerInfo
+	if err := c.post(containerPath(idOrName, "restart")+stopQuery(timeout), nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Run 创建并在后台启动容器
+func (c *Client) Run(config *containers.RunContainerConfig) (*containers.ContainerInfo, error) {
+	var info containers.ContainerInfo
+	if err := c.post("/containers", config, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Stop 停止容器，先发送容器的停止信号，超过 timeout 秒没有退出时发送 SIGKILL，阻塞到容器退出
+// timeout 小于0时使用 daemon 的默认值
+func (c *Client) Stop(idOrName string, timeout int) error {
+	return c.post(containerPath(idOrName, "stop")+stopQuery(timeout), nil, nil)
+}
+
+// Kill 向运行中的容器发送信号，signal 支持 SIGHUP, HUP, 1 等格式，为空时发送 SIGKILL
+// all 为 true 时发送给容器中的所有进程，否则只发送给容器的 init 进程
+func (c *Client) Kill(idOrName string, signal string, all bool) error {
+	query := url.Values{}
+	if signal != "" {
+		query.Set("signal", signal)
+	}
+	if all {
+		query.Set("all", "true")
+	}
+	p := containerPath(idOrName, "kill")
+	if len(query) > 0 {
+		p += "?" + query.Encode()
+	}
+	return c.post(p, nil, nil)
+}
+
+// Pause 冻结容器中的所有进程
+func (c *Client) Pause(idOrName string) error {
+	return c.post(containerPath(idOrName, "pause"), nil, nil)
+}
+
+// Unpause 恢复暂停的容器
+func (c *Client) Unpause(idOrName string) error {
+	return c.post(containerPath(idOrName, "unpause"), nil, nil)
+}
+
+// Remove 删除已经停止的容器
+func (c *Client) Remove(idOrName string) error {
+	return c.delete(containerPath(idOrName, ""))
+}
+
+// Wait 阻塞到容器满足 condition 指定的条件，返回容器最近一次退出的退出码，无法获取退出码时返回 -1
+// condition 为 daemon.WaitNotRunning, daemon.WaitNextExit 或者 daemon.WaitRemoved，为空时是 daemon.WaitNotRunning
+func (c *Client) Wait(idOrName string, condition string) (int, error) {
+	var resp daemon.WaitResponse
+	p := containerPath(idOrName, "wait")
+	if condition != "" {
+		p += "?condition=" + url.QueryEscape(condition)
+	}
+	if err := c.post(p, nil, &resp); err != nil {
+		return -1, err
+	}
+	return resp.ExitCode, nil
+}
+
+// LogsOptions 读取容器日志的参数
+type LogsOptions struct {
+	// 持续输出新的日志，直到容器退出
+	Follow bool
+	// 只输出最后多少条日志，为空时输出所有日志
+	Tail string
+	// unix 时间戳，为空时不限制
+	Since string
+	Until string
+	// 在每条日志前面加上时间
+	Timestamps bool
+	// 标准输出和标准错误的日志分别写到这里
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Logs 读取容器的日志，阻塞到日志读取完毕，Follow 为 true 时阻塞到容器退出
+func (c *Client) Logs(idOrName string, options *LogsOptions) error {
+	query := url.Values{}
+	if options.Follow {
+		query.Set("follow", "true")
+	}
+	if options.Tail != "" {
+		query.Set("tail", options.Tail)
+	}
+	if options.Since != "" {
+		query.Set("since", options.Since)
+	}
+	if options.Until != "" {
+		query.Set("until", options.Until)
+	}
+	if options.Timestamps {
+		query.Set("timestamps", "true")
+	}
+	p := containerPath(idOrName, "logs")
+	if len(query) > 0 {
+		p += "?" + query.Encode()
+	}
+	resp, err := c.send(http.MethodGet, p, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	for {
+		stream, data, err := containers.ReadFrame(resp.Body)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取容器日志失败: %v", err)
+		}
+		if stream == containers.AttachStderr {
+			_, _ = options.Stderr.Write(data)
+		} else {
+			_, _ = options.Stdout.Write(data)
+		}
+	}
+}
+
+// Top 列出容器中的所有进程
+func (c *Client) Top(idOrName string) ([]*containers.ProcessInfo, error) {
+	var processes []*containers.ProcessInfo
+	if err := c.get(containerPath(idOrName, "top"), &processes); err != nil {
+		return nil, err
+	}
+	return processes, nil
+}
+
+// Stats 获取运行中容器的资源使用量
+func (c *Client) Stats(idOrName string) (*containers.ContainerStats, error) {
+	var stats containers.ContainerStats
+	if err := c.get(containerPath(idOrName, "stats"), &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// Exec 在容器中执行命令，阻塞到命令结束
+// stdin 为空时命令没有输入，stdout，stderr 为空时丢弃命令的输出
+func (c *Client) Exec(idOrName string, cmd []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	p, err := newStdioPipes(stdin, stdout, stderr)
+	if err != nil {
+		return err
+	}
+	err = c.ExecFiles(idOrName, cmd, p.remote)
+	p.wait()
+	return err
+}
+
+// ExecFiles 在容器中执行命令，命令直接使用 files 作为标准输入，标准输出，标准错误，例如当前的终端
+func (c *Client) ExecFiles(idOrName string, cmd []string, files []*os.File) error {
+	_, err := c.stream(containerPath(idOrName, "exec"), &daemon.ExecRequest{Cmd: cmd}, files)
+	return err
+}
+
+// 容器接口的路径
+func containerPath(idOrName string, action string) string {
+	p := "/containers/" + url.PathEscape(idOrName)
+	if action != "" {
+		p += "/" + action
+	}
+	return p
+}
+
+// 停止容器的等待时间参数
+func stopQuery(timeout int) string {
+	if timeout < 0 {
+		return ""
+	}
+	return "?t=" + strconv.Itoa(timeout)
+}
+
+// stdioPipes 将 io.Reader/io.Writer 转换为可以传递给 daemon 的文件
+type stdioPipes struct {
+	// 传递给 daemon 的一端，依次为标准输入，标准输出，标准错误
+	remote []*os.File
+	// 本地读取输出的一端
+	local []*os.File
+	wg    sync.WaitGroup
+}
+
+func newStdioPipes(stdin io.Reader, stdout io.Writer, stderr io.Writer) (*stdioPipes, error) {
+	p := &stdioPipes{}
+	for i := 0; i < 3; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			closeAll(p.remote)
+			closeAll(p.local)
+			return nil, err
+		}
+		if i == 0 {
+			p.remote = append(p.remote, r)
+			p.local = append(p.local, w)
+		} else {
+			p.remote = append(p.remote, w)
+			p.local = append(p.local, r)
+		}
+	}
+	// 标准输入写完后关闭，命令才能读取到 EOF
+	go func(w *os.File) {
+		if stdin != nil {
+			_, _ = io.Copy(w, stdin)
+		}
+		w.Close()
+	}(p.local[0])
+	for i, out := range []io.Writer{stdout, stderr} {
+		if out == nil {
+			out = io.Discard
+		}
+		p.wg.Add(1)
+		go func(r *os.File, out io.Writer) {
+			defer p.wg.Done()
+			_, _ = io.Copy(out, r)
+		}(p.local[i+1], out)
+	}
+	return p, nil
+}
+
+// 命令结束后调用，关闭传递给 daemon 的一端，等待输出拷贝完成
+func (p *stdioPipes) wait() {
+	closeAll(p.remote)
+	p.wg.Wait()
+	p.local[1].Close()
+	p.local[2].Close()
+}
+
+func closeAll(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
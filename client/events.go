@@ -0,0 +1,47 @@
+package client
+
+import (
+	"containers"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Events 读取 daemon 的事件，每读取到一个事件调用一次 handle，handle 返回错误时停止读取
+// since, until 为空时分别表示只读取之后发生的事件，以及一直等待新的事件，filters 是 key=value 格式的过滤条件
+func (c *Client) Events(since string, until string, filters []string, handle func(event *containers.Event) error) error {
+	query := url.Values{}
+	if since != "" {
+		query.Set("since", since)
+	}
+	if until != "" {
+		query.Set("until", until)
+	}
+	for _, filter := range filters {
+		query.Add("filter", filter)
+	}
+	path := "/events"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	resp, err := c.send(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event containers.Event
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("读取事件失败: %v", err)
+		}
+		if err := handle(&event); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"containers"
+	"daemon"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// ListImages 列出所有的镜像
+func (c *Client) ListImages() ([]*containers.ImageInfo, error) {
+	var list []*containers.ImageInfo
+	if err := c.get("/images", &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// InspectImage 根据镜像名称或者id获取镜像的详细信息
+func (c *Client) InspectImage(idOrName string) (*containers.ImageInspect, error) {
+	var info containers.ImageInspect
+	if err := c.get(imagePath(idOrName, ""), &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// RemoveImage 删除镜像，force 为 true 时强制删除有多个名称，被容器使用或者是其他镜像的基础镜像的镜像
+func (c *Client) RemoveImage(idOrName string, force bool) ([]*containers.ImageDeleteResult, error) {
+	p := imagePath(idOrName, "")
+	if force {
+		p += "?force=true"
+	}
+	var result []*containers.ImageDeleteResult
+	if err := c.do(http.MethodDelete, p, nil, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// TagImage 给镜像加上新的名称，其他镜像上的同名名称被去掉
+func (c *Client) TagImage(idOrName string, tag string) error {
+	return c.post(imagePath(idOrName, "tag")+"?tag="+url.QueryEscape(tag), nil, nil)
+}
+
+// ImageHistory 镜像的每个镜像层和创建它的指令，从上到下排列
+func (c *Client) ImageHistory(idOrName string) ([]*containers.ImageHistory, error) {
+	var history []*containers.ImageHistory
+	if err := c.get(imagePath(idOrName, "history"), &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// PruneImages 删除没有名称，没有被容器使用，也不是其他镜像的基础镜像的镜像
+func (c *Client) PruneImages() (*daemon.ImagePruneResponse, error) {
+	var resp daemon.ImagePruneResponse
+	if err := c.post("/images/prune", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CommitContainer 提交容器为镜像
+func (c *Client) CommitContainer(idOrName string, req *daemon.CommitRequest) (*containers.ImageInfo, error) {
+	var info containers.ImageInfo
+	if err := c.post(containerPath(idOrName, "commit"), req, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// BuildBaseImage 导入 tar 包作为基础镜像，file 是 daemon 可以访问的绝对路径
+func (c *Client) BuildBaseImage(file string) (*containers.ImageInfo, error) {
+	var info containers.ImageInfo
+	if err := c.post("/images/base", &daemon.BaseImageRequest{File: file}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// SaveImages 保存镜像或者容器的文件系统到 tar 文件
+func (c *Client) SaveImages(req *daemon.SaveRequest) error {
+	return c.post("/images/save", req, nil)
+}
+
+// BuildImage 根据 Dockerfile 构建镜像，构建的输出写到 out，返回镜像id
+func (c *Client) BuildImage(req *daemon.BuildRequest, out io.Writer) (string, error) {
+	return c.imageStream("/images/build", req, nil, out)
+}
+
+// PullImage 从仓库拉取镜像，进度写到 out，返回镜像id
+func (c *Client) PullImage(req *daemon.PullRequest, out io.Writer) (string, error) {
+	return c.imageStream("/images/pull", req, nil, out)
+}
+
+// PushImage 推送镜像到仓库，进度写到 out
+func (c *Client) PushImage(idOrName string, req *daemon.PushRequest, out io.Writer) error {
+	_, err := c.imageStream(imagePath(idOrName, "push"), req, nil, out)
+	return err
+}
+
+// LoadImages 导入镜像归档，req.Input 为空时从 stdin 读取 tar，导入的镜像写到 out
+func (c *Client) LoadImages(req *daemon.LoadRequest, stdin io.Reader, out io.Writer) error {
+	_, err := c.imageStream("/images/load", req, stdin, out)
+	return err
+}
+
+// 调用升级连接的镜像接口，stdin 作为接口的输入，输出写到 out，返回镜像id
+func (c *Client) imageStream(path string, in interface{}, stdin io.Reader, out io.Writer) (string, error) {
+	p, err := newStdioPipes(stdin, out, out)
+	if err != nil {
+		return "", err
+	}
+	result, err := c.stream(path, in, p.remote)
+	p.wait()
+	if err != nil {
+		return "", err
+	}
+	return result.Id, nil
+}
+
+// 镜像接口的路径
+func imagePath(idOrName string, action string) string {
+	p := "/images/" + url.PathEscape(idOrName)
+	if action != "" {
+		p += "/" + action
+	}
+	return p
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"containers"
+	"daemon"
+	"net/url"
+	"networks"
+)
+
+// InspectVolume 根据匿名卷的id或者宿主机目录获取卷的信息
+func (c *Client) InspectVolume(name string) (*containers.VolumeInspect, error) {
+	var info containers.VolumeInspect
+	if err := c.get("/volumes/"+url.PathEscape(name), &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// ListNetworks 列出所有的网络
+func (c *Client) ListNetworks() ([]*networks.Network, error) {
+	var list []*networks.Network
+	if err := c.get("/networks", &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// InspectNetwork 获取网络的详细信息
+func (c *Client) InspectNetwork(name string) (*networks.NetworkInspect, error) {
+	var info networks.NetworkInspect
+	if err := c.get("/networks/"+url.PathEscape(name), &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// CreateNetwork 创建网络，driver 为空时使用 bridge
+func (c *Client) CreateNetwork(name string, driver string, subnet string) error {
+	return c.post("/networks", &daemon.NetworkCreateRequest{
+		Name:   name,
+		Driver: driver,
+		Subnet: subnet,
+	}, nil)
+}
+
+// RemoveNetwork 删除网络
+func (c *Client) RemoveNetwork(name string) error {
+	return c.delete("/networks/" + url.PathEscape(name))
+}
+
+// ListPortMappings 列出生效的端口映射，key是宿主机端口，value是映射的目标地址
+func (c *Client) ListPortMappings() (map[int][]string, error) {
+	var mapping map[int][]string
+	if err := c.get("/portmap", &mapping); err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// UpdatePortMappings 添加和删除端口映射，格式为 宿主机端口:目标地址:目标端口
+func (c *Client) UpdatePortMappings(add []string, remove []string) error {
+	return c.post("/portmap", &networks.PortMappingStruct{
+		PortMapping:   add,
+		PortUnMapping: remove,
+	}, nil)
+}
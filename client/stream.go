@@ -0,0 +1,66 @@
+package client
+
+import (
+	"bufio"
+	"daemon"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+)
+
+// stream 调用交互式接口，将 files 作为标准输入，标准输出，标准错误传递给 daemon，阻塞到接口结束
+func (c *Client) stream(path string, in interface{}, files []*os.File) (*daemon.StreamResult, error) {
+	conn, err := net.Dial("unix", c.socket)
+	if err != nil {
+		return nil, c.connectError(err)
+	}
+	defer conn.Close()
+	req, err := c.newRequest(http.MethodPost, path, in)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", daemon.StdioUpgrade)
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("发送请求失败: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, fmt.Errorf("读取返回结果失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+	if err := sendFiles(conn.(*net.UnixConn), files); err != nil {
+		return nil, err
+	}
+	// 阻塞到 daemon 返回结果
+	var result daemon.StreamResult
+	if err := json.NewDecoder(reader).Decode(&result); err != nil {
+		return nil, fmt.Errorf("与 daemon 的连接中断: %v", err)
+	}
+	if result.Message != "" {
+		return &result, &Error{Message: result.Message}
+	}
+	return &result, nil
+}
+
+// 通过 unix socket 传递文件描述符
+func sendFiles(conn *net.UnixConn, files []*os.File) error {
+	if len(files) != 3 {
+		return fmt.Errorf("需要传递标准输入，标准输出，标准错误3个文件")
+	}
+	var fds []int
+	for _, f := range files {
+		fds = append(fds, int(f.Fd()))
+	}
+	if _, _, err := conn.WriteMsgUnix([]byte{0}, syscall.UnixRights(fds...), nil); err != nil {
+		return fmt.Errorf("传递文件描述符失败: %v", err)
+	}
+	return nil
+}
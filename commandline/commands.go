@@ -2,22 +2,33 @@ package commandline
 
 import (
 	"cgroups"
+	"client"
 	"containers"
+	"daemon"
 	"fmt"
 	"github.com/urfave/cli"
 	"log"
+	"logger"
 	"networks"
 	"nsenter"
 	"os"
+	"path/filepath"
+	"registry"
 	"run"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 )
 
 func StartCommands() {
 	app := cli.NewApp()
 	app.Name = "mydocker"
 	app.Usage = "容器运行时实现"
-	app.Commands = []cli.Command{RunCommand, InitCommand, CommitCommand, PsCommand, LogCommand,
-		ExecCommand, StopCommand, RemoveCommand, BuildBaseImageCommand, ImagesCommand, BuildImageCommand, NetworkCommand, PortMappingCommand, SaveCommand}
+	app.Commands = []cli.Command{DaemonCommand, RunCommand, InitCommand, ShimCommand, CommitCommand, PsCommand, InspectCommand, TopCommand, StatsCommand, EventsCommand, LogCommand,
+		ExecCommand, AttachCommand, StopCommand, KillCommand, PauseCommand, UnpauseCommand, WaitCommand, StartCommand, RestartCommand, RemoveCommand, BuildBaseImageCommand, ImagesCommand, BuildImageCommand, NetworkCommand, PortMappingCommand, SaveCommand, LoadCommand, PullCommand, PushCommand,
+		RmiCommand, TagCommand, HistoryCommand, ImageCommand}
 	err := app.Run(os.Args)
 	if err != nil {
 		log.Fatalln(err)
@@ -29,10 +40,24 @@ var RunCommand = cli.Command{
 	Name: "run",
 	Usage: ` 启动容器
 		`,
+	// 支持合并的短参数，例如 -dit
+	UseShortOptionHandling: true,
 	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "i",
+			Usage: "保持容器的标准输入打开，前台运行时附加到容器的标准输入",
+		},
+		cli.BoolFlag{
+			Name:  "t",
+			Usage: "交互式运行，前台运行时附加到容器的标准输出",
+		},
 		cli.BoolFlag{
 			Name:  "ti",
-			Usage: "enable tty",
+			Usage: "等同于 -i -t",
+		},
+		cli.StringFlag{
+			Name:  "detach-keys",
+			Usage: "从容器分离的按键，默认 " + containers.DefaultDetachKeys,
 		},
 		cli.StringFlag{
 			Name:  "m",
@@ -83,6 +108,52 @@ var RunCommand = cli.Command{
 			Name:  "command",
 			Usage: "执行的命令,当命令中含有 - 等特殊字符时，使用 command作为输入",
 		},
+		cli.StringFlag{
+			Name:  "restart",
+			Usage: "容器退出后的重启策略 no, on-failure[:最多重启次数], always, unless-stopped",
+			Value: containers.RestartNo,
+		},
+		cli.StringFlag{
+			Name:  "stop-signal",
+			Usage: "停止容器时发送的信号，默认使用镜像的 STOPSIGNAL, 没有时使用 SIGTERM",
+		},
+		cli.StringSliceFlag{
+			Name:  "label, l",
+			Usage: "设置容器的标签 key=value，可指定多个",
+		},
+		cli.StringFlag{
+			Name:  "health-cmd",
+			Usage: "健康检查的命令，覆盖镜像的 HEALTHCHECK",
+		},
+		cli.DurationFlag{
+			Name:  "health-interval",
+			Usage: "两次健康检查的间隔，默认 30s",
+		},
+		cli.DurationFlag{
+			Name:  "health-timeout",
+			Usage: "单次健康检查的超时时间，默认 30s",
+		},
+		cli.DurationFlag{
+			Name:  "health-start-period",
+			Usage: "容器启动后的这段时间内健康检查失败不计入连续失败次数",
+		},
+		cli.IntFlag{
+			Name:  "health-retries",
+			Usage: "健康检查连续失败多少次后标记为 unhealthy，默认 3",
+		},
+		cli.BoolFlag{
+			Name:  "no-healthcheck",
+			Usage: "禁用镜像中的健康检查",
+		},
+		cli.StringFlag{
+			Name:  "log-driver",
+			Usage: "容器的日志驱动 json-file, local, none",
+			Value: logger.DefaultDriver,
+		},
+		cli.StringSliceFlag{
+			Name:  "log-opt",
+			Usage: "日志驱动的参数 key=value，可指定多个，json-file 和 local 支持 max-size, max-file",
+		},
 	},
 	// 具体的执行命令
 	Action: func(context *cli.Context) error {
@@ -101,12 +172,10 @@ var RunCommand = cli.Command{
 		var config containers.RunContainerConfig
 		config.CmdArray = cmdArray
 		// 获取tty参数
-		config.Tty = context.Bool("ti")
+		config.Tty = context.Bool("t") || context.Bool("ti")
+		config.OpenStdin = context.Bool("i") || context.Bool("ti")
 		// 获取 detach 参数
 		config.Detach = context.Bool("d")
-		if config.Tty && config.Detach {
-			return fmt.Errorf("ti 和 d 不能同时使用")
-		}
 		config.Res = &cgroups.ResourceConfig{
 			MemoryLimit: context.String("m"),
 			CpuSet:      context.String("cpuset"),
@@ -126,16 +195,60 @@ var RunCommand = cli.Command{
 		config.Net = context.String("net")
 		//域名解析使用的文件
 		config.Resolv = context.String("resolv")
+		// 重启策略
+		config.Restart = context.String("restart")
+		// 停止信号
+		config.StopSignal = context.String("stop-signal")
+		// 标签
+		config.Labels = context.StringSlice("label")
+		// 日志驱动
+		config.LogDriver = context.String("log-driver")
+		config.LogOpts = context.StringSlice("log-opt")
+		// 健康检查
+		healthCheck, err := healthCheckConfig(context)
+		if err != nil {
+			return err
+		}
+		config.HealthCheck = healthCheck
 
 		if config.Image == "" {
 			log.Println("镜像id不能为空")
 			return nil
 		}
-		run.Run(config)
+		c := newClient()
+		if config.Interactive() {
+			// 前台交互式启动，阻塞到容器退出或者按下分离按键
+			options := attachOptions(config.OpenStdin, context.String("detach-keys"))
+			if config.Tty {
+				defer setupTerminal(options)()
+			}
+			return attachExit(c.RunAttached(&config, options))
+		}
+		info, err := c.Run(&config)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("容器 %s 启动, 容器进程 pid: %s \n", info.Id, info.Pid)
 		return nil
 	},
 }
 
+// DaemonCommand 启动 mydocker daemon，其他命令通过 unix socket 调用 daemon 的接口
+var DaemonCommand = cli.Command{
+	Name:  "daemon",
+	Usage: "启动 mydocker daemon",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "socket",
+			Usage: "监听的 unix socket",
+			Value: daemon.DefaultSocket,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		return daemon.Start(context.String("socket"))
+	},
+}
+
 // InitCommand 定义 init 命令，这是内部命令
 var InitCommand = cli.Command{
 	Name: "init",
@@ -143,7 +256,6 @@ var InitCommand = cli.Command{
 		`,
 	// 具体的执行命令
 	Action: func(context *cli.Context) error {
-		log.Println("容器 init 中 ")
 		err := run.RunContainerInitProcess()
 		if err != nil {
 			return err
@@ -152,45 +264,314 @@ var InitCommand = cli.Command{
 	},
 }
 
-// CommitCommand 镜像提交命令 @Todo 打包镜像先不做
+// ShimCommand 定义 shim 命令，这是内部命令
+var ShimCommand = cli.Command{
+	Name: "shim",
+	Usage: `内部用于监控容器进程，不能从外部访问
+		`,
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("缺少容器id")
+		}
+		return run.Shim(context.Args()[0])
+	},
+}
+
+// CommitCommand 镜像提交命令, 将容器的 upper 层提交为新的镜像
 var CommitCommand = cli.Command{
 	Name:  "commit",
-	Usage: "提交容器为镜像",
+	Usage: "提交容器为镜像 mydocker commit 容器标识 镜像名称:版本",
+	Flags: []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "change, c",
+			Usage: "使用dockerfile指令修改镜像配置，支持 CMD ENTRYPOINT ENV EXPOSE LABEL VOLUME WORKDIR STOPSIGNAL HEALTHCHECK，可指定多个",
+		},
+		cli.StringFlag{
+			Name:  "author, a",
+			Usage: "镜像作者",
+		},
+		cli.StringFlag{
+			Name:  "message, m",
+			Usage: "提交说明",
+		},
+		cli.BoolTFlag{
+			Name:  "pause, p",
+			Usage: "提交期间暂停运行中的容器，默认为 true",
+		},
+	},
 	Action: func(context *cli.Context) error {
 		if len(context.Args()) < 2 {
 			return fmt.Errorf("缺少容器名称和镜像名称")
 		}
 		containerName := context.Args().Get(0)
 		imageName := context.Args().Get(1)
-		log.Println(containerName, imageName)
+		image, err := newClient().CommitContainer(containerName, &daemon.CommitRequest{
+			Tag:     imageName,
+			Changes: context.StringSlice("change"),
+			Author:  context.String("author"),
+			Message: context.String("message"),
+			Pause:   context.BoolT("pause"),
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Println(image.Id)
 		return nil
 	},
 }
 
 var PsCommand = cli.Command{
 	Name:  "ps",
-	Usage: "列出所有容器",
+	Usage: "列出运行中的容器",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "a",
+			Usage: "列出所有容器，默认只列出运行中的容器",
+		},
+		cli.StringSliceFlag{
+			Name:  "filter, f",
+			Usage: "过滤条件 status=, name=, image=, label=, health=，可指定多个",
+		},
+		cli.BoolFlag{
+			Name:  "q",
+			Usage: "只输出容器id",
+		},
+		formatFlag,
+	},
 	Action: func(context *cli.Context) error {
-		run.Ps()
+		list, err := newClient().ListContainers(context.Bool("a"), context.StringSlice("filter"))
+		if err != nil {
+			return err
+		}
+		if context.Bool("q") {
+			for _, info := range list {
+				fmt.Println(info.Id)
+			}
+			return nil
+		}
+		if format := context.String("format"); format != "" {
+			var items []interface{}
+			for _, info := range list {
+				items = append(items, info)
+			}
+			return printFormat(format, items)
+		}
+		containers.ListContainerInfo(list)
 		return nil
 	},
 }
 
+// InspectCommand 输出容器，镜像，网络或者卷的详细信息
+var InspectCommand = cli.Command{
+	Name:  "inspect",
+	Usage: "查看容器，镜像，网络或者卷的详细信息 mydocker inspect 标识...",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "type",
+			Usage: "对象类型 container, image, network, volume，不指定时依次查找",
+		},
+		formatFlag,
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("缺少要查看的对象标识")
+		}
+		var items []interface{}
+		for _, ref := range context.Args() {
+			item, err := inspect(newClient(), context.String("type"), ref)
+			if err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+		if format := context.String("format"); format != "" {
+			return printFormat(format, items)
+		}
+		return printJSON(items)
+	},
+}
+
+// 根据类型获取对象的详细信息，没有指定类型时依次查找容器，镜像，网络，卷
+func inspect(c *client.Client, objectType string, ref string) (interface{}, error) {
+	inspectors := []struct {
+		objectType string
+		inspect    func(string) (interface{}, error)
+	}{
+		{"container", func(ref string) (interface{}, error) { return c.InspectContainer(ref) }},
+		{"image", func(ref string) (interface{}, error) { return c.InspectImage(ref) }},
+		{"network", func(ref string) (interface{}, error) { return c.InspectNetwork(ref) }},
+		{"volume", func(ref string) (interface{}, error) { return c.InspectVolume(ref) }},
+	}
+	for _, i := range inspectors {
+		if objectType != "" && objectType != i.objectType {
+			continue
+		}
+		item, err := i.inspect(ref)
+		if err == nil {
+			return item, nil
+		}
+		if objectType != "" || !client.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	if objectType != "" {
+		return nil, fmt.Errorf("不支持的对象类型: %s", objectType)
+	}
+	return nil, fmt.Errorf("没有找到对象: %s", ref)
+}
+
+// TopCommand 列出容器中的进程，进程信息直接从宿主机的 /proc 中读取，不依赖镜像中的 ps
+var TopCommand = cli.Command{
+	Name:      "top",
+	Usage:     "列出容器中的进程",
+	ArgsUsage: "容器标识 [-o user,pid,cpid,ppid,stat,time,cmd]",
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("缺少容器名称或标识")
+		}
+		columns, err := parseTopOptions(context.Args()[1:])
+		if err != nil {
+			return err
+		}
+		processes, err := newClient().Top(context.Args()[0])
+		if err != nil {
+			return err
+		}
+		listProcesses(processes, columns)
+		return nil
+	},
+}
+
+// StatsCommand 实时输出容器的资源使用情况，不指定容器时输出所有运行中的容器
+var StatsCommand = cli.Command{
+	Name:      "stats",
+	Usage:     "输出容器的 cpu，内存，网络，块设备和进程数量的使用情况",
+	ArgsUsage: "[容器标识...]",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "no-stream",
+			Usage: "只输出一次结果，默认每秒刷新",
+		},
+		formatFlag,
+	},
+	Action: func(context *cli.Context) error {
+		return showStats(newClient(), context.Args(), context.Bool("no-stream"), context.String("format"))
+	},
+}
+
+// EventsCommand 输出容器，镜像，网络的事件，没有 --until 时持续输出新的事件
+var EventsCommand = cli.Command{
+	Name:  "events",
+	Usage: "输出容器，镜像，网络的事件",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "since",
+			Usage: "输出这个时间之后的事件，例如 10m, 2006-01-02 15:04:05, unix 时间戳",
+		},
+		cli.StringFlag{
+			Name:  "until",
+			Usage: "输出到这个时间为止的事件，格式和 --since 相同",
+		},
+		cli.StringSliceFlag{
+			Name:  "filter, f",
+			Usage: "过滤条件 type=, event=, container=, image=, network=, label=，可指定多个，例如 type=container,event=die",
+		},
+		formatFlag,
+	},
+	Action: func(context *cli.Context) error {
+		now := time.Now()
+		since, err := eventTime(context.String("since"), now)
+		if err != nil {
+			return err
+		}
+		until, err := eventTime(context.String("until"), now)
+		if err != nil {
+			return err
+		}
+		format := context.String("format")
+		if format == "json" {
+			format = "{{json .}}"
+		}
+		return newClient().Events(since, until, context.StringSlice("filter"), func(event *containers.Event) error {
+			if format != "" {
+				return printFormat(format, []interface{}{event})
+			}
+			fmt.Println(event.String())
+			return nil
+		})
+	},
+}
+
 var LogCommand = cli.Command{
 	Name:  "logs",
 	Usage: "打印容器日志",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "follow, f",
+			Usage: "持续输出新的日志，直到容器退出",
+		},
+		cli.StringFlag{
+			Name:  "tail, n",
+			Usage: "只输出最后多少条日志",
+			Value: "all",
+		},
+		cli.StringFlag{
+			Name:  "since",
+			Usage: "输出这个时间之后的日志，例如 10m, 2006-01-02 15:04:05, unix 时间戳",
+		},
+		cli.StringFlag{
+			Name:  "until",
+			Usage: "输出到这个时间为止的日志，格式和 --since 相同",
+		},
+		cli.BoolFlag{
+			Name:  "timestamps, t",
+			Usage: "在每条日志前面加上时间",
+		},
+	},
 	Action: func(context *cli.Context) error {
 		if len(context.Args()) < 1 {
 			return fmt.Errorf("缺少容器名称或者标识")
 		}
-		run.Log(context.Args()[0])
-		return nil
+		now := time.Now()
+		since, err := eventTime(context.String("since"), now)
+		if err != nil {
+			return err
+		}
+		until, err := eventTime(context.String("until"), now)
+		if err != nil {
+			return err
+		}
+		return newClient().Logs(context.Args()[0], &client.LogsOptions{
+			Follow:     context.Bool("follow"),
+			Tail:       context.String("tail"),
+			Since:      since,
+			Until:      until,
+			Timestamps: context.Bool("timestamps"),
+			Stdout:     os.Stdout,
+			Stderr:     os.Stderr,
+		})
 	},
 }
 
 var ExecCommand = cli.Command{
 	Name:  "exec",
 	Usage: "在容器中执行命令",
+	// 支持合并的短参数，例如 -it
+	UseShortOptionHandling: true,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "i",
+			Usage: "使用 -t 时附加标准输入",
+		},
+		cli.BoolFlag{
+			Name:  "t",
+			Usage: "分配伪终端，命令的标准输入输出是伪终端，本地终端设置为 raw 模式",
+		},
+		cli.BoolFlag{
+			Name:  "ti",
+			Usage: "等同于 -i -t",
+		},
+	},
 	Action: func(context *cli.Context) error {
 		// 说明当前是fork的进程，环境变量已经设置好， c语言的代码也已经执行了（运行的时机要早于下面的代码），真正要执行的命令
 		// 例如 sh，也已经退出了，直接结束即可
@@ -211,18 +592,209 @@ var ExecCommand = cli.Command{
 			commandArray = append(commandArray, arg)
 		}
 		//执行命令
-		run.Exec(containerId, commandArray)
-		return nil
+		c := newClient()
+		if context.Bool("t") || context.Bool("ti") {
+			options := attachOptions(context.Bool("i") || context.Bool("ti"), "")
+			defer setupTerminal(options)()
+			return attachExit(c.ExecTerminal(containerId, commandArray, options))
+		}
+		return c.ExecFiles(containerId, commandArray, []*os.File{os.Stdin, os.Stdout, os.Stderr})
 	},
 }
 var StopCommand = cli.Command{
 	Name:  "stop",
 	Usage: "停止容器",
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "t",
+			Usage: "等待容器退出的秒数，超时后强制杀死容器",
+			Value: 10,
+		},
+	},
 	Action: func(context *cli.Context) error {
 		if len(context.Args()) < 1 {
 			return fmt.Errorf("缺少容器名称或标识")
 		}
-		run.Stop(context.Args()[0])
+		for _, idOrName := range context.Args() {
+			if err := newClient().Stop(idOrName, context.Int("t")); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+var KillCommand = cli.Command{
+	Name:  "kill",
+	Usage: "向容器发送信号 mydocker kill -s 信号 容器标识",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "s",
+			Usage: "发送的信号，支持 SIGHUP, HUP, 1 等格式",
+			Value: "SIGKILL",
+		},
+		cli.BoolFlag{
+			Name:  "all",
+			Usage: "发送给容器中的所有进程，默认只发送给容器的 init 进程",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("缺少容器名称或标识")
+		}
+		for _, idOrName := range context.Args() {
+			if err := newClient().Kill(idOrName, context.String("s"), context.Bool("all")); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+var PauseCommand = cli.Command{
+	Name:  "pause",
+	Usage: "暂停容器中的所有进程",
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("缺少容器名称或标识")
+		}
+		for _, idOrName := range context.Args() {
+			if err := newClient().Pause(idOrName); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+var UnpauseCommand = cli.Command{
+	Name:  "unpause",
+	Usage: "恢复暂停的容器",
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("缺少容器名称或标识")
+		}
+		for _, idOrName := range context.Args() {
+			if err := newClient().Unpause(idOrName); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+var WaitCommand = cli.Command{
+	Name:  "wait",
+	Usage: "阻塞到容器退出，输出容器的退出码",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "condition",
+			Usage: "等待的条件 not-running, next-exit, removed",
+			Value: daemon.WaitNotRunning,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("缺少容器名称或标识")
+		}
+		for _, idOrName := range context.Args() {
+			exitCode, err := newClient().Wait(idOrName, context.String("condition"))
+			if err != nil {
+				return err
+			}
+			fmt.Println(exitCode)
+		}
+		return nil
+	},
+}
+var StartCommand = cli.Command{
+	Name:  "start",
+	Usage: "启动已经停止的容器",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "a",
+			Usage: "附加到容器的标准输入输出，阻塞到容器退出或者按下分离按键",
+		},
+		cli.BoolFlag{
+			Name:  "i",
+			Usage: "附加到容器的标准输入，容器需要使用 -i 创建",
+		},
+		cli.StringFlag{
+			Name:  "detach-keys",
+			Usage: "从容器分离的按键，默认 " + containers.DefaultDetachKeys,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("缺少容器名称或标识")
+		}
+		if context.Bool("a") {
+			c := newClient()
+			options := attachOptions(context.Bool("i"), context.String("detach-keys"))
+			restore, err := setupContainerTerminal(c, context.Args()[0], options)
+			if err != nil {
+				return err
+			}
+			defer restore()
+			return attachExit(c.StartAttached(context.Args()[0], options))
+		}
+		for _, idOrName := range context.Args() {
+			info, err := newClient().Start(idOrName)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("容器 %s 启动, 容器进程 pid: %s \n", info.Id, info.Pid)
+		}
+		return nil
+	},
+}
+
+// AttachCommand 附加到运行中的容器的标准输入输出
+var AttachCommand = cli.Command{
+	Name:  "attach",
+	Usage: "附加到运行中的容器的标准输入输出，按下分离按键后容器继续运行 mydocker attach 容器标识",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "no-stdin",
+			Usage: "不附加标准输入",
+		},
+		cli.StringFlag{
+			Name:  "detach-keys",
+			Usage: "从容器分离的按键，默认 " + containers.DefaultDetachKeys,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("缺少容器名称或标识")
+		}
+		c := newClient()
+		options := attachOptions(!context.Bool("no-stdin"), context.String("detach-keys"))
+		restore, err := setupContainerTerminal(c, context.Args()[0], options)
+		if err != nil {
+			return err
+		}
+		defer restore()
+		return attachExit(c.Attach(context.Args()[0], options))
+	},
+}
+
+var RestartCommand = cli.Command{
+	Name:  "restart",
+	Usage: "重新启动容器",
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "t",
+			Usage: "等待运行中的容器退出的秒数，超时后强制杀死容器",
+			Value: 10,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("缺少容器名称或标识")
+		}
+		for _, idOrName := range context.Args() {
+			info, err := newClient().Restart(idOrName, context.Int("t"))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("容器 %s 重新启动, 容器进程 pid: %s \n", info.Id, info.Pid)
+		}
 		return nil
 	},
 }
@@ -233,8 +805,7 @@ var RemoveCommand = cli.Command{
 		if len(context.Args()) < 1 {
 			return fmt.Errorf("缺少容器名称或标识")
 		}
-		run.Remove(context.Args()[0])
-		return nil
+		return newClient().Remove(context.Args()[0])
 	},
 }
 
@@ -245,15 +816,37 @@ var BuildBaseImageCommand = cli.Command{
 		if len(context.Args()) < 1 {
 			return fmt.Errorf("缺少基础镜像tar包路径")
 		}
-		containers.BuildBaseImage(context.Args()[0])
+		file, err := absPath(context.Args()[0])
+		if err != nil {
+			return err
+		}
+		image, err := newClient().BuildBaseImage(file)
+		if err != nil {
+			return err
+		}
+		fmt.Println(image.Id)
 		return nil
 	},
 }
 var ImagesCommand = cli.Command{
 	Name:  "images",
 	Usage: "展示镜像",
+	Flags: []cli.Flag{
+		formatFlag,
+	},
 	Action: func(context *cli.Context) error {
-		containers.ListImageInfo()
+		list, err := newClient().ListImages()
+		if err != nil {
+			return err
+		}
+		if format := context.String("format"); format != "" {
+			var items []interface{}
+			for _, info := range list {
+				items = append(items, info)
+			}
+			return printFormat(format, items)
+		}
+		containers.ListImageInfo(list)
 		return nil
 	},
 }
@@ -268,10 +861,29 @@ var BuildImageCommand = cli.Command{
 		cli.StringFlag{
 			Name:  "f",
 			Usage: "docker file路径",
+			Value: "Dockerfile",
 		},
 	},
-	Action: func(context *cli.Context) {
-		containers.BuildImage(context.String("t"), context.String("f"))
+	Action: func(context *cli.Context) error {
+		dockerFile, err := absPath(context.String("f"))
+		if err != nil {
+			return err
+		}
+		// 当前目录作为构建上下文
+		contextDir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		id, err := newClient().BuildImage(&daemon.BuildRequest{
+			Tag:        context.String("t"),
+			Dockerfile: dockerFile,
+			Context:    contextDir,
+		}, os.Stdout)
+		if err != nil {
+			return err
+		}
+		fmt.Println(id)
+		return nil
 	},
 }
 var NetworkCommand = cli.Command{
@@ -295,20 +907,28 @@ var NetworkCommand = cli.Command{
 				if len(context.Args()) < 1 {
 					return fmt.Errorf("缺少网络名称")
 				}
-				networks.Init()
-				err := networks.CreateNetwork(context.String("driver"), context.String("subnet"), context.Args()[0])
-				if err != nil {
-					return fmt.Errorf("create network error: %+v", err)
-				}
-				return nil
+				return newClient().CreateNetwork(context.Args()[0], context.String("driver"), context.String("subnet"))
 			},
 		},
 		{
 			Name:  "list",
 			Usage: "列出创建的网络",
+			Flags: []cli.Flag{
+				formatFlag,
+			},
 			Action: func(context *cli.Context) error {
-				networks.Init()
-				networks.ListNetwork()
+				list, err := newClient().ListNetworks()
+				if err != nil {
+					return err
+				}
+				if format := context.String("format"); format != "" {
+					var items []interface{}
+					for _, nw := range list {
+						items = append(items, nw)
+					}
+					return printFormat(format, items)
+				}
+				networks.ListNetwork(list)
 				return nil
 			},
 		},
@@ -319,12 +939,7 @@ var NetworkCommand = cli.Command{
 				if len(context.Args()) < 1 {
 					return fmt.Errorf("Missing network name")
 				}
-				networks.Init()
-				err := networks.DeleteNetwork(context.Args()[0])
-				if err != nil {
-					return fmt.Errorf("remove network error: %+v", err)
-				}
-				return nil
+				return newClient().RemoveNetwork(context.Args()[0])
 			},
 		},
 	},
@@ -335,10 +950,14 @@ var PortMappingCommand = cli.Command{
 	Usage: "管理端口映射",
 	Subcommands: []cli.Command{
 		{
-			Name:  "start",
-			Usage: "启动端口映射服务",
+			Name:  "list",
+			Usage: "列出生效的端口映射, 端口映射由 mydocker daemon 负责",
 			Action: func(context *cli.Context) error {
-				networks.StartPortMapping()
+				mapping, err := newClient().ListPortMappings()
+				if err != nil {
+					return err
+				}
+				listPortMapping(mapping)
 				return nil
 			},
 		},
@@ -360,8 +979,7 @@ var PortMappingCommand = cli.Command{
 				portMappings := context.StringSlice("p")
 				// 删除端口映射
 				removePortMappings := context.StringSlice("d")
-				networks.SendPortMapping(portMappings, removePortMappings)
-				return nil
+				return newClient().UpdatePortMappings(portMappings, removePortMappings)
 			},
 		},
 	},
@@ -369,18 +987,409 @@ var PortMappingCommand = cli.Command{
 
 var SaveCommand = cli.Command{
 	Name:  "save",
-	Usage: "保存容器为tar文件",
+	Usage: "保存镜像为 OCI 镜像目录或者 tar 文件 mydocker save -o 文件名 镜像标识..., 指定 -c 时保存容器的文件系统",
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name:  "o",
-			Usage: "保存的文件名,以tar结尾",
+			Usage: "保存的文件名,以tar结尾, 以 / 结尾或者是已经存在的目录时保存为 OCI 镜像目录",
 		},
 		cli.StringFlag{
 			Name:  "c",
 			Usage: "容器标识",
 		},
 	},
-	Action: func(context *cli.Context) {
-		containers.SaveContainer(context.String("c"), context.String("o"))
+	Action: func(context *cli.Context) error {
+		output := context.String("o")
+		if output == "" {
+			return fmt.Errorf("缺少保存的文件名")
+		}
+		output, err := absPath(output)
+		if err != nil {
+			return err
+		}
+		return newClient().SaveImages(&daemon.SaveRequest{
+			Images:    context.Args(),
+			Container: context.String("c"),
+			Output:    output,
+		})
+	},
+}
+
+var LoadCommand = cli.Command{
+	Name:  "load",
+	Usage: "导入 save 保存的镜像，OCI 镜像目录或者 docker save 的归档",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "input, i",
+			Usage: "镜像归档的路径, 不指定时从标准输入读取 tar",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		input := context.String("input")
+		if input == "" {
+			return newClient().LoadImages(&daemon.LoadRequest{}, os.Stdin, os.Stdout)
+		}
+		input, err := absPath(input)
+		if err != nil {
+			return err
+		}
+		return newClient().LoadImages(&daemon.LoadRequest{Input: input}, nil, os.Stdout)
+	},
+}
+
+// 访问仓库的参数
+var registryFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "insecure",
+		Usage: "使用 http 访问仓库",
+	},
+	cli.StringFlag{
+		Name:  "auth-file",
+		Usage: "凭据文件, 格式和 docker login 生成的 ~/.docker/config.json 相同, 默认为 ~/.docker/config.json",
+	},
+}
+
+// 凭据文件的绝对路径，daemon 使用客户端的凭据文件访问仓库
+func authFile(context *cli.Context) (string, error) {
+	if file := context.String("auth-file"); file != "" {
+		return absPath(file)
+	}
+	return registry.DefaultAuthFile(), nil
+}
+
+var PullCommand = cli.Command{
+	Name:  "pull",
+	Usage: "从仓库拉取镜像 mydocker pull [仓库地址/]名称[:版本|@摘要]",
+	Flags: registryFlags,
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("缺少镜像名称")
+		}
+		auth, err := authFile(context)
+		if err != nil {
+			return err
+		}
+		id, err := newClient().PullImage(&daemon.PullRequest{
+			Name:     context.Args()[0],
+			Insecure: context.Bool("insecure"),
+			AuthFile: auth,
+		}, os.Stdout)
+		if err != nil {
+			return err
+		}
+		fmt.Println(id)
+		return nil
+	},
+}
+
+var PushCommand = cli.Command{
+	Name:  "push",
+	Usage: "推送镜像到仓库 mydocker push 镜像标识 [仓库地址/名称:版本]",
+	Flags: append([]cli.Flag{
+		cli.Int64Flag{
+			Name:  "chunk-size",
+			Usage: "分块上传时每个分块的字节数",
+			Value: registry.DefaultChunkSize,
+		},
+	}, registryFlags...),
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("缺少镜像标识")
+		}
+		auth, err := authFile(context)
+		if err != nil {
+			return err
+		}
+		return newClient().PushImage(context.Args()[0], &daemon.PushRequest{
+			Target:    context.Args().Get(1),
+			Insecure:  context.Bool("insecure"),
+			AuthFile:  auth,
+			ChunkSize: context.Int64("chunk-size"),
+		}, os.Stdout)
+	},
+}
+
+var RmiCommand = cli.Command{
+	Name:  "rmi",
+	Usage: "删除镜像 mydocker rmi 镜像标识...",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "f",
+			Usage: "强制删除有多个名称，被容器使用或者是其他镜像的基础镜像的镜像",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("缺少镜像标识")
+		}
+		c := newClient()
+		for _, idOrName := range context.Args() {
+			result, err := c.RemoveImage(idOrName, context.Bool("f"))
+			if err != nil {
+				return err
+			}
+			for _, item := range result {
+				if item.Untagged != "" {
+					fmt.Printf("取消标签: %s\n", item.Untagged)
+				}
+				if item.Deleted != "" {
+					fmt.Printf("删除: %s\n", item.Deleted)
+				}
+			}
+		}
+		return nil
+	},
+}
+
+var TagCommand = cli.Command{
+	Name:  "tag",
+	Usage: "给镜像加上新的名称 mydocker tag 镜像标识 名称[:版本]",
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 2 {
+			return fmt.Errorf("缺少镜像标识和新的名称")
+		}
+		return newClient().TagImage(context.Args()[0], context.Args()[1])
+	},
+}
+
+var HistoryCommand = cli.Command{
+	Name:  "history",
+	Usage: "展示镜像的每个镜像层和创建它的指令",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "no-trunc",
+			Usage: "不截断输出",
+		},
+		formatFlag,
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("缺少镜像标识")
+		}
+		history, err := newClient().ImageHistory(context.Args()[0])
+		if err != nil {
+			return err
+		}
+		if format := context.String("format"); format != "" {
+			var items []interface{}
+			for _, entry := range history {
+				items = append(items, entry)
+			}
+			return printFormat(format, items)
+		}
+		showHistory(history, context.Bool("no-trunc"))
+		return nil
+	},
+}
+
+var ImageCommand = cli.Command{
+	Name:  "image",
+	Usage: "管理镜像",
+	Subcommands: []cli.Command{
+		{
+			Name:  "prune",
+			Usage: "删除没有名称，没有被容器使用，也不是其他镜像的基础镜像的镜像",
+			Action: func(context *cli.Context) error {
+				resp, err := newClient().PruneImages()
+				if err != nil {
+					return err
+				}
+				for _, id := range resp.Deleted {
+					fmt.Printf("删除: %s\n", id)
+				}
+				fmt.Printf("回收空间: %s\n", formatSize(uint64(resp.SpaceReclaimed), false))
+				return nil
+			},
+		},
 	},
 }
+
+// 访问 daemon 的客户端
+// 转换为绝对路径，daemon 的工作目录和客户端不同，保留结尾的 / 表示目录
+func absPath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(p, "/") && !strings.HasSuffix(abs, "/") {
+		abs += "/"
+	}
+	return abs, nil
+}
+
+func newClient() *client.Client {
+	return client.New(daemon.DefaultSocket)
+}
+
+// 以表格的形式输出端口映射
+func listPortMapping(mapping map[int][]string) {
+	var ports []int
+	for port := range mapping {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	fmt.Fprint(w, "PORT\tTARGET\n")
+	for _, port := range ports {
+		fmt.Fprintf(w, "%d\t%s\n", port, strings.Join(mapping[port], ","))
+	}
+	if err := w.Flush(); err != nil {
+		log.Printf("flush 失败 %v\n", err)
+	}
+}
+
+// 以表格的形式输出镜像历史，没有记录镜像的镜像层输出 <missing>
+func showHistory(history []*containers.ImageHistory, noTrunc bool) {
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	fmt.Fprint(w, "IMAGE\tCREATED\tCREATED BY\tSIZE\tCOMMENT\n")
+	for _, entry := range history {
+		id, createdBy := "<missing>", entry.CreatedBy
+		if entry.Id != "" && noTrunc {
+			id = entry.Id
+		} else if entry.Id != "" {
+			id = containers.ShortImageId(entry.Id)
+		}
+		if runes := []rune(createdBy); !noTrunc && len(runes) > 45 {
+			createdBy = string(runes[:44]) + "…"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", id, entry.CreateTime, createdBy, formatSize(uint64(entry.Size), false), entry.Comment)
+	}
+	if err := w.Flush(); err != nil {
+		log.Printf("flush 失败 %v\n", err)
+	}
+}
+
+// top 命令支持的列，key 是 -o 中使用的名称
+var topColumns = map[string]struct {
+	title string
+	value func(p *containers.ProcessInfo) string
+}{
+	"user": {"USER", func(p *containers.ProcessInfo) string { return p.User }},
+	"pid":  {"PID", func(p *containers.ProcessInfo) string { return strconv.Itoa(p.Pid) }},
+	"cpid": {"CPID", func(p *containers.ProcessInfo) string { return strconv.Itoa(p.ContainerPid) }},
+	"ppid": {"PPID", func(p *containers.ProcessInfo) string { return strconv.Itoa(p.Ppid) }},
+	"stat": {"STAT", func(p *containers.ProcessInfo) string { return p.Stat }},
+	"time": {"TIME", func(p *containers.ProcessInfo) string { return formatCpuTime(p.CpuTime) }},
+	"cmd":  {"CMD", func(p *containers.ProcessInfo) string { return p.Command }},
+}
+
+// 解析 top 命令的 ps 参数，目前只支持 -o 指定输出的列
+func parseTopOptions(args []string) ([]string, error) {
+	columns := "user,pid,cpid,ppid,stat,time,cmd"
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-o" && i+1 < len(args):
+			columns = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "-o="):
+			columns = strings.TrimPrefix(args[i], "-o=")
+		default:
+			return nil, fmt.Errorf("不支持的参数: %s, 只支持 -o 指定输出的列", args[i])
+		}
+	}
+	var result []string
+	for _, column := range strings.Split(columns, ",") {
+		column = strings.ToLower(strings.TrimSpace(column))
+		// 兼容 ps 中的名称
+		switch column {
+		case "args", "command":
+			column = "cmd"
+		case "uid":
+			column = "user"
+		}
+		if _, ok := topColumns[column]; !ok {
+			return nil, fmt.Errorf("不支持的列: %s", column)
+		}
+		result = append(result, column)
+	}
+	return result, nil
+}
+
+// 以表格的形式输出容器中的进程
+func listProcesses(processes []*containers.ProcessInfo, columns []string) {
+	w := tabwriter.NewWriter(os.Stdout, 8, 1, 3, ' ', 0)
+	var titles []string
+	for _, column := range columns {
+		titles = append(titles, topColumns[column].title)
+	}
+	fmt.Fprintln(w, strings.Join(titles, "\t"))
+	for _, p := range processes {
+		var values []string
+		for _, column := range columns {
+			values = append(values, topColumns[column].value(p))
+		}
+		fmt.Fprintln(w, strings.Join(values, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		log.Printf("flush 失败 %v\n", err)
+	}
+}
+
+// 和 ps 的 TIME 列相同，格式为 时:分:秒
+func formatCpuTime(d time.Duration) string {
+	seconds := int(d.Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+}
+
+// 将 events 命令中的时间转换为 unix 时间戳，相对时间以命令执行的时间为准，而不是 daemon 收到请求的时间
+func eventTime(value string, now time.Time) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	t, err := containers.ParseEventTime(value, now)
+	if err != nil {
+		return "", err
+	}
+	return containers.FormatUnixTime(t), nil
+}
+
+// 根据 run 的 --health-* 参数生成健康检查的配置，没有设置的字段使用镜像中的配置
+func healthCheckConfig(context *cli.Context) (*containers.HealthConfig, error) {
+	config := &containers.HealthConfig{
+		Interval:    context.Duration("health-interval"),
+		Timeout:     context.Duration("health-timeout"),
+		StartPeriod: context.Duration("health-start-period"),
+		Retries:     context.Int("health-retries"),
+	}
+	if context.Bool("no-healthcheck") {
+		if context.String("health-cmd") != "" {
+			return nil, fmt.Errorf("--no-healthcheck 和 --health-cmd 不能同时使用")
+		}
+		config.Test = []string{"NONE"}
+	} else if cmd := context.String("health-cmd"); cmd != "" {
+		config.Test = []string{"CMD-SHELL", cmd}
+	}
+	return config, nil
+}
+
+// 附加到容器时使用当前进程的标准输入输出，stdin 为 false 时不附加标准输入
+func attachOptions(stdin bool, detachKeys string) *client.AttachOptions {
+	options := &client.AttachOptions{Stdout: os.Stdout, Stderr: os.Stderr, DetachKeys: detachKeys}
+	if stdin {
+		options.Stdin = os.Stdin
+	}
+	return options
+}
+
+// 容器使用终端时设置本地终端，返回恢复本地终端的函数
+func setupContainerTerminal(c *client.Client, idOrName string, options *client.AttachOptions) (func(), error) {
+	info, err := c.InspectContainer(idOrName)
+	if err != nil {
+		return nil, err
+	}
+	if info.Config == nil || !info.Config.Tty {
+		return func() {}, nil
+	}
+	return setupTerminal(options), nil
+}
+
+// attach 结束，容器退出时使用容器的退出码作为命令的退出码
+func attachExit(result *containers.AttachResult, err error) error {
+	if err != nil {
+		return err
+	}
+	if !result.Detached && result.ExitCode != 0 {
+		return cli.NewExitError("", result.ExitCode)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package commandline
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/urfave/cli"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// formatFlag ps, images, network list, inspect, stats, events 命令使用 Go 模板格式化输出
+// stats 和 events 每条记录输出一行，json 表示以 json 格式输出
+var formatFlag = cli.StringFlag{
+	Name:  "format",
+	Usage: "使用 Go 模板格式化输出，例如 '{{.Id}} {{.Name}}'，stats 和 events 中 json 表示以 json 格式输出",
+}
+
+// 模板中可以使用的函数
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		content, err := json.Marshal(v)
+		return string(content), err
+	},
+	"join":  strings.Join,
+	"split": strings.Split,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// 使用模板依次格式化 items，每个输出一行
+func printFormat(format string, items []interface{}) error {
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		return fmt.Errorf("解析模板失败: %v", err)
+	}
+	for _, item := range items {
+		if err := tmpl.Execute(os.Stdout, item); err != nil {
+			return fmt.Errorf("格式化输出失败: %v", err)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// 以缩进的 json 数组格式输出
+func printJSON(items []interface{}) error {
+	content, err := json.MarshalIndent(items, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(content))
+	return nil
+}
@@ -0,0 +1,126 @@
+package commandline
+
+import (
+	"client"
+	"containers"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// stats 命令两次采样的间隔
+const statsInterval = time.Second
+
+// 每隔 statsInterval 采样一次容器的资源使用量，根据和上一次采样的差值计算 cpu 使用率并输出
+// ids 为空时每次采样前重新获取运行中的容器，新启动的容器会出现在结果中，退出的容器不再输出
+func showStats(c *client.Client, ids []string, noStream bool, format string) error {
+	if format == "json" {
+		format = "{{json .}}"
+	}
+	// 第一次采样只用于计算 cpu 使用率，指定的容器不存在或者没有运行时返回错误
+	prev, _, err := sampleStats(c, ids, len(ids) == 0)
+	if err != nil {
+		return err
+	}
+	for {
+		time.Sleep(statsInterval)
+		cur, order, err := sampleStats(c, ids, true)
+		if err != nil {
+			return err
+		}
+		var entries []*containers.StatsEntry
+		for _, id := range order {
+			entries = append(entries, containers.CalculateStats(prev[id], cur[id]))
+		}
+		if format != "" {
+			var items []interface{}
+			for _, entry := range entries {
+				items = append(items, entry)
+			}
+			if err := printFormat(format, items); err != nil {
+				return err
+			}
+		} else {
+			if !noStream {
+				// 清屏并将光标移动到左上角，刷新表格
+				fmt.Print("\033[2J\033[H")
+			}
+			listStats(entries)
+		}
+		if noStream {
+			return nil
+		}
+		prev = cur
+	}
+}
+
+// 采样容器的资源使用量，返回容器 id 到采样结果的映射，以及容器 id 的输出顺序
+// ignoreErrors 为 true 时跳过采样失败的容器，例如容器在两次采样之间退出
+func sampleStats(c *client.Client, ids []string, ignoreErrors bool) (map[string]*containers.ContainerStats, []string, error) {
+	if len(ids) == 0 {
+		list, err := c.ListContainers(false, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, info := range list {
+			ids = append(ids, info.Id)
+		}
+	}
+	result := map[string]*containers.ContainerStats{}
+	var order []string
+	for _, id := range ids {
+		stats, err := c.Stats(id)
+		if err != nil {
+			if ignoreErrors {
+				continue
+			}
+			return nil, nil, err
+		}
+		if _, ok := result[stats.Id]; !ok {
+			order = append(order, stats.Id)
+		}
+		result[stats.Id] = stats
+	}
+	return result, order, nil
+}
+
+// 以表格的形式输出容器的资源使用情况
+func listStats(entries []*containers.StatsEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	fmt.Fprint(w, "CONTAINER ID\tNAME\tCPU %\tMEM USAGE / LIMIT\tMEM %\tNET I/O\tBLOCK I/O\tPIDS\n")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%.2f%%\t%s / %s\t%.2f%%\t%s / %s\t%s / %s\t%d\n",
+			e.Id,
+			e.Name,
+			e.CpuPercent,
+			formatSize(e.MemoryUsage, true), formatSize(e.MemoryLimit, true),
+			e.MemoryPercent,
+			formatSize(e.NetworkRx, false), formatSize(e.NetworkTx, false),
+			formatSize(e.BlockRead, false), formatSize(e.BlockWrite, false),
+			e.Pids)
+	}
+	if err := w.Flush(); err != nil {
+		log.Printf("flush 失败 %v\n", err)
+	}
+}
+
+// 格式化字节数，binary 为 true 时使用 1024 进制，例如内存 1.5MiB，否则使用 1000 进制，例如网络流量 1.5MB
+func formatSize(size uint64, binary bool) string {
+	base, units := 1000.0, []string{"B", "kB", "MB", "GB", "TB", "PB"}
+	if binary {
+		base, units = 1024.0, []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	}
+	value := float64(size)
+	i := 0
+	for value >= base && i < len(units)-1 {
+		value /= base
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d%s", size, units[0])
+	}
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", value), "0"), ".") + units[i]
+}
@@ -0,0 +1,75 @@
+package commandline
+
+import (
+	"client"
+	"containers"
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// 附加到使用终端的容器时调用，附加标准输入并且本地的标准输入是终端时把它设置为 raw 模式，
+// 按键原样发送给容器，由容器的终端处理回显，ctrl-c 等信号以及分离按键
+// 本地的标准输出是终端时把窗口大小发送给容器，并在收到 SIGWINCH 时重新发送，返回恢复本地终端的函数
+func setupTerminal(options *client.AttachOptions) func() {
+	restore := func() {}
+	if options.Stdin != nil {
+		if state, err := makeRaw(os.Stdin.Fd()); err == nil {
+			restore = func() {
+				_ = setTermios(os.Stdin.Fd(), state)
+			}
+		}
+	}
+	size, err := containers.GetWindowSize(os.Stdout)
+	if err != nil {
+		return restore
+	}
+	resize := make(chan *containers.WindowSize, 1)
+	resize <- size
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGWINCH)
+	go func() {
+		for range signals {
+			if size, err := containers.GetWindowSize(os.Stdout); err == nil {
+				resize <- size
+			}
+		}
+	}()
+	options.Resize = resize
+	return func() {
+		signal.Stop(signals)
+		restore()
+	}
+}
+
+// 把终端设置为 raw 模式，和 cfmakeraw 相同，返回原来的设置
+func makeRaw(fd uintptr) (*syscall.Termios, error) {
+	var state syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, uintptr(unsafe.Pointer(&state))); err != nil {
+		return nil, err
+	}
+	raw := state
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := setTermios(fd, &raw); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func setTermios(fd uintptr, state *syscall.Termios) error {
+	return ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(state)))
+}
+
+func ioctl(fd uintptr, request uintptr, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
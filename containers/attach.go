@@ -0,0 +1,154 @@
+package containers
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// AttachSocketName 容器的 shim 进程监听的 unix socket，attach 通过它连接容器的标准输入输出
+const AttachSocketName = "attach.sock"
+
+// DefaultDetachKeys 默认的分离按键，按下后断开 attach，容器继续运行
+const DefaultDetachKeys = "ctrl-p,ctrl-q"
+
+// attach 连接中的数据帧类型
+const (
+	// 客户端发送的容器的标准输入
+	AttachStdin  = 0
+	AttachStdout = 1
+	AttachStderr = 2
+	// attach 结束，数据是 json 格式的 AttachResult
+	AttachEnd = 3
+	// 客户端发送的终端窗口大小，数据是 json 格式的 WindowSize，容器使用终端时调整终端的大小
+	AttachResize = 4
+)
+
+// AttachRequest 连接到 shim 后发送的第一行，之后客户端发送 AttachStdin 和 AttachResize 帧
+type AttachRequest struct {
+	// 是否附加容器的标准输入，容器需要使用 -i 启动
+	Stdin bool `json:"stdin"`
+	// 分离按键，为空时使用 DefaultDetachKeys
+	DetachKeys string `json:"detachKeys"`
+}
+
+// AttachResult attach 结束的原因
+type AttachResult struct {
+	// 容器id
+	Id string `json:"id"`
+	// 为 true 表示按下了分离按键，容器继续运行，否则容器已经退出
+	Detached bool `json:"detached"`
+	// 容器的退出码
+	ExitCode int `json:"exitCode"`
+	// 失败时的错误信息
+	Message string `json:"message,omitempty"`
+}
+
+// AttachSocket 容器的 attach socket 路径
+func AttachSocket(containerId string) string {
+	return fmt.Sprintf(ContainerInfoLocation, containerId) + AttachSocketName
+}
+
+// DialAttach 连接容器的 shim 进程并发送 attach 请求，返回的连接中读写 WriteFrame 格式的数据帧
+func DialAttach(containerId string, request *AttachRequest) (net.Conn, error) {
+	conn, err := net.Dial("unix", AttachSocket(containerId))
+	if err != nil {
+		return nil, fmt.Errorf("连接容器 %s 的 shim 进程失败: %v", containerId, err)
+	}
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("发送 attach 请求失败: %v", err)
+	}
+	return conn, nil
+}
+
+// WriteFrame 写入一帧数据，和 docker 的 stdcopy 格式相同
+// 8 个字节的头部，第一个字节是帧的类型，最后 4 个字节是大端序的数据长度，之后是数据
+func WriteFrame(w io.Writer, stream byte, data []byte) error {
+	frame := make([]byte, 8+len(data))
+	frame[0] = stream
+	binary.BigEndian.PutUint32(frame[4:8], uint32(len(data)))
+	copy(frame[8:], data)
+	_, err := w.Write(frame)
+	return err
+}
+
+// ReadFrame 读取 WriteFrame 写入的一帧数据
+func ReadFrame(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(header[4:8]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	return header[0], data, nil
+}
+
+// DetachKeysMatcher 在标准输入中查找分离按键
+type DetachKeysMatcher struct {
+	keys []byte
+	// 已经匹配的按键数量
+	matched int
+}
+
+// NewDetachKeysMatcher 创建分离按键的匹配器，keys 为 ParseDetachKeys 的结果
+func NewDetachKeysMatcher(keys []byte) *DetachKeysMatcher {
+	return &DetachKeysMatcher{keys: keys}
+}
+
+// Feed 处理一段输入，返回需要写入容器的数据以及是否读取到了完整的分离按键
+// 部分匹配分离按键的输入先不返回，后续的输入不匹配时再一起返回
+func (m *DetachKeysMatcher) Feed(data []byte) ([]byte, bool) {
+	var out []byte
+	for _, b := range data {
+		if b == m.keys[m.matched] {
+			m.matched++
+			if m.matched == len(m.keys) {
+				m.matched = 0
+				return out, true
+			}
+			continue
+		}
+		out = append(out, m.keys[:m.matched]...)
+		m.matched = 0
+		if b == m.keys[0] {
+			m.matched = 1
+			continue
+		}
+		out = append(out, b)
+	}
+	return out, false
+}
+
+// ParseDetachKeys 解析分离按键，多个按键用逗号分隔，ctrl-x 表示 ctrl 加上一个字母或者 @ [ \ ] ^ _ 中的一个，
+// 其他按键是单个字符，例如 ctrl-p,ctrl-q 或者 ctrl-x,q，为空时使用 DefaultDetachKeys
+func ParseDetachKeys(keys string) ([]byte, error) {
+	if keys == "" {
+		keys = DefaultDetachKeys
+	}
+	var result []byte
+	for _, key := range strings.Split(keys, ",") {
+		if len(key) == 1 {
+			result = append(result, key[0])
+			continue
+		}
+		if !strings.HasPrefix(key, "ctrl-") || len(key) != len("ctrl-")+1 {
+			return nil, fmt.Errorf("分离按键格式错误: %s, 格式为 ctrl-x 或者单个字符，多个按键用逗号分隔", key)
+		}
+		c := key[len(key)-1]
+		switch {
+		case c >= 'a' && c <= 'z':
+			result = append(result, c-'a'+1)
+		case c >= '@' && c <= '_':
+			result = append(result, c-'@')
+		default:
+			return nil, fmt.Errorf("分离按键格式错误: %s, ctrl- 之后只能是字母或者 @ [ \\ ] ^ _", key)
+		}
+	}
+	return result, nil
+}
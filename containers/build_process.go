@@ -2,18 +2,18 @@ package containers
 
 import (
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"os/exec"
 	"path"
 	"syscall"
 )
 
-func BuildFrom(image string) *ContainerInfo {
-	imageId := resolveImageId(image)
-	if imageId == "" {
-		fmt.Printf("镜像不存在:%s \n", image)
-		return nil
+// BuildFrom 使用基础镜像创建构建过程中使用的容器，输出写到 out
+func BuildFrom(image string, out io.Writer) (*ContainerInfo, error) {
+	imageId, err := FindImageId(image)
+	if err != nil {
+		return nil, err
 	}
 	// 空命令
 	command := &CommandArray{
@@ -27,43 +27,47 @@ func BuildFrom(image string) *ContainerInfo {
 	info := &ContainerInfo{
 		Id:     containerId,
 		Status: Stop,
+		Image:  imageId,
 	}
 	// 获取容器基础目录
 	info.BaseUrl = fmt.Sprintf(ContainerInfoLocation, info.Id)
-	parent, writePipe := NewParentProcess(info, false, []string{}, []string{}, imageId)
+	parent, writePipe := NewParentProcess(info, nil, []string{}, []string{}, imageId)
 	if parent == nil {
-		log.Println("启动父进程失败")
-		return nil
+		return nil, fmt.Errorf("启动父进程失败")
 	}
 	//初始化镜像构建使用的域名解析文件
 	CopyFile("/etc/resolv.conf", path.Join(parent.Dir, "/etc/resolv.conf"))
-	parent.Stdout = os.Stdout
-	parent.Stderr = os.Stderr
+	parent.Stdout = out
+	parent.Stderr = out
 	if err := parent.Start(); err != nil {
-		fmt.Printf("启动父进程失败:%v\n", err)
+		return nil, fmt.Errorf("启动父进程失败:%v", err)
 	}
 	RecordContainerInfo(info, parent.Process.Pid)
 	// 将命令写到管道里面
 	SendInitCommand(command, writePipe)
-	return info
+	// 没有输入的 sh 立即退出，等待它退出，daemon 中构建时不留下僵尸进程
+	_ = parent.Wait()
+	return info, nil
 }
-func BuildRun(d *DockerFile, command *CommandArray) {
+
+// BuildRun 在构建容器中执行 RUN 指令，输出写到 d.out
+func BuildRun(d *DockerFile, command *CommandArray) error {
 	command.Host = true
-	parent, writePipe := RunParentProcess(d.Info, d.Env, d.WorkDir)
+	parent, writePipe := RunParentProcess(d.Info, d.runEnv(), d.WorkDir, d.out)
 	if parent == nil {
-		log.Println("New run parent process error")
-		return
+		return fmt.Errorf("New run parent process error")
 	}
 	if err := parent.Start(); err != nil {
-		fmt.Errorf("启动父进程失败:%v\n", err)
+		return fmt.Errorf("启动父进程失败:%v", err)
 	}
 	RecordContainerInfo(d.Info, parent.Process.Pid)
 	// 将命令写到管道里面
 	SendInitCommand(command, writePipe)
 	// 存在有多个Run的情况，需要等待上一个执行完毕
-	parent.Wait()
+	_ = parent.Wait()
+	return nil
 }
-func RunParentProcess(info *ContainerInfo, env []string, workDir string) (*exec.Cmd, *os.File) {
+func RunParentProcess(info *ContainerInfo, env []string, workDir string, out io.Writer) (*exec.Cmd, *os.File) {
 	readPipe, writePipe, err := NewPipe()
 	if err != nil {
 		_ = fmt.Errorf("new pipe error %v", err)
@@ -77,25 +81,11 @@ func RunParentProcess(info *ContainerInfo, env []string, workDir string) (*exec.
 	// 用于读取 管道中的命令
 	cmd.ExtraFiles = []*os.File{readPipe}
 	//获取构建过程中的输出
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = out
+	cmd.Stderr = out
 	// 设置环境变量
 	cmd.Env = append(os.Environ(), env...)
 	//这个目录是容器的root目录，不拼接 workdir
 	cmd.Dir = path.Join(info.BaseUrl, "merged")
 	return cmd, writePipe
 }
-
-func resolveImageId(from string) string {
-	infoList := GetImageInfoList()
-	for _, info := range infoList {
-		imageName := info.Name
-		if info.Version != "" {
-			imageName += ":" + info.Version
-		}
-		if imageName == from {
-			return info.Id
-		}
-	}
-	return ""
-}
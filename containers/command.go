@@ -5,23 +5,43 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"strings"
 )
 
 // RunContainerConfig run命令启动容器时的配置
 type RunContainerConfig struct {
-	Detach        bool
-	Tty           bool
-	CmdArray      []string
-	Volumes       []string
-	ContainerName string
-	Env           []string
-	Image         string
-	PortMapping   []string
-	Net           string
-	Resolv        string
-	Res           *cgroups.ResourceConfig
+	Detach        bool                    `json:"detach"`
+	Tty           bool                    `json:"tty"`
+	CmdArray      []string                `json:"cmdArray"`
+	Volumes       []string                `json:"volumes"`
+	ContainerName string                  `json:"containerName"`
+	Env           []string                `json:"env"`
+	Image         string                  `json:"image"`
+	PortMapping   []string                `json:"portMapping"`
+	Net           string                  `json:"net"`
+	Resolv        string                  `json:"resolv"`
+	Res           *cgroups.ResourceConfig `json:"res"`
+	// 重启策略 no, on-failure[:N], always, unless-stopped
+	Restart string `json:"restart"`
+	// 停止容器时发送的信号，为空时使用镜像中的 STOPSIGNAL
+	StopSignal string `json:"stopSignal"`
+	// 容器的标签，格式为 key=value
+	Labels []string `json:"labels"`
+	// 健康检查的配置，覆盖镜像中的 HEALTHCHECK，Test 为 ["NONE"] 时禁用健康检查
+	HealthCheck *HealthConfig `json:"healthCheck"`
+	// 保持容器的标准输入打开，attach 时可以附加标准输入
+	OpenStdin bool `json:"openStdin"`
+	// 日志驱动 json-file, local, none，为空时使用 json-file
+	LogDriver string `json:"logDriver"`
+	// 日志驱动的参数，格式为 key=value
+	LogOpts []string `json:"logOpts"`
+}
+
+// Interactive 是否前台交互式启动，使用 -i 或者 -t 并且没有使用 -d，客户端附加到容器的标准输入输出直到容器退出
+func (c *RunContainerConfig) Interactive() bool {
+	return !c.Detach && (c.Tty || c.OpenStdin)
 }
 
 type CommandArray struct {
@@ -64,7 +84,7 @@ func LoadCommand(array *CommandArray, file *os.File) *CommandArray {
 func ResolveCmd(cmdArray []string, imageId string, tty bool) *CommandArray {
 	info, err := GetImageInfo(imageId)
 	if err != nil {
-		fmt.Errorf("获取镜像失败: %s, 原因: %v", cmdArray, err)
+		log.Printf("获取镜像失败: %s, 原因: %v\n", cmdArray, err)
 	}
 	result := CommandArray{}
 	result.WorkDir = info.WorkDir
@@ -96,8 +116,11 @@ func ResolveCmd(cmdArray []string, imageId string, tty bool) *CommandArray {
 			// cmd 和 用户输入的指令都是作为参数处理
 			if (len(cmdArray)) != 0 {
 				result.Cmds = append(result.Cmds, strings.Join(cmdArray, " "))
+			} else if info.CMDShellType {
+				result.Cmds = append(result.Cmds, "sh", "-c", strings.Join(info.CMD, " "))
 			} else {
-				result.Cmds = append(result.Cmds, strings.Join(info.CMD, " "))
+				// exec 格式的 CMD 每个元素都是 ENTRYPOINT 的一个参数，和 docker 一致
+				result.Cmds = append(result.Cmds, info.CMD...)
 			}
 		}
 
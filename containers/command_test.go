@@ -0,0 +1,39 @@
+package containers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveCmd(t *testing.T) {
+	useTempImageStore(t)
+	tests := []struct {
+		name       string
+		entryPoint []string
+		entryShell bool
+		cmd        []string
+		cmdShell   bool
+		args       []string
+		want       []string
+	}{
+		{"exec 格式 CMD", nil, false, []string{"nginx", "-g", "daemon off;"}, false, nil, []string{"nginx", "-g", "daemon off;"}},
+		{"shell 格式 CMD", nil, false, []string{"echo $HOME"}, true, nil, []string{"sh", "-c", "echo $HOME"}},
+		{"ENTRYPOINT 加 exec 格式 CMD", []string{"/entrypoint.sh"}, false, []string{"nginx", "-g", "daemon off;"}, false, nil, []string{"/entrypoint.sh", "nginx", "-g", "daemon off;"}},
+		{"ENTRYPOINT 加 shell 格式 CMD", []string{"/entrypoint.sh"}, false, []string{"echo $HOME"}, true, nil, []string{"/entrypoint.sh", "sh", "-c", "echo $HOME"}},
+		{"ENTRYPOINT 加用户命令", []string{"sh", "-c"}, false, []string{"echo I am base image"}, false, []string{"sleep", "1000"}, []string{"sh", "-c", "sleep 1000"}},
+		{"shell 格式 ENTRYPOINT", []string{"exec top"}, true, []string{"-b"}, false, []string{"sleep"}, []string{"sh", "-c", "exec top"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := initImageInfo("cmd:test")
+			info.EntryPoint, info.EntryPointShellType = tt.entryPoint, tt.entryShell
+			info.CMD, info.CMDShellType = tt.cmd, tt.cmdShell
+			if err := createImage(info); err != nil {
+				t.Fatal(err)
+			}
+			if got := ResolveCmd(tt.args, info.Id, false).Cmds; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("命令为 %q, 期望 %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package containers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ContainerFilter 过滤容器的条件，key 为 status, name, image, label, health
+// 相同 key 的多个值满足一个即可，不同 key 的条件需要同时满足
+type ContainerFilter map[string][]string
+
+// ParseContainerFilter 解析 key=value 格式的过滤条件
+func ParseContainerFilter(filters []string) (ContainerFilter, error) {
+	filter := ContainerFilter{}
+	for _, f := range filters {
+		parts := strings.SplitN(f, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("过滤条件格式错误: %s, 格式为 key=value", f)
+		}
+		switch parts[0] {
+		case "status", "name", "image", "label", "health":
+		default:
+			return nil, fmt.Errorf("不支持的过滤条件: %s, 支持 status, name, image, label, health", parts[0])
+		}
+		value := parts[1]
+		// 镜像可以使用名称或者id，容器中记录的是镜像id
+		if parts[0] == "image" {
+			if imageId := ResolveImageId(value, false); imageId != "" {
+				value = imageId
+			}
+		}
+		filter[parts[0]] = append(filter[parts[0]], value)
+	}
+	return filter, nil
+}
+
+// Match 容器是否满足过滤条件
+func (f ContainerFilter) Match(info *ContainerInfo) bool {
+	for key, values := range f {
+		matched := false
+		for _, value := range values {
+			if f.matchOne(key, value, info) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func (f ContainerFilter) matchOne(key string, value string, info *ContainerInfo) bool {
+	switch key {
+	case "status":
+		return info.Status == value
+	case "name":
+		return strings.Contains(info.Name, value)
+	case "image":
+		return info.Image == value
+	case "health":
+		// health=none 匹配没有健康检查的容器
+		if info.Health == nil || !info.IsRunning() {
+			return value == "none"
+		}
+		return info.Health.Status == value
+	case "label":
+		// label=key 匹配有这个标签的容器，label=key=value 匹配标签的值
+		for _, label := range info.Labels {
+			if label == value || strings.SplitN(label, "=", 2)[0] == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FilterContainers 过滤容器，all 为 false 并且没有指定 status 条件时只返回运行中的容器
+func FilterContainers(list []*ContainerInfo, all bool, filter ContainerFilter) []*ContainerInfo {
+	if _, ok := filter["status"]; ok {
+		all = true
+	}
+	result := []*ContainerInfo{}
+	for _, info := range list {
+		if !all && !info.IsRunning() {
+			continue
+		}
+		if filter.Match(info) {
+			result = append(result, info)
+		}
+	}
+	return result
+}
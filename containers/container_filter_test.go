@@ -0,0 +1,57 @@
+package containers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterContainers(t *testing.T) {
+	useTempImageStore(t)
+	list := []*ContainerInfo{
+		{Id: "1", Name: "web-1", Image: "img-a", Status: Running, Labels: []string{"env=prod", "tier"}},
+		{Id: "2", Name: "web-2", Image: "img-b", Status: Exit, Labels: []string{"env=dev"}},
+		{Id: "3", Name: "db", Image: "img-a", Status: Paused},
+		{Id: "4", Name: "job", Image: "img-b", Status: Created, Labels: []string{"env=prod"}},
+	}
+	tests := []struct {
+		name    string
+		all     bool
+		filters []string
+		want    []string
+	}{
+		{"默认只有运行中的容器", false, nil, []string{"1", "3"}},
+		{"all", true, nil, []string{"1", "2", "3", "4"}},
+		{"status 包含停止的容器", false, []string{"status=exited"}, []string{"2"}},
+		{"相同 key 满足一个", false, []string{"status=exited", "status=created"}, []string{"2", "4"}},
+		{"name 部分匹配", true, []string{"name=web"}, []string{"1", "2"}},
+		{"image", true, []string{"image=img-a"}, []string{"1", "3"}},
+		{"label 只有名称", true, []string{"label=tier"}, []string{"1"}},
+		{"label 名称", true, []string{"label=env"}, []string{"1", "2", "4"}},
+		{"label 名称和值", true, []string{"label=env=prod"}, []string{"1", "4"}},
+		{"不同 key 同时满足", true, []string{"label=env=prod", "name=web"}, []string{"1"}},
+		{"没有满足条件的容器", true, []string{"name=cache"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseContainerFilter(tt.filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []string{}
+			for _, info := range FilterContainers(list, tt.all, filter) {
+				ids = append(ids, info.Id)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("过滤结果为 %v, 期望 %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseContainerFilterError(t *testing.T) {
+	for _, f := range []string{"status", "status=", "=running", "id=1"} {
+		if _, err := ParseContainerFilter([]string{f}); err == nil {
+			t.Errorf("过滤条件 %q 应该返回错误", f)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package containers
 
+import "logger"
+
 type ContainerInfo struct {
 	Pid         string       `json:"pid"`         //容器的init进程在宿主机上的进程id
 	Id          string       `json:"id"`          //容器id
@@ -12,7 +14,41 @@ type ContainerInfo struct {
 	BaseUrl     string       `json:"baseUrl"`     // 容器的文件系统目录
 	SetCgroup   bool         `json:"setCgroup"`   //有无创建cgroup
 	PortMapping []string     `json:"portMapping"` // 端口映射
-	net         string       `json:"net"`         // 端口
+	Net         string       `json:"net"`         // 容器所属的网络
+	IpAddress   string       `json:"ipAddress"`   // 容器在网络中分配的ip地址
+	ShimPid     string       `json:"shimPid"`     // 容器的 shim 进程在宿主机上的进程id
+	ExitCode    int          `json:"exitCode"`    // 容器 init 进程的退出码
+	FinishedAt  string       `json:"finishedAt"`  // 容器退出的时间
+	OOMKilled   bool         `json:"oomKilled"`   // 容器是否因为内存不足被杀死
+	// 容器退出后的重启策略
+	RestartPolicy *RestartPolicy `json:"restartPolicy"`
+	// 根据重启策略自动重启的次数，手动启动时清零
+	RestartCount int `json:"restartCount"`
+	// 停止容器时发送的信号
+	StopSignal string `json:"stopSignal"`
+	// 容器是否被手动停止，容器退出时状态记录为 stoped，重启策略不会重新启动手动停止的容器
+	ManuallyStopped bool `json:"manuallyStopped"`
+	// init 进程的启动时间和 pid namespace，shim 进程的启动时间，用来判断进程是否还存在，避免 pid 被复用时误判
+	PidStartTime  string `json:"pidStartTime"`
+	PidNamespace  string `json:"pidNamespace"`
+	ShimStartTime string `json:"shimStartTime"`
+	// 容器的标签，格式为 key=value，包括镜像的标签
+	Labels []string `json:"labels"`
+	// 健康检查的配置，镜像的 HEALTHCHECK 和 run 的 --health-* 参数合并后的结果，没有健康检查时为空
+	HealthCheck *HealthConfig `json:"healthCheck"`
+	// 容器的健康状态，每次启动时重置为 starting
+	Health *Health `json:"health"`
+	// 容器的日志配置，为空时使用 json-file 驱动
+	LogConfig *logger.Config `json:"logConfig"`
+	// 创建容器时的配置，启动容器时使用
+	Config *RunContainerConfig `json:"config"`
+	// 容器内init进程执行的命令
+	CommandArray *CommandArray `json:"commandArray"`
+}
+
+// IsRunning 容器进程是否存在，暂停的容器进程被冻结，也是运行中
+func (info *ContainerInfo) IsRunning() bool {
+	return info.Status == Running || info.Status == Paused
 }
 
 type VolumeInfo struct {
@@ -25,7 +61,9 @@ type VolumeInfo struct {
 // 定义目录相关的常量，存放信息
 
 var (
+	Created = "created"
 	Running = "running"
+	Paused  = "paused"
 	Stop    = "stoped"
 	Exit    = "exited"
 	// ContainerInfoLocation %s 是容器的标识
@@ -34,6 +72,7 @@ var (
 	AllVolumeLocation     = "/var/run/mydocker/volumes/"
 	VolumeInfoLocation    = "/var/run/mydocker/volumes/%s/"
 	ContainerConfigName   = "config.json"
-	ContainerLogName      = "container.log"
+	ContainerLogName      = logger.JSONFileName
+	ContainerLockName     = "config.lock"
 	ResolveFile           = "/etc/resolv.conf"
 )
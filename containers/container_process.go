@@ -17,33 +17,53 @@ import (
 
 // NewParentProcess 创建一个父进程， 父进程的目的是
 // 真正的执行cmd，并用cmd 对应的进程替换自身
-func NewParentProcess(info *ContainerInfo, tty bool, volumes []string, env []string, imageId string) (*exec.Cmd, *os.File) {
+// stdio 依次为标准输入，标准输出，标准错误，为空时进程的输出重定向到容器的日志文件
+func NewParentProcess(info *ContainerInfo, stdio []*os.File, volumes []string, env []string, imageId string) (*exec.Cmd, *os.File) {
 	readPipe, writePipe, err := NewPipe()
 	if err != nil {
 		log.Printf("创建管道失败%v", err)
 		return nil, nil
 	}
+	cmd, err := NewInitProcess(info, readPipe, stdio, env)
+	if err != nil {
+		log.Println(err)
+		return nil, nil
+	}
+	// 工作目录，为 overlay文件系统中的 merge目录 ,容器进程，会以merged目录作为根目录运行
+	cmd.Dir = NewWorkSpace(info, volumes, imageId)
+	return cmd, writePipe
+}
+
+// NewInitProcess 创建容器的 init 进程，init 进程从 readPipe 中读取要执行的命令，
+// 以容器的 merged 目录作为根目录运行，调用前需要先挂载容器的工作空间
+// stdio 依次为标准输入，标准输出，标准错误，其中为 nil 的使用 /dev/null，stdio 为空时进程的输出追加到容器的日志文件
+func NewInitProcess(info *ContainerInfo, readPipe *os.File, stdio []*os.File, env []string) (*exec.Cmd, error) {
 	// 调用mydocker的 init命令， 执行command
 	cmd := exec.Command("/proc/self/exe", "init")
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWIPC | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWNET,
 	}
 	// 附加输入输出
-	if tty {
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+	if len(stdio) == 3 {
+		if stdio[0] != nil {
+			cmd.Stdin = stdio[0]
+		}
+		if stdio[1] != nil {
+			cmd.Stdout = stdio[1]
+		}
+		if stdio[2] != nil {
+			cmd.Stderr = stdio[2]
+		}
 	} else {
 		// 生产容器对应目录的container.log文件
 		if err := os.MkdirAll(info.BaseUrl, 0622); err != nil {
-			log.Printf("创建目录 %s 失败 %v", info.BaseUrl, err)
-			return nil, nil
+			return nil, fmt.Errorf("创建目录 %s 失败 %v", info.BaseUrl, err)
 		}
 		logFilePath := info.BaseUrl + ContainerLogName
-		logFile, err := os.Create(logFilePath)
+		// 容器重新启动时保留之前的日志
+		logFile, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 		if err != nil {
-			log.Printf("创建日志文件 %s 失败 %v", logFilePath, err)
-			return nil, nil
+			return nil, fmt.Errorf("创建日志文件 %s 失败 %v", logFilePath, err)
 		}
 		// 将进程的输出重定向到logFile中，访问这个文件，就能读取到日志
 		cmd.Stdout = logFile
@@ -52,9 +72,32 @@ func NewParentProcess(info *ContainerInfo, tty bool, volumes []string, env []str
 	cmd.ExtraFiles = []*os.File{readPipe}
 	// 设置环境变量
 	cmd.Env = append(os.Environ(), env...)
-	// 工作目录，为 overlay文件系统中的 merge目录 ,容器进程，会以merged目录作为根目录运行
-	cmd.Dir = NewWorkSpace(info, volumes, imageId)
-	return cmd, writePipe
+	cmd.Dir = path.Join(info.BaseUrl, MERGED)
+	return cmd, nil
+}
+
+// NewShimProcess 创建容器的 shim 进程，shim 进程负责启动容器的 init 进程并等待它退出，
+// 持有容器的标准输入输出，把输出写到日志文件以及 attach 的客户端
+// readPipe 交给 init 进程读取命令，syncPipe 用于 shim 返回 init 进程的 pid
+func NewShimProcess(info *ContainerInfo, readPipe *os.File, syncPipe *os.File) *exec.Cmd {
+	cmd := exec.Command("/proc/self/exe", "shim", info.Id)
+	// 使用新的会话，不会收到客户端终端的信号，daemon 退出后也继续运行
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid: true,
+	}
+	// shim 自身的日志输出到 daemon 的标准错误
+	cmd.Stderr = os.Stderr
+	// 文件描述符依次为 3: syncPipe 4: readPipe
+	cmd.ExtraFiles = []*os.File{syncPipe, readPipe}
+	return cmd
+}
+
+// ShimResult shim 启动 init 进程的结果
+type ShimResult struct {
+	// init 进程在宿主机上的 pid
+	Pid int `json:"pid"`
+	// 启动失败的原因
+	Message string `json:"message"`
 }
 
 // NewPipe 创建管道对象
@@ -68,11 +111,18 @@ func NewPipe() (*os.File, *os.File, error) {
 
 // RecordContainerInfo 记录容器信息
 func RecordContainerInfo(info *ContainerInfo, pid int) {
-	//获取容器创建时间
-	info.CreateTime = time.Now().Format("2006-01-02 15:04:05")
+	//获取容器创建时间, 先创建后启动的容器保留创建时的时间
+	if info.CreateTime == "" {
+		info.CreateTime = time.Now().Format("2006-01-02 15:04:05")
+	}
 	info.Pid = strconv.Itoa(pid)
 	recordContainerInfo(info)
 }
+
+// SaveContainerInfo 保存容器信息，不修改容器的pid和创建时间
+func SaveContainerInfo(info *ContainerInfo) {
+	recordContainerInfo(info)
+}
 func recordContainerInfo(info *ContainerInfo) {
 	// 序列化为字符串
 	jsonBytes, err := json.Marshal(info)
@@ -88,20 +138,38 @@ func recordContainerInfo(info *ContainerInfo) {
 		log.Printf("创建路径%s 失败: %v", dirUrl, err)
 	}
 	fileName := dirUrl + ContainerConfigName
-	//删除旧的文件，如果存在的话
-	_ = os.Remove(fileName)
-	// 创建文件
-	file, err := os.Create(fileName)
-	defer file.Close()
-	if err != nil {
-		log.Printf("创建文件失败%s 失败: %v", fileName, err)
+	// 先写入临时文件再重命名，避免其他进程读取到写了一半的文件
+	tmpFileName := fileName + ".tmp"
+	if err := os.WriteFile(tmpFileName, []byte(jsonStr), 0644); err != nil {
+		log.Printf("写入容器信息失败: %v", err)
 		return
 	}
-	if _, err := file.WriteString(jsonStr); err != nil {
+	if err := os.Rename(tmpFileName, fileName); err != nil {
 		log.Printf("写入容器信息失败: %v", err)
 	}
 }
 
+// UpdateContainerInfo 加锁读取并修改容器信息
+// daemon 和容器的 shim 进程可能同时修改同一个容器的信息，例如 stop 和 容器退出，需要加文件锁避免覆盖对方的修改
+func UpdateContainerInfo(containerId string, update func(info *ContainerInfo)) (*ContainerInfo, error) {
+	lockFile, err := os.OpenFile(fmt.Sprintf(ContainerInfoLocation, containerId)+ContainerLockName, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开容器锁文件失败: %v", err)
+	}
+	defer lockFile.Close()
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		return nil, fmt.Errorf("锁定容器信息失败: %v", err)
+	}
+	defer syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+	info, err := readContainerInfo(containerId)
+	if err != nil {
+		return nil, err
+	}
+	update(info)
+	recordContainerInfo(info)
+	return info, nil
+}
+
 // DeleteContainerInfo 删除容器信息
 func DeleteContainerInfo(info *ContainerInfo) {
 	if err := os.RemoveAll(info.BaseUrl); err != nil {
@@ -114,18 +182,25 @@ func DeleteContainerInfo(info *ContainerInfo) {
 	}
 }
 
-func ListContainerInfo() {
-	// 记录所有容器的对象
-	containers := getAllContainerInfo()
+// ListContainerInfo 以表格的形式输出容器信息
+func ListContainerInfo(containers []*ContainerInfo) {
 	// 格式化并输出
 	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
-	_, _ = fmt.Fprint(w, "ID\tNAME\tPID\tSTATUS\tCOMMAND\tCREATED\n")
+	_, _ = fmt.Fprint(w, "ID\tNAME\tPID\tSTATUS\tRESTARTS\tCOMMAND\tCREATED\n")
 	for _, item := range containers {
-		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+		status := item.Status
+		if status == Exit {
+			status = fmt.Sprintf("%s (%d)", status, item.ExitCode)
+		}
+		if item.IsRunning() && item.Health != nil {
+			status = fmt.Sprintf("%s (%s)", status, item.Health.Status)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
 			item.Id,
 			item.Name,
 			item.Pid,
-			item.Status,
+			status,
+			item.RestartCount,
 			item.Command,
 			item.CreateTime)
 	}
@@ -134,7 +209,9 @@ func ListContainerInfo() {
 		return
 	}
 }
-func getAllContainerInfo() []*ContainerInfo {
+
+// GetContainerInfoList 获取所有的容器信息
+func GetContainerInfoList() []*ContainerInfo {
 	// 返回所有容器的目录
 	containerDirs, err := os.ReadDir(AllContainerLocation)
 	if err != nil {
@@ -149,7 +226,7 @@ func getAllContainerInfo() []*ContainerInfo {
 			log.Printf("获取容器信息失败%v\n", err)
 			continue
 		}
-		containers = append(containers, tmpContainer)
+		containers = append(containers, reconcile(tmpContainer))
 	}
 	return containers
 }
@@ -168,7 +245,18 @@ func ReadContainerInfo(containerDir os.DirEntry) (*ContainerInfo, error) {
 	}
 	return &containerInfo, nil
 }
+
+// GetContainerInfo 获取容器信息，进程已经不存在的运行中的容器会被标记为退出
 func GetContainerInfo(containerId string) (*ContainerInfo, error) {
+	info, err := readContainerInfo(containerId)
+	if err != nil {
+		return nil, err
+	}
+	return reconcile(info), nil
+}
+
+// 读取记录的容器信息
+func readContainerInfo(containerId string) (*ContainerInfo, error) {
 	dir := fmt.Sprintf(ContainerInfoLocation, containerId)
 	containerInfoFile := dir + ContainerConfigName
 	content, err := os.ReadFile(containerInfoFile)
@@ -184,41 +272,78 @@ func GetContainerInfo(containerId string) (*ContainerInfo, error) {
 	return &containerInfo, nil
 }
 func GetContainerPid(containerId string) string {
-	info, _ := GetContainerInfo(containerId)
+	info, err := GetContainerInfo(containerId)
+	if err != nil {
+		return ""
+	}
 	return info.Pid
 }
 
 const ENV_EXEC_PID = "mydocker_pid"
 const ENV_EXEC_CMD = "mydocker_cmd"
+const ENV_EXEC_TTY = "mydocker_tty"
 
-func ExecContainer(containerId string, cmdArray []string) {
-	pid := GetContainerPid(containerId)
-	//拼接命令行
-	cmdStr := strings.Join(cmdArray, " ")
-	log.Printf("容器进程pid是%s,执行命令%s \n", pid, cmdStr)
-	//再次调用自身
-	cmd := exec.Command("/proc/self/exe", "exec")
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	//设置环境变量， 用于 c 相关的代码判断是否执行，以及作为c执行的参数
-	err := os.Setenv(ENV_EXEC_PID, pid)
+// ExecContainer 在容器中执行命令, stdio 依次为标准输入，标准输出，标准错误
+func ExecContainer(containerId string, cmdArray []string, stdio []*os.File) error {
+	cmd, err := newExecProcess(containerId, cmdArray)
 	if err != nil {
-		log.Println("设置环境变量失败")
-		return
+		return err
 	}
-	err = os.Setenv(ENV_EXEC_CMD, cmdStr)
-	if err != nil {
-		log.Println("设置环境变量失败")
-		return
+	if len(stdio) == 3 {
+		cmd.Stdin = stdio[0]
+		cmd.Stdout = stdio[1]
+		cmd.Stderr = stdio[2]
 	}
-	// 添加要attach的进程的环境变量到自身
-	containerEnvs := getEnvsByPid(pid)
-	cmd.Env = append(os.Environ(), containerEnvs...)
 	if err := cmd.Run(); err != nil {
-		log.Printf("exec 容器 %s 失败 %v \n", containerId, err)
+		return fmt.Errorf("exec 容器 %s 失败 %v", containerId, err)
+	}
+	return nil
+}
+
+// StartExecTerminal 在容器中启动命令，不等待命令结束
+// 伪终端的从设备 tty 作为命令的标准输入输出，命令在容器中新的会话中运行，tty 是它的控制终端
+func StartExecTerminal(containerId string, cmdArray []string, tty *os.File) (*exec.Cmd, error) {
+	cmd, err := newExecProcess(containerId, cmdArray)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin = tty
+	cmd.Stdout = tty
+	cmd.Stderr = tty
+	// nsenter 进入容器的 namespace 后在新的会话中执行命令，见 nsenter.go
+	cmd.Env = append(cmd.Env, ENV_EXEC_TTY+"=1")
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("exec 容器 %s 失败 %v", containerId, err)
+	}
+	return cmd, nil
+}
+
+// 创建在运行中的容器里执行命令的进程，并记录 exec_start 事件
+func newExecProcess(containerId string, cmdArray []string) (*exec.Cmd, error) {
+	info, err := GetContainerInfo(containerId)
+	if err != nil || info.Pid == "" {
+		return nil, fmt.Errorf("容器 %s 没有运行", containerId)
+	}
+	if info.Status == Paused {
+		return nil, fmt.Errorf("容器 %s 已暂停, 请先执行 unpause", containerId)
 	}
+	//拼接命令行
+	cmdStr := strings.Join(cmdArray, " ")
+	log.Printf("容器进程pid是%s,执行命令%s \n", info.Pid, cmdStr)
+	LogContainerEvent(info, "exec_start", map[string]string{"execCommand": cmdStr})
+	return execCommand(info, cmdStr), nil
+}
+
+// 再次调用自身，nsenter 中的 c 代码进入容器的 namespace 后通过 sh 执行 cmdStr，进程的退出码是命令的退出码
+func execCommand(info *ContainerInfo, cmdStr string) *exec.Cmd {
+	cmd := exec.Command("/proc/self/exe", "exec")
+	// 添加要attach的进程的环境变量
+	containerEnvs := getEnvsByPid(info.Pid)
+	cmd.Env = append(os.Environ(), containerEnvs...)
+	//设置环境变量， 用于 c 相关的代码判断是否执行，以及作为c执行的参数
+	// 只设置在子进程上，不能修改当前进程的环境变量，否则当前进程之后再调用自身时也会进入容器的namespace
+	cmd.Env = append(cmd.Env, ENV_EXEC_PID+"="+info.Pid, ENV_EXEC_CMD+"="+cmdStr)
+	return cmd
 }
 
 // 获取进程环境变量
@@ -234,38 +359,56 @@ func getEnvsByPid(pid string) []string {
 	return envs
 }
 
-func StopContainer(containerId string) {
-	info, err := GetContainerInfo(containerId)
+// StopContainer 向容器的 init 进程发送停止信号，不等待容器退出
+// 记录容器被手动停止，shim 记录退出信息时将状态设置为 stoped
+// 暂停的容器收到信号后需要调用方恢复冻结的进程，进程才能处理信号
+func StopContainer(containerId string) (*ContainerInfo, error) {
+	info, err := UpdateContainerInfo(containerId, func(info *ContainerInfo) {
+		if info.IsRunning() {
+			info.ManuallyStopped = true
+		}
+	})
 	if err != nil {
-		log.Printf("获取容器:%s 进程pid,失败 %v\n", containerId, err)
+		return nil, fmt.Errorf("获取容器:%s 进程pid,失败 %v", containerId, err)
+	}
+	if !info.IsRunning() {
+		return info, nil
+	}
+	stopSignal := info.StopSignal
+	if stopSignal == "" {
+		stopSignal = DefaultStopSignal
+	}
+	sig, err := ParseSignal(stopSignal)
+	if err != nil {
+		sig = syscall.SIGTERM
 	}
 	pid, _ := strconv.Atoi(info.Pid)
-	// 调用 kill
-	err = syscall.Kill(pid, syscall.SIGTERM)
-	// 如果进程不存在，说明进程已经结束了，也应该修改状态
-	// 修改容器状态
-	info.Pid = ""
-	info.Status = Stop
-	//记录到容器信息
-	recordContainerInfo(info)
+	if pid > 0 {
+		// 如果进程不存在，说明进程已经结束了，由 shim 记录退出信息
+		_ = syscall.Kill(pid, sig)
+		LogContainerEvent(info, "kill", map[string]string{"signal": stopSignal})
+	}
+	return info, nil
 }
-func RemoveContainer(containerId string) {
+
+// RemoveContainer 删除已经停止的容器
+func RemoveContainer(containerId string) error {
 	//获取容器信息
 	info, err := GetContainerInfo(containerId)
 	if err != nil {
-		log.Printf("获取容器:%s 进程,失败 %v\n", containerId, err)
-		return
+		return fmt.Errorf("获取容器:%s 进程,失败 %v", containerId, err)
 	}
-	if info.Status != Stop {
-		log.Println("只能删除停止的容器")
-		return
+	if info.IsRunning() {
+		return fmt.Errorf("只能删除停止的容器")
 	}
 	DeleteWorkSpace(info)
 	DeleteContainerInfo(info)
+	LogContainerEvent(info, "destroy", nil)
+	return nil
 }
 
 func ResolveContainerId(idOrName string, justName bool) string {
-	infoList := getAllContainerInfo()
+	infoList := GetContainerInfoList()
 	// 先从名称匹配
 	var matched []string
 	for _, info := range infoList {
@@ -295,19 +438,25 @@ func ResolveContainerId(idOrName string, justName bool) string {
 	return ""
 }
 
-func SaveContainer(idOrName string, saveName string) {
+// SaveContainer 将容器的文件系统打包为 tar 文件
+func SaveContainer(idOrName string, saveName string) error {
 	id := ResolveContainerId(idOrName, false)
 	if id == "" {
-		log.Printf("容器标识: %s 不存在", idOrName)
-		return
+		return fmt.Errorf("容器标识: %s 不存在", idOrName)
 	}
 	info, err := GetContainerInfo(id)
 	if err != nil {
-		log.Printf("获取容器信息失败: %v", err)
-		return
+		return fmt.Errorf("获取容器信息失败: %v", err)
 	}
 	dir := path.Join(info.BaseUrl, MERGED)
-	if _, err := exec.Command("tar", "-cvf", saveName, "-C", dir, ".").CombinedOutput(); err != nil {
-		log.Println("打包容器失败")
+	// 停止的容器已经取消了挂载，临时挂载 overlay 文件系统
+	if !isMountPoint(dir) {
+		createMergedDir(info.BaseUrl, getLowerDir(info.Image))
+		defer DeleteOverlayMountPoint(info.BaseUrl)
+	}
+	if output, err := exec.Command("tar", "-cf", saveName, "-C", dir, ".").CombinedOutput(); err != nil {
+		return fmt.Errorf("打包容器失败: %v, %s", err, output)
 	}
+	LogContainerEvent(info, "export", map[string]string{"file": saveName})
+	return nil
 }
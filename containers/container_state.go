@@ -0,0 +1,115 @@
+package containers
+
+import (
+	"cgroups"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ProcessStartTime 进程的启动时间，单位是系统启动后的时钟周期，用来判断 pid 是否被其他进程复用，进程不存在时返回空
+func ProcessStartTime(pid int) string {
+	// starttime 是第22个字段
+	fields := readProcessStat(pid)
+	if len(fields) < 20 {
+		return ""
+	}
+	return fields[19]
+}
+
+// 读取 /proc/<pid>/stat，返回 comm 之后的字段，第一个是进程状态，进程不存在时返回空
+func readProcessStat(pid int) []string {
+	content, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil
+	}
+	// 格式为 pid (comm) state ppid ...，comm 中可能有空格和括号，从最后一个 ) 之后开始解析
+	stat := string(content)
+	return strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+}
+
+// PidNamespace 进程所在的 pid namespace，格式为 pid:[4026532198]，进程不存在时返回空
+func PidNamespace(pid int) string {
+	ns, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/pid", pid))
+	if err != nil {
+		return ""
+	}
+	return ns
+}
+
+// 记录的进程是否还存在，启动时间和 namespace 为空时不比较，兼容没有记录这些信息的容器
+func processMatches(pidStr string, startTime string, namespace string) bool {
+	pid, _ := strconv.Atoi(pidStr)
+	if pid <= 0 || syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	if startTime != "" && ProcessStartTime(pid) != startTime {
+		return false
+	}
+	if namespace != "" && PidNamespace(pid) != namespace {
+		return false
+	}
+	return true
+}
+
+// InitAlive 容器的 init 进程是否还存在，pid 被其他进程复用时返回 false
+func (info *ContainerInfo) InitAlive() bool {
+	return processMatches(info.Pid, info.PidStartTime, info.PidNamespace)
+}
+
+// ShimAlive 容器的 shim 进程是否还存在，pid 被其他进程复用时返回 false
+func (info *ContainerInfo) ShimAlive() bool {
+	return processMatches(info.ShimPid, info.ShimStartTime, "")
+}
+
+// RecordExit 记录容器的退出信息，清理容器的 cgroup 以及 overlay 文件系统和卷的挂载
+func RecordExit(containerId string, exitCode int) (*ContainerInfo, error) {
+	// 容器运行期间信息可能被修改，例如被 stop，加锁读取最新的信息后修改
+	info, err := UpdateContainerInfo(containerId, func(info *ContainerInfo) {
+		DeleteWorkSpace(info)
+		if info.SetCgroup {
+			cgroupManager := cgroups.NewCgroupManager(cgroups.RooutCgroupPath + containerId)
+			info.OOMKilled = cgroupManager.OOMKilled()
+			cgroupManager.Remove()
+			info.SetCgroup = false
+		}
+		info.ExitCode = exitCode
+		info.FinishedAt = time.Now().Format("2006-01-02 15:04:05")
+		info.Pid = ""
+		info.ShimPid = ""
+		if info.IsRunning() {
+			info.Status = Exit
+			if info.ManuallyStopped {
+				info.Status = Stop
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("容器 %s 退出, 退出码: %d\n", containerId, exitCode)
+	if info.OOMKilled {
+		LogContainerEvent(info, "oom", nil)
+	}
+	LogContainerEvent(info, "die", map[string]string{"exitCode": strconv.Itoa(exitCode)})
+	return info, nil
+}
+
+// 记录的状态是运行中，但是 init 进程和 shim 进程都已经不存在的容器标记为退出，例如在 mydocker 之外被杀死
+// init 进程不存在但是 shim 进程还在时，由 shim 记录退出信息
+func reconcile(info *ContainerInfo) *ContainerInfo {
+	if !info.IsRunning() || info.InitAlive() || info.ShimAlive() {
+		return info
+	}
+	log.Printf("容器 %s 的进程已经不存在, 标记为退出\n", info.Id)
+	latest, err := RecordExit(info.Id, -1)
+	if err != nil {
+		log.Printf("记录容器 %s 的退出信息失败: %v\n", info.Id, err)
+		return info
+	}
+	return latest
+}
@@ -0,0 +1,352 @@
+package containers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 事件的类型
+const (
+	ContainerEvent = "container"
+	ImageEvent     = "image"
+	NetworkEvent   = "network"
+)
+
+var (
+	// EventsLocation 事件日志，每行是一个 json 格式的事件，只追加写入
+	// daemon，容器的 shim 进程以及 build 等直接执行的命令都会写入
+	EventsLocation = "/var/run/mydocker/events.log"
+	// EventsRotatedLocation 事件日志超过 maxEventsSize 后重命名为这个文件，只保留一个旧的日志
+	EventsRotatedLocation = "/var/run/mydocker/events.log.1"
+)
+
+const maxEventsSize = 16 << 20
+
+// Event 容器，镜像，网络的变化
+type Event struct {
+	// 事件的类型 container, image, network
+	Type string `json:"type"`
+	// 事件的动作，例如容器的 create, start, die, oom, destroy
+	Action string `json:"action"`
+	// 对象的标识，容器和镜像是 id，网络是名称
+	Id string `json:"id"`
+	// 事件的属性，例如容器的名称，镜像，标签，退出码
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// 事件发生的时间，unix 纳秒
+	TimeNano int64 `json:"timeNano"`
+}
+
+// Time 事件发生的时间
+func (e *Event) Time() time.Time {
+	return time.Unix(0, e.TimeNano)
+}
+
+// String 事件的文本格式，例如
+// 2026-10-18T11:18:44.123456789+08:00 container die 0269616681 (exitCode=0, image=base, name=st1)
+func (e *Event) String() string {
+	s := fmt.Sprintf("%s %s %s %s", e.Time().Format(time.RFC3339Nano), e.Type, e.Action, e.Id)
+	if len(e.Attributes) == 0 {
+		return s
+	}
+	var keys []string
+	for key := range e.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var attributes []string
+	for _, key := range keys {
+		attributes = append(attributes, key+"="+e.Attributes[key])
+	}
+	return s + " (" + strings.Join(attributes, ", ") + ")"
+}
+
+// LogEvent 追加一条事件到事件日志，失败时只打印日志，不影响调用方
+func LogEvent(eventType string, action string, id string, attributes map[string]string) {
+	event := &Event{
+		Type:       eventType,
+		Action:     action,
+		Id:         id,
+		Attributes: attributes,
+		TimeNano:   time.Now().UnixNano(),
+	}
+	if err := appendEvent(event); err != nil {
+		log.Printf("记录事件 %s %s %s 失败: %v\n", eventType, action, id, err)
+	}
+}
+
+// LogContainerEvent 记录容器的事件，属性中加上容器的名称，镜像和标签
+func LogContainerEvent(info *ContainerInfo, action string, attributes map[string]string) {
+	result := map[string]string{}
+	// 标签放在前面，避免覆盖 name, image 等属性
+	for _, label := range info.Labels {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) == 2 {
+			result[parts[0]] = parts[1]
+		} else {
+			result[parts[0]] = ""
+		}
+	}
+	result["name"] = info.Name
+	result["image"] = info.Image
+	for key, value := range attributes {
+		result[key] = value
+	}
+	LogEvent(ContainerEvent, action, info.Id, result)
+}
+
+// 写入事件日志，多个进程同时写入时通过文件锁保证每个事件是完整的一行，并且轮转时不会丢失事件
+func appendEvent(event *Event) error {
+	content, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(EventsLocation, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		return err
+	}
+	// 拿到锁之前日志可能已经被其他进程轮转，只轮转当前的日志文件
+	if stat, err := file.Stat(); err == nil && stat.Size() > maxEventsSize {
+		if current, err := os.Stat(EventsLocation); err == nil && os.SameFile(stat, current) {
+			return os.Rename(EventsLocation, EventsRotatedLocation)
+		}
+	}
+	return nil
+}
+
+// EventsCursor 事件日志中读取到的位置，用于持续读取新追加的事件
+type EventsCursor struct {
+	// 正在读取的日志文件
+	stat   os.FileInfo
+	offset int64
+}
+
+// ReadEvents 读取事件日志中的所有事件，包括轮转之前的日志，返回事件以及读取到的位置
+func ReadEvents() ([]*Event, *EventsCursor, error) {
+	cursor := &EventsCursor{}
+	var events []*Event
+	if rotated, err := os.Stat(EventsRotatedLocation); err == nil {
+		cursor.stat = rotated
+		if events, err = cursor.read(EventsRotatedLocation); err != nil {
+			return nil, nil, err
+		}
+	}
+	next, err := cursor.Next()
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(events, next...), cursor, nil
+}
+
+// Next 读取上一次读取之后追加的事件，日志被轮转时先读完轮转之前的日志，再从头读取新的日志
+func (c *EventsCursor) Next() ([]*Event, error) {
+	current, err := os.Stat(EventsLocation)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var events []*Event
+	if c.stat != nil && !os.SameFile(c.stat, current) {
+		// 正在读取的日志已经被轮转
+		if rotated, err := os.Stat(EventsRotatedLocation); err == nil && os.SameFile(c.stat, rotated) {
+			if events, err = c.read(EventsRotatedLocation); err != nil {
+				return nil, err
+			}
+		}
+		c.offset = 0
+	}
+	c.stat = current
+	next, err := c.read(EventsLocation)
+	if err != nil {
+		return nil, err
+	}
+	return append(events, next...), nil
+}
+
+// 从 offset 开始读取完整的行，最后一行可能正在写入，留到下一次读取
+func (c *EventsCursor) read(file string) ([]*Event, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(c.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	end := bytes.LastIndexByte(content, '\n')
+	if end < 0 {
+		return nil, nil
+	}
+	c.offset += int64(end + 1)
+	var events []*Event
+	for _, line := range bytes.Split(content[:end], []byte{'\n'}) {
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			log.Printf("解析事件失败: %v\n", err)
+			continue
+		}
+		events = append(events, &event)
+	}
+	return events, nil
+}
+
+// EventFilter 过滤事件的条件，key 为 type, event, container, image, network, label
+// 相同 key 的多个值满足一个即可，不同 key 的条件需要同时满足
+type EventFilter map[string][]string
+
+// ParseEventFilter 解析 key=value 格式的过滤条件，一个条件中可以用逗号分隔多个 key=value，例如 type=container,event=die
+func ParseEventFilter(filters []string) (EventFilter, error) {
+	filter := EventFilter{}
+	for _, f := range filters {
+		for _, item := range strings.Split(f, ",") {
+			parts := strings.SplitN(item, "=", 2)
+			if len(parts) != 2 || parts[1] == "" {
+				return nil, fmt.Errorf("过滤条件格式错误: %s, 格式为 key=value", item)
+			}
+			switch parts[0] {
+			case "type", "event", "container", "image", "network", "label":
+			default:
+				return nil, fmt.Errorf("不支持的过滤条件: %s, 支持 type, event, container, image, network, label", parts[0])
+			}
+			filter[parts[0]] = append(filter[parts[0]], parts[1])
+			// 容器事件中记录的是镜像id，同时匹配镜像名称对应的id
+			if parts[0] == "image" {
+				if imageId := ResolveImageId(parts[1], false); imageId != "" && imageId != parts[1] {
+					filter["image"] = append(filter["image"], imageId)
+				}
+			}
+		}
+	}
+	return filter, nil
+}
+
+// Match 事件是否满足过滤条件
+func (f EventFilter) Match(event *Event) bool {
+	for key, values := range f {
+		matched := false
+		for _, value := range values {
+			if f.matchOne(key, value, event) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func (f EventFilter) matchOne(key string, value string, event *Event) bool {
+	switch key {
+	case "type":
+		return event.Type == value
+	case "event":
+		return event.Action == value
+	case "container":
+		// 容器 id 前缀或者名称
+		return event.Type == ContainerEvent && (strings.HasPrefix(event.Id, value) || event.Attributes["name"] == value)
+	case "image":
+		// 镜像事件的镜像 id 或者名称，容器事件使用的镜像
+		if event.Type == ImageEvent {
+			return event.Id == value || event.Attributes["name"] == value
+		}
+		return event.Type == ContainerEvent && event.Attributes["image"] == value
+	case "network":
+		// 网络事件的网络名称，容器连接和断开网络的事件都是网络事件
+		return event.Type == NetworkEvent && event.Id == value
+	case "label":
+		// label=key 匹配有这个标签的事件，label=key=value 匹配标签的值
+		parts := strings.SplitN(value, "=", 2)
+		attribute, ok := event.Attributes[parts[0]]
+		return ok && (len(parts) == 1 || attribute == parts[1])
+	}
+	return false
+}
+
+// FilterEvents 返回 since 和 until 之间满足过滤条件的事件，until 为零值时不限制结束时间
+// 事件按照时间顺序追加，遇到 until 之后的事件时停止，第二个返回值为 false 表示之后不会再有需要的事件
+func FilterEvents(events []*Event, since time.Time, until time.Time, filter EventFilter) ([]*Event, bool) {
+	var result []*Event
+	for _, event := range events {
+		t := event.Time()
+		if !until.IsZero() && t.After(until) {
+			return result, false
+		}
+		if t.Before(since) || !filter.Match(event) {
+			continue
+		}
+		result = append(result, event)
+	}
+	return result, true
+}
+
+// ParseEventTime 解析事件的时间，支持 unix 时间戳（可以有小数），RFC3339 格式，2006-01-02 15:04:05 格式，
+// 以及相对于 now 的时间段，例如 10m 表示 10 分钟之前
+func ParseEventTime(value string, now time.Time) (time.Time, error) {
+	if t, ok := parseUnixTime(value); ok {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("时间格式错误: %s, 支持 unix 时间戳, RFC3339, 2006-01-02 15:04:05 以及 10m 等时间段", value)
+}
+
+// 解析 unix 时间戳，小数部分最多精确到纳秒，例如 1700000000.123456789
+func parseUnixTime(value string) (time.Time, bool) {
+	secondsPart, fractionPart, _ := strings.Cut(value, ".")
+	seconds, err := strconv.ParseInt(secondsPart, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	var nanos int64
+	if fractionPart != "" {
+		if len(fractionPart) > 9 {
+			fractionPart = fractionPart[:9]
+		}
+		nanos, err = strconv.ParseInt(fractionPart+strings.Repeat("0", 9-len(fractionPart)), 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+	}
+	return time.Unix(seconds, nanos), true
+}
+
+// FormatUnixTime 格式化为 ParseEventTime 可以解析的 unix 时间戳
+func FormatUnixTime(t time.Time) string {
+	return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
+}
@@ -0,0 +1,92 @@
+package containers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseEventTime(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"1700000000", time.Unix(1700000000, 0), false},
+		{"1700000000.5", time.Unix(1700000000, 500000000), false},
+		{"1700000000.1234567891", time.Unix(1700000000, 123456789), false},
+		{"2026-10-18T10:00:00Z", time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC), false},
+		{"2026-10-18 10:00:00", time.Date(2026, 10, 18, 10, 0, 0, 0, time.Local), false},
+		{"2026-10-18", time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local), false},
+		{"10m", now.Add(-10 * time.Minute), false},
+		{"yesterday", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseEventTime(tt.value, now)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("ParseEventTime(%q) = %v, %v, 期望 %v", tt.value, got, err, tt.want)
+		}
+	}
+	// 格式化之后可以解析为相同的时间
+	if got, _ := ParseEventTime(FormatUnixTime(now.Add(123)), now); !got.Equal(now.Add(123)) {
+		t.Errorf("FormatUnixTime 解析为 %v", got)
+	}
+}
+
+func TestFilterEvents(t *testing.T) {
+	useTempImageStore(t)
+	base := time.Unix(1700000000, 0)
+	at := func(seconds int) int64 {
+		return base.Add(time.Duration(seconds) * time.Second).UnixNano()
+	}
+	events := []*Event{
+		{Type: ContainerEvent, Action: "create", Id: "c1", TimeNano: at(0), Attributes: map[string]string{"name": "web", "image": "i1"}},
+		{Type: ContainerEvent, Action: "start", Id: "c1", TimeNano: at(1), Attributes: map[string]string{"name": "web", "image": "i1", "env": "prod"}},
+		{Type: ImageEvent, Action: "tag", Id: "i1", TimeNano: at(2), Attributes: map[string]string{"name": "app:v1"}},
+		{Type: NetworkEvent, Action: "connect", Id: "bridge", TimeNano: at(3), Attributes: map[string]string{"container": "c1"}},
+		{Type: ContainerEvent, Action: "die", Id: "c2", TimeNano: at(4), Attributes: map[string]string{"name": "db", "image": "i2"}},
+	}
+	tests := []struct {
+		name     string
+		since    int
+		until    int
+		filters  []string
+		want     []string
+		wantMore bool
+	}{
+		{"没有 until", 0, -1, nil, []string{"create", "start", "tag", "connect", "die"}, true},
+		{"since", 2, -1, nil, []string{"tag", "connect", "die"}, true},
+		{"until", 0, 2, nil, []string{"create", "start", "tag"}, false},
+		{"since 和 until", 1, 3, nil, []string{"start", "tag", "connect"}, false},
+		{"until 之后没有事件", 0, 4, nil, []string{"create", "start", "tag", "connect", "die"}, true},
+		{"type", 0, -1, []string{"type=container"}, []string{"create", "start", "die"}, true},
+		{"type 和 event", 0, -1, []string{"type=container,event=die"}, []string{"die"}, true},
+		{"相同 key 满足一个", 0, -1, []string{"event=create", "event=die"}, []string{"create", "die"}, true},
+		{"container 名称", 0, -1, []string{"container=web"}, []string{"create", "start"}, true},
+		{"container id 前缀", 0, -1, []string{"container=c2"}, []string{"die"}, true},
+		{"image 包含容器事件", 0, -1, []string{"image=i1"}, []string{"create", "start", "tag"}, true},
+		{"network", 0, -1, []string{"network=bridge"}, []string{"connect"}, true},
+		{"label 名称和值", 0, -1, []string{"label=env=prod"}, []string{"start"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseEventFilter(tt.filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var until time.Time
+			if tt.until >= 0 {
+				until = time.Unix(0, at(tt.until))
+			}
+			matched, more := FilterEvents(events, time.Unix(0, at(tt.since)), until, filter)
+			actions := []string{}
+			for _, event := range matched {
+				actions = append(actions, event.Action)
+			}
+			if !reflect.DeepEqual(actions, tt.want) || more != tt.wantMore {
+				t.Errorf("事件为 %v %v, 期望 %v %v", actions, more, tt.want, tt.wantMore)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package containers
+
+import (
+	"bytes"
+	"dockerfile"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 健康检查的状态
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// 健康检查的默认配置，和 docker 相同
+const (
+	DefaultHealthInterval = 30 * time.Second
+	DefaultHealthTimeout  = 30 * time.Second
+	DefaultHealthRetries  = 3
+)
+
+// 每个容器保留最近几次健康检查的结果
+const maxHealthLog = 5
+
+// 健康检查输出保留的最大长度
+const maxHealthOutput = 4096
+
+// HealthConfig 健康检查的配置，来自 dockerfile 的 HEALTHCHECK 或者 run 的 --health-* 参数
+type HealthConfig struct {
+	// 检查的命令，第一个元素为 CMD 表示 exec 格式，CMD-SHELL 表示 shell 格式，NONE 表示禁用镜像中的健康检查
+	Test []string `json:"test"`
+	// 两次检查的间隔
+	Interval time.Duration `json:"interval"`
+	// 单次检查的超时时间
+	Timeout time.Duration `json:"timeout"`
+	// 容器启动后的这段时间内检查失败不计入连续失败次数
+	StartPeriod time.Duration `json:"startPeriod"`
+	// 连续失败多少次后标记为 unhealthy
+	Retries int `json:"retries"`
+}
+
+// Enabled 是否配置了健康检查
+func (c *HealthConfig) Enabled() bool {
+	return c != nil && len(c.Test) > 0 && c.Test[0] != "NONE"
+}
+
+// 在容器中执行的命令，nsenter 通过 sh -c 执行，CMD-SHELL 的命令原样交给 sh
+// exec 格式的每个参数加上单引号，不会被 shell 拆分和解释
+func (c *HealthConfig) command() string {
+	if c.Test[0] == "CMD-SHELL" {
+		return strings.Join(c.Test[1:], " ")
+	}
+	args := make([]string, 0, len(c.Test)-1)
+	for _, arg := range c.Test[1:] {
+		args = append(args, shellQuote(arg))
+	}
+	return strings.Join(args, " ")
+}
+
+// 单引号中的内容 shell 不做处理，参数中的单引号先结束引号，转义之后再开始新的引号
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Merge 用 override 中设置的字段覆盖当前配置，返回新的配置，没有设置的字段使用默认值
+func (c *HealthConfig) Merge(override *HealthConfig) *HealthConfig {
+	result := &HealthConfig{}
+	if c != nil {
+		*result = *c
+	}
+	if override != nil {
+		if len(override.Test) > 0 {
+			result.Test = override.Test
+		}
+		if override.Interval > 0 {
+			result.Interval = override.Interval
+		}
+		if override.Timeout > 0 {
+			result.Timeout = override.Timeout
+		}
+		if override.StartPeriod > 0 {
+			result.StartPeriod = override.StartPeriod
+		}
+		if override.Retries > 0 {
+			result.Retries = override.Retries
+		}
+	}
+	if result.Interval <= 0 {
+		result.Interval = DefaultHealthInterval
+	}
+	if result.Timeout <= 0 {
+		result.Timeout = DefaultHealthTimeout
+	}
+	if result.Retries <= 0 {
+		result.Retries = DefaultHealthRetries
+	}
+	return result
+}
+
+// Health 容器的健康状态
+type Health struct {
+	// starting, healthy, unhealthy
+	Status string `json:"status"`
+	// 连续失败的次数
+	FailingStreak int `json:"failingStreak"`
+	// 最近几次检查的结果
+	Log []*HealthProbe `json:"log"`
+}
+
+// HealthProbe 一次健康检查的结果
+type HealthProbe struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// 检查命令的退出码，0 表示健康，超时或者无法执行时为 -1
+	ExitCode int `json:"exitCode"`
+	// 检查命令的标准输出和标准错误
+	Output string `json:"output"`
+}
+
+// 解析 dockerfile 的 HEALTHCHECK 指令
+// HEALTHCHECK [--interval=30s] [--timeout=30s] [--start-period=0s] [--retries=3] CMD 命令
+// HEALTHCHECK NONE
+func (d *DockerFile) healthCheck(inst *dockerfile.Instruction) error {
+	config := &HealthConfig{}
+	for _, flag := range inst.Flags {
+		option := "--" + flag.Name + "=" + flag.Value
+		if flag.Value == "" {
+			return fmt.Errorf("HEALTHCHECK 参数格式错误: --%s, 格式为 --key=value", flag.Name)
+		}
+		var err error
+		switch flag.Name {
+		case "interval":
+			config.Interval, err = time.ParseDuration(flag.Value)
+		case "timeout":
+			config.Timeout, err = time.ParseDuration(flag.Value)
+		case "start-period":
+			config.StartPeriod, err = time.ParseDuration(flag.Value)
+		case "retries":
+			config.Retries, err = strconv.Atoi(flag.Value)
+		default:
+			return fmt.Errorf("HEALTHCHECK 不支持的参数: %s", option)
+		}
+		if err != nil {
+			return fmt.Errorf("HEALTHCHECK 参数 %s 格式错误: %v", option, err)
+		}
+	}
+	// 解析时已经检查了格式，没有 CMD 时为 HEALTHCHECK NONE
+	switch {
+	case inst.Next == nil:
+		config.Test = []string{"NONE"}
+	case inst.Next.JSON:
+		config.Test = append([]string{"CMD"}, inst.Next.Args...)
+	default:
+		config.Test = []string{"CMD-SHELL", inst.Next.Original}
+	}
+	d.HealthCheck = config
+	return nil
+}
+
+// RunHealthProbe 通过 exec 在容器中执行一次健康检查命令，超过 config.Timeout 时杀死检查命令
+func RunHealthProbe(info *ContainerInfo, config *HealthConfig) *HealthProbe {
+	probe := &HealthProbe{Start: time.Now(), ExitCode: -1}
+	var output bytes.Buffer
+	cmd := execCommand(info, config.command())
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// 检查命令在新的进程组中运行，超时时杀死整个进程组，包括 sh 启动的子进程
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		probe.End = time.Now()
+		probe.Output = fmt.Sprintf("执行健康检查失败: %v", err)
+		return probe
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	timer := time.NewTimer(config.Timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		probe.ExitCode = cmd.ProcessState.ExitCode()
+		probe.Output = output.String()
+	case <-timer.C:
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		probe.Output = fmt.Sprintf("健康检查超过 %v 没有结束", config.Timeout)
+	}
+	probe.End = time.Now()
+	if len(probe.Output) > maxHealthOutput {
+		probe.Output = probe.Output[:maxHealthOutput]
+	}
+	return probe
+}
+
+// RecordHealthProbe 记录健康检查的结果并更新容器的健康状态，返回最新的容器信息以及健康状态是否发生了变化
+// countFailure 为 false 表示还在启动时间内，检查失败不计入连续失败次数
+func RecordHealthProbe(containerId string, probe *HealthProbe, retries int, countFailure bool) (*ContainerInfo, bool, error) {
+	changed := false
+	info, err := UpdateContainerInfo(containerId, func(info *ContainerInfo) {
+		// 检查期间容器可能已经退出
+		if !info.IsRunning() || info.Health == nil {
+			return
+		}
+		health := info.Health
+		health.Log = append(health.Log, probe)
+		if len(health.Log) > maxHealthLog {
+			health.Log = health.Log[len(health.Log)-maxHealthLog:]
+		}
+		status := health.Status
+		if probe.ExitCode == 0 {
+			health.FailingStreak = 0
+			status = HealthHealthy
+		} else if countFailure {
+			health.FailingStreak++
+			if health.FailingStreak >= retries {
+				status = HealthUnhealthy
+			}
+		}
+		if status != health.Status {
+			health.Status = status
+			changed = true
+		}
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if changed {
+		LogContainerEvent(info, "health_status: "+info.Health.Status, nil)
+	}
+	return info, changed, nil
+}
+
+// IsUnhealthy 容器是否运行中并且健康检查失败
+func (info *ContainerInfo) IsUnhealthy() bool {
+	return info.IsRunning() && info.Health != nil && info.Health.Status == HealthUnhealthy
+}
@@ -0,0 +1,25 @@
+package containers
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHealthCommand(t *testing.T) {
+	args := []string{"printf", "%s\\n", "http://h/a b", "a;b", "$HOME", `it's "q"`}
+	config := &HealthConfig{Test: append([]string{"CMD"}, args...)}
+	// 和 nsenter 一样通过 sh -c 执行，每个参数原样传给命令
+	output, err := exec.Command("sh", "-c", config.command()).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n"); !reflect.DeepEqual(lines, args[2:]) {
+		t.Errorf("exec 格式的参数为 %q, 期望 %q", lines, args[2:])
+	}
+	shell := &HealthConfig{Test: []string{"CMD-SHELL", "test -n \"$HOME\" && echo ok"}}
+	if command := shell.command(); command != shell.Test[1] {
+		t.Errorf("CMD-SHELL 的命令应该原样执行: %s", command)
+	}
+}
@@ -0,0 +1,695 @@
+package containers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// save 和 load 使用的镜像归档，和 docker 25 之后的 docker save 相同，同时是 OCI 镜像目录和 docker save 归档:
+// oci-layout, index.json 以及 blobs/sha256/ 中的 manifest, 镜像配置和 gzip 压缩的镜像层，manifest.json 引用 blobs 中的文件
+
+// OCI 镜像规范和 docker 使用的 media type
+const (
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIConfig          = "application/vnd.oci.image.config.v1+json"
+	mediaTypeOCILayerGzip       = "application/vnd.oci.image.layer.v1.tar+gzip"
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// index.json 中记录镜像名称的 annotation
+const (
+	// OCI 规范中的名称，可能只有版本
+	annotationRefName = "org.opencontainers.image.ref.name"
+	// containerd 和 docker 使用的完整名称
+	annotationImageName = "io.containerd.image.name"
+)
+
+// 镜像归档中的文件
+const (
+	ociLayoutFile      = "oci-layout"
+	ociIndexFile       = "index.json"
+	dockerManifestFile = "manifest.json"
+	archiveBlobDir     = "blobs/sha256/"
+)
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *ociPlatform      `json:"platform,omitempty"`
+}
+
+type ociPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// OCI 镜像配置，Healthcheck 是 docker 的扩展
+type ociImageConfig struct {
+	Created      *time.Time         `json:"created,omitempty"`
+	Author       string             `json:"author,omitempty"`
+	Architecture string             `json:"architecture"`
+	OS           string             `json:"os"`
+	Config       ociContainerConfig `json:"config"`
+	RootFS       ociRootFS          `json:"rootfs"`
+	History      []ociHistory       `json:"history,omitempty"`
+}
+
+type ociContainerConfig struct {
+	Env          []string            `json:"Env,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Volumes      map[string]struct{} `json:"Volumes,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+	StopSignal   string              `json:"StopSignal,omitempty"`
+	Healthcheck  *dockerHealthcheck  `json:"Healthcheck,omitempty"`
+}
+
+type dockerHealthcheck struct {
+	Test        []string      `json:"Test,omitempty"`
+	Interval    time.Duration `json:"Interval,omitempty"`
+	Timeout     time.Duration `json:"Timeout,omitempty"`
+	StartPeriod time.Duration `json:"StartPeriod,omitempty"`
+	Retries     int           `json:"Retries,omitempty"`
+}
+
+type ociRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+type ociHistory struct {
+	Created   *time.Time `json:"created,omitempty"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	Author    string     `json:"author,omitempty"`
+	Comment   string     `json:"comment,omitempty"`
+	// 没有创建镜像层的指令，例如 ENV
+	EmptyLayer bool `json:"empty_layer,omitempty"`
+}
+
+// docker save 的 manifest.json 中的一项
+type dockerManifestEntry struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// SaveImages 把镜像保存为镜像归档，output 以 / 结尾或者是已经存在的目录时保存为 OCI 镜像目录，否则保存为 tar 文件
+func SaveImages(names []string, output string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("没有指定镜像")
+	}
+	var images []*ImageInfo
+	for _, name := range names {
+		imageId, err := FindImageId(name)
+		if err != nil {
+			return err
+		}
+		info, err := GetImageInfo(imageId)
+		if err != nil {
+			return fmt.Errorf("获取镜像 %s 失败 %v", name, err)
+		}
+		images = append(images, info)
+	}
+	dir := output
+	toTar := !strings.HasSuffix(output, "/") && !isDir(output)
+	if toTar {
+		tmp, err := os.MkdirTemp("", "mydocker-save-")
+		if err != nil {
+			return fmt.Errorf("创建临时目录失败 %v", err)
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	}
+	layout := &imageLayout{dir: dir, layers: map[string]ociDescriptor{}}
+	index := ociIndex{SchemaVersion: 2, MediaType: mediaTypeOCIIndex}
+	var manifest []dockerManifestEntry
+	for _, info := range images {
+		desc, entry, err := layout.writeImage(info)
+		if err != nil {
+			return fmt.Errorf("保存镜像 %s 失败: %v", imageReference(info), err)
+		}
+		index.Manifests = append(index.Manifests, *desc)
+		manifest = append(manifest, *entry)
+	}
+	if err := writeJSONFile(filepath.Join(dir, ociLayoutFile), map[string]string{"imageLayoutVersion": "1.0.0"}); err != nil {
+		return err
+	}
+	if err := writeJSONFile(filepath.Join(dir, ociIndexFile), &index); err != nil {
+		return err
+	}
+	if err := writeJSONFile(filepath.Join(dir, dockerManifestFile), manifest); err != nil {
+		return err
+	}
+	if toTar {
+		if err := tarDir(dir, output); err != nil {
+			return fmt.Errorf("打包镜像归档失败 %v", err)
+		}
+	}
+	for _, info := range images {
+		LogEvent(ImageEvent, "save", info.Id, map[string]string{"name": imageReference(info), "file": output})
+	}
+	return nil
+}
+
+// 正在写入的镜像归档
+type imageLayout struct {
+	dir string
+	// 已经写入的镜像层，key 是未压缩的镜像层的摘要，多个镜像共用的镜像层只写入一次
+	layers map[string]ociDescriptor
+}
+
+// 写入镜像的镜像层，配置和 manifest，返回 index.json 和 manifest.json 中的记录
+func (l *imageLayout) writeImage(info *ImageInfo) (*ociDescriptor, *dockerManifestEntry, error) {
+	layers, err := ImageLayers(info.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	manifest := ociManifest{SchemaVersion: 2, MediaType: mediaTypeOCIManifest}
+	entry := &dockerManifestEntry{RepoTags: []string{}}
+	for _, layer := range layers {
+		desc, err := l.writeLayer(layer)
+		if err != nil {
+			return nil, nil, err
+		}
+		manifest.Layers = append(manifest.Layers, desc)
+		entry.Layers = append(entry.Layers, archiveBlobDir+strings.TrimPrefix(desc.Digest, DigestPrefix))
+	}
+	config, err := l.writeJSON(mediaTypeOCIConfig, imageConfig(info, layers))
+	if err != nil {
+		return nil, nil, err
+	}
+	manifest.Config = config
+	entry.Config = archiveBlobDir + strings.TrimPrefix(config.Digest, DigestPrefix)
+	desc, err := l.writeJSON(mediaTypeOCIManifest, &manifest)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, tag := range imageTags(info) {
+		reference, version := exportReference(tag)
+		// index.json 中只记录第一个名称，manifest.json 中记录所有的名称
+		if i == 0 {
+			desc.Annotations = map[string]string{annotationImageName: reference, annotationRefName: version}
+		}
+		entry.RepoTags = append(entry.RepoTags, reference)
+	}
+	return &desc, entry, nil
+}
+
+// 使用 gzip 压缩镜像层后写入 blobs
+func (l *imageLayout) writeLayer(layer string) (ociDescriptor, error) {
+	if desc, ok := l.layers[layer]; ok {
+		return desc, nil
+	}
+	blob, err := OpenBlob(layer)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	defer blob.Close()
+	reader, writer := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(writer)
+		_, err := io.Copy(gz, blob)
+		if closeErr := gz.Close(); err == nil {
+			err = closeErr
+		}
+		writer.CloseWithError(err)
+	}()
+	digest, size, err := writeBlobTo(filepath.Join(l.dir, archiveBlobDir), reader)
+	reader.Close()
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	desc := ociDescriptor{MediaType: mediaTypeOCILayerGzip, Digest: digest, Size: size}
+	l.layers[layer] = desc
+	return desc, nil
+}
+
+func (l *imageLayout) writeJSON(mediaType string, v interface{}) (ociDescriptor, error) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	digest, size, err := writeBlobTo(filepath.Join(l.dir, archiveBlobDir), bytes.NewReader(content))
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	return ociDescriptor{MediaType: mediaType, Digest: digest, Size: size}, nil
+}
+
+// 镜像信息转换为 OCI 镜像配置
+func imageConfig(info *ImageInfo, layers []string) *ociImageConfig {
+	config := &ociImageConfig{
+		Author:       info.Author,
+		Architecture: runtime.GOARCH,
+		OS:           "linux",
+		Config: ociContainerConfig{
+			Env:        info.Env,
+			Entrypoint: info.EntryPoint,
+			Cmd:        info.CMD,
+			WorkingDir: info.WorkDir,
+			StopSignal: info.StopSignal,
+		},
+		RootFS: ociRootFS{Type: "layers", DiffIDs: layers},
+	}
+	if created, err := time.ParseInLocation("2006-01-02 15:04:05", info.CreateTime, time.Local); err == nil {
+		config.Created = &created
+	}
+	// shell 格式的命令使用 sh -c 执行
+	if info.EntryPointShellType {
+		config.Config.Entrypoint = []string{"/bin/sh", "-c", strings.Join(info.EntryPoint, " ")}
+	}
+	if info.CMDShellType {
+		config.Config.Cmd = []string{"/bin/sh", "-c", strings.Join(info.CMD, " ")}
+	}
+	for _, port := range info.Expose {
+		if config.Config.ExposedPorts == nil {
+			config.Config.ExposedPorts = map[string]struct{}{}
+		}
+		if !strings.Contains(port, "/") {
+			port += "/tcp"
+		}
+		config.Config.ExposedPorts[port] = struct{}{}
+	}
+	for _, volume := range info.Volume {
+		if config.Config.Volumes == nil {
+			config.Config.Volumes = map[string]struct{}{}
+		}
+		config.Config.Volumes[volume] = struct{}{}
+	}
+	for _, label := range info.Label {
+		if config.Config.Labels == nil {
+			config.Config.Labels = map[string]string{}
+		}
+		key, value, _ := strings.Cut(label, "=")
+		config.Config.Labels[key] = value
+	}
+	if h := info.HealthCheck; h != nil {
+		config.Config.Healthcheck = &dockerHealthcheck{Test: h.Test, Interval: h.Interval, Timeout: h.Timeout, StartPeriod: h.StartPeriod, Retries: h.Retries}
+	}
+	// 每个镜像层对应一条历史记录，最后一条是这个镜像
+	for i := range layers {
+		history := ociHistory{Created: config.Created, CreatedBy: "mydocker"}
+		if i == len(layers)-1 {
+			history.Author, history.Comment = info.Author, info.Comment
+			if info.CreatedBy != "" {
+				history.CreatedBy = info.CreatedBy
+			}
+		}
+		config.History = append(config.History, history)
+	}
+	return config
+}
+
+// 导出的镜像名称，没有版本时使用 latest，返回完整名称和版本
+func exportReference(tag string) (string, string) {
+	name, version := parseReference(tag)
+	if version == "" {
+		version = "latest"
+	}
+	return name + ":" + version, version
+}
+
+// LoadImages 导入镜像归档，input 可以是 OCI 镜像目录，tar 文件或者 docker save 的归档，为空时从 stdin 读取 tar，进度写到 out
+func LoadImages(input string, stdin io.Reader, out io.Writer) ([]*ImageInfo, error) {
+	dir := input
+	if input == "" || !isDir(input) {
+		tmp, err := os.MkdirTemp("", "mydocker-load-")
+		if err != nil {
+			return nil, fmt.Errorf("创建临时目录失败 %v", err)
+		}
+		defer os.RemoveAll(tmp)
+		if err := untarArchive(input, stdin, tmp); err != nil {
+			return nil, err
+		}
+		dir = tmp
+	}
+	var images []*ImageInfo
+	var err error
+	switch {
+	case FileExist(filepath.Join(dir, dockerManifestFile)):
+		images, err = loadDockerArchive(dir, out)
+	case FileExist(filepath.Join(dir, ociIndexFile)):
+		images, err = loadOCILayout(dir, out)
+	default:
+		return nil, fmt.Errorf("%s 不是 OCI 镜像目录或者 docker save 的归档", input)
+	}
+	for _, info := range images {
+		LogEvent(ImageEvent, "load", info.Id, map[string]string{"name": imageReference(info)})
+	}
+	return images, err
+}
+
+// 解压镜像归档到临时目录，支持 gzip 压缩
+func untarArchive(input string, stdin io.Reader, dir string) error {
+	file := stdin
+	if input != "" {
+		f, err := os.Open(input)
+		if err != nil {
+			return fmt.Errorf("打开文件 %s 失败 %v", input, err)
+		}
+		defer f.Close()
+		file = f
+	}
+	reader, err := decompress(file)
+	if err != nil {
+		return fmt.Errorf("读取镜像归档失败 %v", err)
+	}
+	if err := UntarLayer(reader, dir); err != nil {
+		return fmt.Errorf("解压镜像归档失败 %v", err)
+	}
+	return nil
+}
+
+// 导入 docker save 的归档，镜像层可以是 <id>/layer.tar 或者 blobs 中的文件
+func loadDockerArchive(dir string, out io.Writer) ([]*ImageInfo, error) {
+	var manifest []dockerManifestEntry
+	if err := readJSONFile(archivePath(dir, dockerManifestFile), &manifest); err != nil {
+		return nil, err
+	}
+	var images []*ImageInfo
+	for _, entry := range manifest {
+		config, err := os.ReadFile(archivePath(dir, entry.Config))
+		if err != nil {
+			return images, fmt.Errorf("读取镜像配置失败 %v", err)
+		}
+		var layers []layerSource
+		for _, layer := range entry.Layers {
+			layers = append(layers, fileLayer(archivePath(dir, layer)))
+		}
+		info, err := importImage(config, layers, entry.RepoTags, out)
+		if err != nil {
+			return images, err
+		}
+		images = append(images, info)
+	}
+	return images, nil
+}
+
+// 导入 OCI 镜像目录，多平台镜像只导入当前平台的镜像
+func loadOCILayout(dir string, out io.Writer) ([]*ImageInfo, error) {
+	var index ociIndex
+	if err := readJSONFile(archivePath(dir, ociIndexFile), &index); err != nil {
+		return nil, err
+	}
+	var images []*ImageInfo
+	for _, desc := range index.Manifests {
+		var tags []string
+		if name := desc.Annotations[annotationImageName]; name != "" {
+			tags = append(tags, name)
+		} else if name := desc.Annotations[annotationRefName]; name != "" {
+			tags = append(tags, name)
+		}
+		manifest, err := resolveManifest(dir, desc)
+		if err != nil {
+			return images, err
+		}
+		config, err := readArchiveBlob(dir, manifest.Config.Digest)
+		if err != nil {
+			return images, err
+		}
+		var layers []layerSource
+		for _, layer := range manifest.Layers {
+			layerPath, err := archiveBlobPath(dir, layer.Digest)
+			if err != nil {
+				return images, err
+			}
+			layers = append(layers, fileLayer(layerPath))
+		}
+		info, err := importImage(config, layers, tags, out)
+		if err != nil {
+			return images, err
+		}
+		images = append(images, info)
+	}
+	return images, nil
+}
+
+// 读取描述符对应的 manifest，描述符是多平台镜像的 index 时选择当前平台的 manifest
+func resolveManifest(dir string, desc ociDescriptor) (*ociManifest, error) {
+	content, err := readArchiveBlob(dir, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	switch desc.MediaType {
+	case mediaTypeOCIManifest, mediaTypeDockerManifest:
+		var manifest ociManifest
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			return nil, fmt.Errorf("解析 manifest %s 失败 %v", desc.Digest, err)
+		}
+		return &manifest, nil
+	case mediaTypeOCIIndex, mediaTypeDockerManifestList:
+		var index ociIndex
+		if err := json.Unmarshal(content, &index); err != nil {
+			return nil, fmt.Errorf("解析 index %s 失败 %v", desc.Digest, err)
+		}
+		for _, m := range index.Manifests {
+			if m.Platform == nil || (m.Platform.OS == "linux" && m.Platform.Architecture == runtime.GOARCH) {
+				return resolveManifest(dir, m)
+			}
+		}
+		return nil, fmt.Errorf("镜像 %s 没有 linux/%s 平台的 manifest", desc.Digest, runtime.GOARCH)
+	default:
+		return nil, fmt.Errorf("不支持的 manifest 类型: %s", desc.MediaType)
+	}
+}
+
+// 导入的镜像层，可能被压缩
+type layerSource struct {
+	// 用于日志和错误信息
+	name string
+	open func() (io.ReadCloser, error)
+}
+
+// 归档中的镜像层文件
+func fileLayer(layerPath string) layerSource {
+	return layerSource{name: layerPath, open: func() (io.ReadCloser, error) {
+		return os.Open(layerPath)
+	}}
+}
+
+// 保存镜像层和镜像配置，tags 是镜像的名称
+// 镜像配置中记录了未压缩的镜像层的摘要，本地已经有的镜像层不再读取
+func importImage(content []byte, layers []layerSource, tags []string, out io.Writer) (*ImageInfo, error) {
+	var config ociImageConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("解析镜像配置失败 %v", err)
+	}
+	diffIds := config.RootFS.DiffIDs
+	if len(diffIds) > 0 && len(diffIds) != len(layers) {
+		return nil, fmt.Errorf("镜像配置中有 %d 个镜像层, manifest 中有 %d 个", len(diffIds), len(layers))
+	}
+	info := imageInfoFromConfig(&config)
+	for i, source := range layers {
+		if len(diffIds) > 0 && layerExists(diffIds[i]) {
+			fmt.Fprintf(out, "镜像层 %s 已经存在\n", diffIds[i])
+			info.Layers = append(info.Layers, diffIds[i])
+			continue
+		}
+		fmt.Fprintf(out, "导入镜像层 %s\n", source.name)
+		layer, err := importLayer(source)
+		if err != nil {
+			return nil, err
+		}
+		// 镜像配置中记录的是未压缩的镜像层的摘要
+		if len(diffIds) > 0 && diffIds[i] != layer {
+			return nil, fmt.Errorf("镜像层 %s 的摘要 %s 和镜像配置中的 %s 不一致", source.name, layer, diffIds[i])
+		}
+		info.Layers = append(info.Layers, layer)
+	}
+	for _, tag := range tags {
+		addImageTag(info, normalizeTag(tag))
+	}
+	if err := createImage(info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func importLayer(source layerSource) (string, error) {
+	file, err := source.open()
+	if err != nil {
+		return "", fmt.Errorf("读取镜像层 %s 失败 %v", source.name, err)
+	}
+	defer file.Close()
+	reader, err := decompress(file)
+	if err != nil {
+		return "", fmt.Errorf("读取镜像层 %s 失败 %v", source.name, err)
+	}
+	layer, err := CreateLayer(reader)
+	if err != nil {
+		return "", err
+	}
+	// 读完 tar 之后剩余的内容，下载的镜像层读到末尾时校验摘要
+	if _, err := io.Copy(io.Discard, file); err != nil {
+		return "", fmt.Errorf("读取镜像层 %s 失败 %v", source.name, err)
+	}
+	return layer, nil
+}
+
+// OCI 镜像配置转换为镜像信息，exec 格式的 Entrypoint 和 Cmd 直接使用
+func imageInfoFromConfig(config *ociImageConfig) *ImageInfo {
+	c := config.Config
+	info := &ImageInfo{
+		CreateTime: time.Now().Format("2006-01-02 15:04:05"),
+		Env:        c.Env,
+		EntryPoint: c.Entrypoint,
+		CMD:        c.Cmd,
+		WorkDir:    c.WorkingDir,
+		Author:     config.Author,
+		StopSignal: c.StopSignal,
+		Volume:     []string{},
+	}
+	if config.Created != nil && !config.Created.IsZero() {
+		info.CreateTime = config.Created.Local().Format("2006-01-02 15:04:05")
+	}
+	if info.WorkDir == "" {
+		info.WorkDir = "/"
+	}
+	for port := range c.ExposedPorts {
+		info.Expose = append(info.Expose, strings.TrimSuffix(port, "/tcp"))
+	}
+	for volume := range c.Volumes {
+		info.Volume = append(info.Volume, volume)
+	}
+	for key, value := range c.Labels {
+		info.Label = append(info.Label, key+"="+value)
+	}
+	sort.Strings(info.Expose)
+	sort.Strings(info.Volume)
+	sort.Strings(info.Label)
+	if h := c.Healthcheck; h != nil {
+		info.HealthCheck = &HealthConfig{Test: h.Test, Interval: h.Interval, Timeout: h.Timeout, StartPeriod: h.StartPeriod, Retries: h.Retries}
+	}
+	if n := len(config.History); n > 0 {
+		info.Comment = config.History[n-1].Comment
+	}
+	// 最后一条创建了镜像层的历史记录
+	for i := len(config.History) - 1; i >= 0; i-- {
+		if !config.History[i].EmptyLayer {
+			info.CreatedBy = config.History[i].CreatedBy
+			break
+		}
+	}
+	return info
+}
+
+// 解析导入的镜像名称，去掉 docker hub 的前缀，版本 latest 和没有版本相同
+func parseReference(reference string) (string, string) {
+	reference = strings.TrimPrefix(reference, "docker.io/")
+	reference = strings.TrimPrefix(reference, "library/")
+	if i := strings.Index(reference, "@"); i >= 0 {
+		reference = reference[:i]
+	}
+	name, version := reference, ""
+	if i := strings.LastIndex(reference, ":"); i > strings.LastIndex(reference, "/") {
+		name, version = reference[:i], reference[i+1:]
+	}
+	if version == "latest" {
+		version = ""
+	}
+	return name, version
+}
+
+// 归档中的路径，不能指向归档之外
+func archivePath(dir string, name string) string {
+	return filepath.Join(dir, filepath.Clean("/"+name))
+}
+
+func archiveBlobPath(dir string, digest string) (string, error) {
+	hexDigest, err := digestHex(digest)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, archiveBlobDir, hexDigest), nil
+}
+
+// 读取归档中的 blob 并校验摘要
+func readArchiveBlob(dir string, digest string) ([]byte, error) {
+	blobPath, err := archiveBlobPath(dir, digest)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(blobPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取 blob %s 失败 %v", digest, err)
+	}
+	sum := sha256.Sum256(content)
+	if DigestPrefix+hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("blob %s 的内容和摘要不一致", digest)
+	}
+	return content, nil
+}
+
+func readJSONFile(file string, v interface{}) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("读取 %s 失败 %v", filepath.Base(file), err)
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("解析 %s 失败 %v", filepath.Base(file), err)
+	}
+	return nil
+}
+
+func writeJSONFile(file string, v interface{}) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, content, 0644); err != nil {
+		return fmt.Errorf("写入 %s 失败 %v", filepath.Base(file), err)
+	}
+	return nil
+}
+
+// 打包目录为 tar 文件
+func tarDir(dir string, output string) error {
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	err = TarLayer(dir, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(output)
+	}
+	return err
+}
+
+func isDir(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && fi.IsDir()
+}
@@ -0,0 +1,50 @@
+package containers
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, file string, content []byte) {
+	t.Helper()
+	if err := os.WriteFile(file, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadImagesHardlinkEscape(t *testing.T) {
+	root := useTempImageStore(t)
+	outside := t.TempDir()
+	writeTestFile(t, filepath.Join(outside, "secret"), []byte("secret"))
+
+	// docker save 格式的归档，镜像层中通过指向目录之外的符号链接创建硬链接
+	archive := t.TempDir()
+	writeTestFile(t, filepath.Join(archive, "layer.tar"), maliciousLayer(t, outside))
+	config, _ := json.Marshal(&ociImageConfig{Architecture: "amd64", OS: "linux", RootFS: ociRootFS{Type: "layers"}})
+	writeTestFile(t, filepath.Join(archive, "config.json"), config)
+	manifest, _ := json.Marshal([]dockerManifestEntry{{Config: "config.json", RepoTags: []string{"evil:latest"}, Layers: []string{"layer.tar"}}})
+	writeTestFile(t, filepath.Join(archive, dockerManifestFile), manifest)
+
+	images, err := LoadImages(archive, nil, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "符号链接") {
+		t.Fatalf("导入带有逃逸硬链接的镜像应该返回错误, %v", err)
+	}
+	if len(images) != 0 || len(GetImageInfoList()) != 0 {
+		t.Errorf("不应该导入镜像")
+	}
+	// 解压失败的镜像层不保留在 blob 存储中
+	if entries, _ := os.ReadDir(filepath.Join(root, "blobs", "sha256")); len(entries) != 0 {
+		t.Errorf("blob 存储中不应该有文件: %d", len(entries))
+	}
+
+	// 归档本身是 tar 时同样检查
+	tarFile := filepath.Join(t.TempDir(), "evil.tar")
+	writeTestFile(t, tarFile, maliciousLayer(t, outside))
+	if _, err := LoadImages(tarFile, nil, io.Discard); err == nil || !strings.Contains(err.Error(), "符号链接") {
+		t.Fatalf("解压带有逃逸硬链接的归档应该返回错误, %v", err)
+	}
+}
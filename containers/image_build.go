@@ -2,46 +2,64 @@ package containers
 
 import (
 	"bufio"
+	"compress/gzip"
+	"dockerfile"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path"
+	"sort"
 	"strings"
 	"text/tabwriter"
 	"time"
 )
 
-func BuildBaseImage(imageTarUrl string) {
-	if !FileExist(imageTarUrl) {
-		log.Printf("文件不存在:%s\n", imageTarUrl)
+// BuildBaseImage 导入 tar 包为基础镜像
+func BuildBaseImage(imageTarUrl string) (*ImageInfo, error) {
+	file, err := os.Open(imageTarUrl)
+	if err != nil {
+		return nil, fmt.Errorf("文件不存在:%s", imageTarUrl)
 	}
-	// 删除原先的基础镜像信息
-	err := os.RemoveAll(BaseImageUrl)
+	defer file.Close()
+	reader, err := decompress(file)
 	if err != nil {
-		log.Printf("删除基础镜像信息失败: %v\n", err)
-		return
+		return nil, fmt.Errorf("读取文件 %s 失败 %v", imageTarUrl, err)
 	}
-	err = os.MkdirAll(BaseImageLayerLocation, 0622)
+	// tar 包作为基础镜像唯一的镜像层，相同的 tar 包得到相同的镜像层
+	layer, err := CreateLayer(reader)
 	if err != nil {
-		log.Printf("创建目录失败 %s  %v\n", BaseImageLayerLocation, err)
-		return
+		return nil, fmt.Errorf("导入镜像层失败 %v", err)
 	}
-	storeBaseImageInfo()
-	// 解压文件，tar包
-	if _, err := exec.Command("tar", "-xvf", imageTarUrl, "-C", BaseImageLayerLocation).CombinedOutput(); err != nil {
-		log.Printf("解压目录 dir %s 失败 %v\n", BaseImageLayerLocation, err)
-		return
+	info := baseImageInfo()
+	info.Layers = []string{layer}
+	info.CreatedBy = "buildBase " + imageTarUrl
+	// 重新导入时，原先的基础镜像失去名称，使用它的容器不受影响
+	if err := createImage(info); err != nil {
+		return nil, fmt.Errorf("记录基础镜像信息失败 %v", err)
 	}
+	LogEvent(ImageEvent, "import", info.Id, map[string]string{"name": GetBaseImageId(), "file": imageTarUrl, "layer": layer})
+	return info, nil
+}
 
+// 使用 gzip 压缩的 tar 包先解压缩
+func decompress(r io.Reader) (io.Reader, error) {
+	reader := bufio.NewReader(r)
+	magic, err := reader.Peek(4)
+	if len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(reader)
+	}
+	if err == nil && string(magic) == "\x28\xb5\x2f\xfd" {
+		return nil, fmt.Errorf("不支持 zstd 压缩")
+	}
+	return reader, nil
 }
 
-// 存储基础镜像信息
-func storeBaseImageInfo() {
-	info := ImageInfo{
+// 基础镜像信息
+func baseImageInfo() *ImageInfo {
+	return &ImageInfo{
 		Name:                GetBaseImageId(),
-		Id:                  GetBaseImageId(),
 		CreateTime:          time.Now().Format("2006-01-02 15:04:05"),
 		EntryPoint:          []string{"sh", "-c"},
 		EntryPointShellType: false,
@@ -51,7 +69,6 @@ func storeBaseImageInfo() {
 		Volume:              []string{},
 		WorkDir:             "/",
 	}
-	recordImageInfo(&info)
 }
 
 func recordImageInfo(info *ImageInfo) {
@@ -82,21 +99,31 @@ func recordImageInfo(info *ImageInfo) {
 		log.Printf("写入镜像信息失败: %v", err)
 	}
 }
-func ListImageInfo() {
+
+// ListImageInfo 以表格的形式输出镜像信息
+func ListImageInfo(images []*ImageInfo) {
 	// 格式化并输出
 	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
 	fmt.Fprint(w, "ID\tNAME\tVERSION\tFROM\tEXPOSE\tCREATED\n")
-	for _, item := range GetImageInfoList() {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
-			item.Id,
-			item.Name,
-			item.Version,
-			item.From,
-			item.Expose,
-			item.CreateTime)
+	// 有多个名称的镜像每个名称输出一行
+	for _, item := range images {
+		tags := imageTags(item)
+		if len(tags) == 0 {
+			tags = []string{""}
+		}
+		for _, tag := range tags {
+			name, version := parseReference(tag)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				ShortImageId(item.Id),
+				name,
+				version,
+				item.From,
+				item.Expose,
+				item.CreateTime)
+		}
 	}
 	if err := w.Flush(); err != nil {
-		fmt.Errorf("Flush error %v\n", err)
+		log.Printf("Flush error %v\n", err)
 		return
 	}
 }
@@ -152,103 +179,78 @@ func GetImageInfo(imageId string) (*ImageInfo, error) {
 	return &info, nil
 }
 
-func readDockerFile(dockerFile string) []string {
-	if !FileExist(dockerFile) {
-		log.Fatalf("docker file 不存在: %s", dockerFile)
-		return []string{}
-	}
-	file, _ := os.Open(dockerFile)
-	r := bufio.NewReader(file)
-	var lines []string
-	for {
-		s, _, err := r.ReadLine()
-		// 读取结束
-		if err != nil {
-			break
-		}
-		lines = append(lines, string(s))
+// 解析 dockerfile，警告输出到 out
+func readDockerFile(dockerFile string, out io.Writer) (*dockerfile.File, error) {
+	file, err := os.Open(dockerFile)
+	if err != nil {
+		return nil, fmt.Errorf("docker file 不存在: %s", dockerFile)
 	}
-	// 合并多行
-	var resultLine []string
-	line := ""
-	for _, tempLine := range lines {
-		if tempLine == "" {
-			continue
-		}
-		if tempLine[len(tempLine)-1] != '\\' {
-			resultLine = append(resultLine, line+tempLine)
-			line = ""
-		} else {
-			line += tempLine[0 : len(tempLine)-1]
-		}
+	defer file.Close()
+	parsed, err := dockerfile.Parse(file)
+	if err != nil {
+		return nil, err
 	}
-	if line != "" {
-		resultLine = append(resultLine, line)
+	for _, warning := range parsed.Warnings {
+		fmt.Fprintf(out, "警告: %s\n", warning)
 	}
-	return resultLine
+	return parsed, nil
 }
-func BuildImage(tag string, dockerFile string) {
-	lines := readDockerFile(dockerFile)
-	if len(lines) == 0 {
-		log.Fatalln("dockerfile解析失败")
+
+// BuildImage 根据 dockerfile 构建镜像，ADD 和 COPY 的源路径相对于 contextDir，构建过程和 RUN 的输出写到 out
+func BuildImage(tag string, dockerFile string, contextDir string, out io.Writer) (*ImageInfo, error) {
+	parsed, err := readDockerFile(dockerFile, out)
+	if err != nil {
+		return nil, err
 	}
 	// 初始化 镜像信息
 	info := initImageInfo(tag)
 	// 初始化 dockerfile信息
 	d := initDockerFile()
-	for _, line := range lines {
-		log.Println(line)
-		switch {
-		case strings.HasPrefix(line, FROM):
-			d.from(line)
-		case strings.HasPrefix(line, RUN):
-			d.run(line)
-		case strings.HasPrefix(line, ADD):
-			d.add(line)
-		case strings.HasPrefix(line, COPY):
-			d.copy(line)
-		case strings.HasPrefix(line, EXPOSE):
-			d.expose(line)
-		case strings.HasPrefix(line, ENV):
-			d.env(line)
-		case strings.HasPrefix(line, CMD):
-			d.cmd(line)
-		case strings.HasPrefix(line, ENTRYPOINT):
-			d.entrypoint(line)
-		case strings.HasPrefix(line, VOLUME):
-			d.volume(line)
-		case strings.HasPrefix(line, WORKDIR):
-			d.workDir(line)
-		default:
-			continue
+	d.context, d.out = contextDir, out
+	// FROM 之外的指令，记录为镜像层的创建指令
+	var instructions []string
+	for _, inst := range parsed.Instructions {
+		fmt.Fprintln(out, inst.Source)
+		// FROM 之前只能使用 ARG 定义基础镜像中使用的参数
+		if d.Info == nil && inst.Command != dockerfile.From && inst.Command != dockerfile.Arg {
+			return nil, &dockerfile.Error{Line: inst.StartLine, Msg: "第一条指令必须是 FROM, FROM 之前只能使用 ARG"}
+		}
+		if err := d.apply(inst); err != nil {
+			return nil, err
+		}
+		if inst.Command != dockerfile.From {
+			instructions = append(instructions, inst.Source)
 		}
 	}
-	//创建镜像目录
-	if err := os.MkdirAll(fmt.Sprintf(ImageLayerLocation, info.Id), 0622); err != nil {
-		log.Fatalf("创建镜像目录失败: %v", err)
+	if d.Info == nil {
+		return nil, fmt.Errorf("dockerfile 中没有 FROM 指令")
 	}
 	//信息拷贝到 镜像信息中
 	d.copy2ImageInfo(info)
+	info.CreatedBy = strings.Join(instructions, "; ")
+	// 构建容器的 upper 目录保存为新的镜像层，叠加在基础镜像的镜像层之上
+	fmt.Fprintf(out, "保存 %s 为镜像层\n", path.Join(d.Info.BaseUrl, UPPER))
+	layers, err := upperLayers(d.Info)
+	if err != nil {
+		return nil, err
+	}
+	info.Layers = layers
 	//记录镜像的信息
-	recordImageInfo(info)
-	// 拷贝镜像的Upper内容到layer，新的镜像就完成了
-	Copy(path.Join(d.Info.BaseUrl, "upper")+"/*", fmt.Sprintf(ImageLayerLocation, info.Id))
+	if err := createImage(info); err != nil {
+		return nil, err
+	}
+	LogEvent(ImageEvent, "build", info.Id, map[string]string{"name": imageReference(info)})
 	// 移除临时容器
 	//RemoveContainer(d.Info.Id)
+	return info, nil
 }
 func initImageInfo(tag string) *ImageInfo {
-	//获取镜像id
-	imageId := ImageId()
+	// 镜像id 在记录镜像时根据镜像配置生成
 	info := &ImageInfo{
-		Id:         imageId,
 		CreateTime: time.Now().Format("2006-01-02 15:04:05"),
 		WorkDir:    "/",
 	}
-	tagSplits := strings.Split(tag, ":")
-	info.Name = tagSplits[0]
-	if len(tagSplits) == 2 {
-		info.Version = tagSplits[1]
-	}
+	info.Name, info.Version = parseReference(tag)
 	return info
 }
 func initDockerFile() *DockerFile {
@@ -260,35 +262,117 @@ func initDockerFile() *DockerFile {
 		CMD:        []string{},
 		EntryPoint: []string{},
 		Expose:     []string{},
+		Labels:     []string{},
+		Args:       map[string]string{},
+		out:        io.Discard,
 	}
 
 }
-func (d *DockerFile) from(f string) {
-	f = strings.TrimPrefix(f, FROM)
-	d.From = strings.Trim(f, " ")
-	d.Info = BuildFrom(d.From)
+
+// 执行一条指令，构建和 commit --change 共用
+func (d *DockerFile) apply(inst *dockerfile.Instruction) error {
+	switch inst.Command {
+	case dockerfile.From:
+		return d.from(inst)
+	case dockerfile.Run:
+		return d.run(inst)
+	case dockerfile.Add:
+		return d.add(inst, true)
+	case dockerfile.Copy:
+		return d.add(inst, false)
+	case dockerfile.Expose:
+		return d.expose(inst)
+	case dockerfile.Env:
+		return d.env(inst)
+	case dockerfile.Label:
+		return d.label(inst)
+	case dockerfile.Arg:
+		return d.arg(inst)
+	case dockerfile.Maintainer:
+		d.Author = inst.Original
+	case dockerfile.Cmd:
+		d.CMD, d.CMDShellType = shellOrExec(inst)
+	case dockerfile.Entrypoint:
+		d.EntryPoint, d.EntryPointShellType = shellOrExec(inst)
+	case dockerfile.Volume:
+		return d.volume(inst)
+	case dockerfile.Workdir:
+		return d.workDir(inst)
+	case dockerfile.StopSignal:
+		return d.stopSignal(inst)
+	case dockerfile.Healthcheck:
+		return d.healthCheck(inst)
+	default:
+		fmt.Fprintf(d.out, "暂不支持 %s 指令, 忽略第 %d 行\n", inst.Command, inst.StartLine)
+	}
+	return nil
+}
+
+// 变量替换时先查找 ENV 定义的环境变量，再查找 ARG 定义的构建参数
+func (d *DockerFile) lookup(name string) (string, bool) {
+	for i := len(d.Env) - 1; i >= 0; i-- {
+		if key, value, _ := strings.Cut(d.Env[i], "="); key == name {
+			return value, true
+		}
+	}
+	value, ok := d.Args[name]
+	return value, ok
 }
-func (d *DockerFile) run(r string) {
-	r = strings.TrimPrefix(r, RUN)
-	r, b := isArrayType(r)
+func (d *DockerFile) from(inst *dockerfile.Instruction) error {
+	if d.Info != nil {
+		return &dockerfile.Error{Line: inst.StartLine, Msg: "暂不支持多阶段构建"}
+	}
+	words, err := inst.Words(d.lookup)
+	if err != nil {
+		return err
+	}
+	d.From = words[0]
+	info, err := BuildFrom(d.From, d.out)
+	if err != nil {
+		return fmt.Errorf("启动基础镜像 %s 失败: %v", d.From, err)
+	}
+	d.Info = info
+	return nil
+}
+func (d *DockerFile) run(inst *dockerfile.Instruction) error {
 	cmd := &CommandArray{
 		WorkDir: d.WorkDir,
 	}
-	if b {
-		cmd.Cmds = parseArray(r)
+	if inst.JSON {
+		cmd.Cmds = inst.Args
 	} else {
-		cmd.Cmds = []string{"sh", "-c", strings.Join(parseCommandLine(r), " ")}
+		// shell 格式交给 sh 处理引号和变量
+		cmd.Cmds = []string{"sh", "-c", heredocScript(inst)}
 	}
-	BuildRun(d, cmd)
+	return BuildRun(d, cmd)
 }
-func (d *DockerFile) add(a string) {
-	a = strings.TrimPrefix(a, ADD)
-	a, b := isArrayType(a)
-	var list []string
-	if b {
-		list = parseArray(a)
-	} else {
-		list = parseCommandLine(a)
+
+// 带有 heredoc 的 RUN 拼接为 shell 脚本，只有一个 heredoc 时直接执行它的内容
+func heredocScript(inst *dockerfile.Instruction) string {
+	if len(inst.Heredocs) == 0 {
+		return inst.Original
+	}
+	if len(inst.Args) == 1 && len(inst.Heredocs) == 1 {
+		return inst.Heredocs[0].Content
+	}
+	script := inst.Original + "\n"
+	for _, heredoc := range inst.Heredocs {
+		script += heredoc.Content + heredoc.Name + "\n"
+	}
+	return script
+}
+
+// ADD 和 COPY，ADD 会自动解压 tar 归档文件
+func (d *DockerFile) add(inst *dockerfile.Instruction, extract bool) error {
+	if _, ok := inst.Flag("from"); ok {
+		return &dockerfile.Error{Line: inst.StartLine, Msg: inst.Command + " 暂不支持 --from"}
+	}
+	for _, flag := range inst.Flags {
+		fmt.Fprintf(d.out, "%s 暂不支持 --%s, 忽略\n", inst.Command, flag.Name)
+	}
+	list, err := inst.Words(d.lookup)
+	if err != nil {
+		return err
 	}
 	//最后一个是要拷贝到的地方
 	target := list[len(list)-1]
@@ -300,274 +384,233 @@ func (d *DockerFile) add(a string) {
 		//相对路径，此时要拼接workdir
 		cpTarget = path.Join(d.Info.BaseUrl, "merged", d.WorkDir, target)
 	}
-	pwd, _ := os.Getwd()
-	for i := 0; i < len(list)-1; i++ {
+	for _, src := range list[:len(list)-1] {
+		if heredoc := heredocSource(inst, src); heredoc != nil {
+			// heredoc 的内容写到目标文件，目标以 / 结尾时文件名为 heredoc 的名称
+			file := cpTarget
+			if strings.HasSuffix(target, "/") {
+				file = path.Join(cpTarget, heredoc.Name)
+			}
+			if err := d.writeHeredoc(heredoc, file); err != nil {
+				return err
+			}
+			continue
+		}
 		// 自动解压归档文件
-		if path.Ext(list[i]) == ".tar" {
-			UnTar(path.Join(pwd, list[i]), cpTarget)
+		if extract && path.Ext(src) == ".tar" {
+			UnTar(path.Join(d.context, src), cpTarget)
 		} else {
-			Copy(path.Join(pwd, list[i]), cpTarget)
+			Copy(path.Join(d.context, src), cpTarget)
 		}
 	}
+	return nil
 }
-func (d *DockerFile) copy(c string) {
-	c = strings.TrimPrefix(c, COPY)
-	c, b := isArrayType(c)
-	var list []string
-	if b {
-		list = parseArray(c)
-	} else {
-		list = parseCommandLine(c)
+
+// 源路径是 <<EOF 这样的 heredoc 时返回对应的 heredoc
+func heredocSource(inst *dockerfile.Instruction, src string) *dockerfile.Heredoc {
+	if !strings.HasPrefix(src, "<<") {
+		return nil
 	}
-	//最后一个是要拷贝到的地方
-	target := list[len(list)-1]
-	cpTarget := ""
-	//绝对路径
-	if strings.HasPrefix(target, "/") {
-		cpTarget = path.Join(d.Info.BaseUrl, "merged", target)
-	} else {
-		//相对路径，此时要拼接workdir
-		cpTarget = path.Join(d.Info.BaseUrl, "merged", d.WorkDir, target)
+	return inst.Heredoc(strings.TrimPrefix(src[2:], "-"))
+}
+func (d *DockerFile) writeHeredoc(heredoc *dockerfile.Heredoc, file string) error {
+	content, err := heredoc.Expanded(d.lookup)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		return fmt.Errorf("创建文件夹失败:%s, 原因: %v", path.Dir(file), err)
 	}
-	pwd, _ := os.Getwd()
-	for i := 0; i < len(list)-1; i++ {
-		// 拷贝文件
-		Copy(path.Join(pwd, list[i]), cpTarget)
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		return fmt.Errorf("写入文件失败:%s, 原因: %v", file, err)
 	}
+	return nil
 }
-func (d *DockerFile) expose(e string) {
-	e = strings.TrimPrefix(e, EXPOSE)
+func (d *DockerFile) expose(inst *dockerfile.Instruction) error {
 	// 端口列表
-	ports := parseCommandLine(e)
-	d.Expose = ports
-}
-func (d *DockerFile) env(e string) {
-	e = strings.TrimPrefix(e, ENV)
-	//去掉开头的空格
-	e = strings.Trim(e, " ")
-	d.Env = append(d.Env, parseEnv(e)...)
-}
-func (d *DockerFile) cmd(c string) {
-	c = strings.TrimPrefix(c, CMD)
-	c, b := isArrayType(c)
-	if b {
-		d.CMD = parseArray(c)
-		d.EntryPointShellType = false
-	} else {
-		d.CMD = parseCommandLine(c)
-		d.EntryPointShellType = true
+	ports, err := inst.Words(d.lookup)
+	if err != nil {
+		return err
 	}
+	d.Expose = append(d.Expose, ports...)
+	return nil
 }
-func (d *DockerFile) entrypoint(e string) {
-	e = strings.TrimPrefix(e, ENTRYPOINT)
-	e, b := isArrayType(e)
-	if b {
-		d.EntryPoint = parseArray(e)
-		d.EntryPointShellType = false
-	} else {
-		d.EntryPoint = parseCommandLine(e)
-		d.EntryPointShellType = true
+func (d *DockerFile) env(inst *dockerfile.Instruction) error {
+	kvs, err := inst.KeyValues(d.lookup)
+	if err != nil {
+		return err
 	}
+	for _, kv := range kvs {
+		d.Env = setKeyValue(d.Env, kv.Key, kv.Value)
+	}
+	return nil
 }
-func (d *DockerFile) volume(v string) {
-	v = strings.TrimPrefix(v, VOLUME)
-	d.Volumes = parseCommandLine(v)
-}
-func (d *DockerFile) workDir(w string) {
-	w = strings.TrimPrefix(w, WORKDIR)
-	d.WorkDir = strings.Trim(path.Clean(w), " ")
+func (d *DockerFile) label(inst *dockerfile.Instruction) error {
+	kvs, err := inst.KeyValues(d.lookup)
+	if err != nil {
+		return err
+	}
+	for _, kv := range kvs {
+		d.Labels = setKeyValue(d.Labels, kv.Key, kv.Value)
+	}
+	return nil
 }
-
-func (d *DockerFile) copy2ImageInfo(info *ImageInfo) {
-	info.WorkDir = d.WorkDir
-	info.From = d.From
-	info.Env = d.Env
-	info.Volume = d.Volumes
-	info.CMD = d.CMD
-	info.EntryPoint = d.EntryPoint
-	info.EntryPointShellType = d.EntryPointShellType
-	info.CMDShellType = d.CMDShellType
-	info.Expose = d.Expose
+func (d *DockerFile) arg(inst *dockerfile.Instruction) error {
+	kvs, err := inst.KeyValues(d.lookup)
+	if err != nil {
+		return err
+	}
+	for _, kv := range kvs {
+		// 没有默认值的 ARG 和 docker 一样保持未设置，变量替换时 ${FOO-默认值} 使用默认值，也不传给 RUN
+		if kv.HasValue {
+			d.Args[kv.Key] = kv.Value
+		}
+	}
+	return nil
 }
 
-// 判断是否是数组类型
-func isArrayType(s string) (string, bool) {
-	s = strings.Trim(s, " ")
-	if s[0] == '[' {
-		return s, true
+// RUN 的环境变量，ARG 定义的有值的构建参数也传给 RUN，ENV 设置了同名变量时使用 ENV 的值
+// 构建参数不保存到镜像的环境变量中
+func (d *DockerFile) runEnv() []string {
+	env := append([]string{}, d.Env...)
+	keys := make([]string, 0, len(d.Args))
+	for key := range d.Args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !hasKey(d.Env, key) {
+			env = append(env, key+"="+d.Args[key])
+		}
 	}
-	return s, false
+	return env
 }
 
-// 解析 ["a","b"] 类型
-func parseArray(s string) []string {
-	le := len(s)
-	var array []string
-	for i := 0; i < le; {
-		if s[i] == '[' || s[i] == ',' {
-			i++
-			continue
-		}
-		if s[i] == '"' && i+1 < le {
-			if s[i+1] == '"' {
-				i += 2
-				continue
-			}
-			j := i + 1
-			for ; j < le; j++ {
-				if s[j] == '"' && s[j-1] != '\\' {
-					array = append(array, s[i+1:j])
-					break
-				}
-			}
-			i = j + 1
-			continue
+// key=value 列表中是否有 key
+func hasKey(list []string, key string) bool {
+	for _, item := range list {
+		if k, _, _ := strings.Cut(item, "="); k == key {
+			return true
 		}
-		if s[i] == ']' {
-			break
-		}
-		i++
-
 	}
-	return array
+	return false
 }
 
-// 解析  非数组类型
-func parseCommandLine(s string) []string {
-	le := len(s)
-	var cmd []string
-	for i := 0; i < le; {
-		if s[i] == ' ' {
-			for i < le {
-				if s[i] == ' ' {
-					i++
-				} else {
-					break
-				}
-			}
-			continue
-		}
-		if s[i] == '"' && i+1 < le {
-			if s[i+1] == '"' {
-				i += 2
-				continue
-			}
-			j := i + 1
-			for ; j < le; j++ {
-				if s[j] == '"' && s[j-1] != '\\' {
-					cmd = append(cmd, s[i+1:j])
-					break
-				}
-			}
-			i = j + 1
-			continue
+// 设置 key=value 列表中的值，已经存在时覆盖
+func setKeyValue(list []string, key string, value string) []string {
+	for i, item := range list {
+		if k, _, _ := strings.Cut(item, "="); k == key {
+			list[i] = key + "=" + value
+			return list
 		}
-		j := i + 1
-		for j < le {
-			if s[j] == ' ' || s[j] == '"' {
-				break
-			} else {
-				j++
-			}
-		}
-		cmd = append(cmd, s[i:j])
-		i = j
 	}
-	return cmd
+	return append(list, key+"="+value)
 }
 
-func parseEnv(s string) []string {
-	//先根据第一个key 后面的字符是 空格 还是 = 判断是 单环境变量 还是多环境变量
-	singleEnv := true
-	i := 0
-	for i = 0; i < len(s); i++ {
-		if s[i] == ' ' {
-			break
-		} else if s[i] == '=' {
-			singleEnv = false
-			break
-		}
+// CMD 和 ENTRYPOINT，shell 格式保存原始的命令文本，运行时通过 sh -c 执行
+func shellOrExec(inst *dockerfile.Instruction) ([]string, bool) {
+	if inst.JSON {
+		return inst.Args, false
 	}
-	if singleEnv {
-		return []string{s[0:i] + "=" + s[i+1:]}
-	}
-	var env []string
-	l := 0
-	for i < len(s) {
-		key := s[l : i+1]
-		i++
-		l = i
-		//解析value
-		for i < len(s) {
-			//跳出字符串
-			if s[i] == '"' {
-				i++
-				for i < len(s) {
-					if s[i] == '"' {
-						i++
-						break
-					}
-					i++
-				}
-			}
-			if i == len(s) {
-				break
-			}
-			if s[i] == ' ' && s[i-1] == '\\' {
-				i++
-				continue
-			}
-			if i < len(s) && s[i] == ' ' {
-				break
-			}
-			i++
-		}
-		// 反斜杠加空格 表示空格，这里进行还原
-		env = append(env, key+strings.ReplaceAll(s[l:i], "\\ ", " "))
-		// 解析key
-		for i < len(s) && s[i] == ' ' {
-			i++
-		}
-		l = i
-		for i < len(s) && s[i] != '=' {
-			i++
-		}
+	return []string{inst.Original}, true
+}
+func (d *DockerFile) volume(inst *dockerfile.Instruction) error {
+	volumes, err := inst.Words(d.lookup)
+	if err != nil {
+		return err
 	}
-	return env
+	d.Volumes = append(d.Volumes, volumes...)
+	return nil
+}
+func (d *DockerFile) workDir(inst *dockerfile.Instruction) error {
+	words, err := inst.Words(d.lookup)
+	if err != nil {
+		return err
+	}
+	// 相对路径相对于之前的工作目录
+	w := words[0]
+	if !path.IsAbs(w) {
+		w = path.Join(d.WorkDir, w)
+	}
+	d.WorkDir = path.Clean(w)
+	return nil
+}
+func (d *DockerFile) stopSignal(inst *dockerfile.Instruction) error {
+	words, err := inst.Words(d.lookup)
+	if err != nil {
+		return err
+	}
+	if _, err := ParseSignal(words[0]); err != nil {
+		return fmt.Errorf("STOPSIGNAL %v", err)
+	}
+	d.StopSignal = words[0]
+	return nil
+}
 
+func (d *DockerFile) copy2ImageInfo(info *ImageInfo) {
+	info.WorkDir = d.WorkDir
+	info.From = d.From
+	info.Env = d.Env
+	info.Volume = d.Volumes
+	info.CMD = d.CMD
+	info.EntryPoint = d.EntryPoint
+	info.EntryPointShellType = d.EntryPointShellType
+	info.CMDShellType = d.CMDShellType
+	info.Expose = d.Expose
+	info.StopSignal = d.StopSignal
+	info.HealthCheck = d.HealthCheck
+	info.Label = d.Labels
+	info.Author = d.Author
 }
 
+// ResolveImageId 根据镜像名称或者id查找镜像，找不到或者匹配多个镜像时返回空字符串
 func ResolveImageId(idOrName string, justName bool) string {
+	imageId, _ := resolveImageId(idOrName, justName)
+	return imageId
+}
+
+// FindImageId 根据镜像名称或者id查找镜像，找不到或者匹配多个镜像时返回错误
+func FindImageId(idOrName string) (string, error) {
+	return resolveImageId(idOrName, false)
+}
+
+// 先匹配镜像的所有名称，名称中的 docker.io/library/ 前缀和 latest 版本可以省略，再匹配镜像id 的前缀
+func resolveImageId(idOrName string, justName bool) (string, error) {
 	infoList := GetImageInfoList()
-	// 先从名称匹配
+	tag := idOrName
+	if !strings.Contains(tag, "@") {
+		tag = normalizeTag(tag)
+	}
 	var matched []string
 	for _, info := range infoList {
-		infoName := info.Name
-		if info.Version != "" {
-			infoName += ":" + info.Version
-		}
-		if infoName == idOrName {
-			matched = append(matched, info.Id)
+		for _, infoTag := range imageTags(info) {
+			if infoTag == tag {
+				matched = append(matched, info.Id)
+				break
+			}
 		}
 	}
-	if len(matched) > 1 {
-		return ""
-	}
-	if len(matched) == 1 {
-		return matched[0]
-	}
-	if !justName {
+	if len(matched) == 0 && !justName {
+		// 镜像id 可以带上摘要算法
+		prefix := strings.TrimPrefix(idOrName, DigestPrefix)
 		for _, info := range infoList {
-			if strings.HasPrefix(info.Id, idOrName) {
+			if info.Id == prefix {
+				return info.Id, nil
+			}
+			if prefix != "" && strings.HasPrefix(info.Id, prefix) {
 				matched = append(matched, info.Id)
 			}
 		}
-		if (len(matched)) > 1 {
-			return ""
-		}
-		if len(matched) == 1 {
-			return matched[0]
+	}
+	switch len(matched) {
+	case 0:
+		return "", fmt.Errorf("镜像不存在: %s", idOrName)
+	case 1:
+		return matched[0], nil
+	default:
+		for i := range matched {
+			matched[i] = ShortImageId(matched[i])
 		}
+		return "", fmt.Errorf("镜像标识 %s 匹配多个镜像: %s", idOrName, strings.Join(matched, ", "))
 	}
-	return ""
 }
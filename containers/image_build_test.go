@@ -0,0 +1,32 @@
+package containers
+
+import (
+	"dockerfile"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 有值的 ARG 传给 RUN，ENV 设置了同名变量时使用 ENV 的值，构建参数不保存到镜像中
+func TestBuildRunEnv(t *testing.T) {
+	parsed, err := dockerfile.Parse(strings.NewReader("ARG V=1\nARG W=2\nARG UNSET\nARG EMPTY=\nENV W=3 A=$V B=${UNSET-dflt}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := initDockerFile()
+	for _, inst := range parsed.Instructions {
+		if err := d.apply(inst); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 没有值的 ARG 不传给 RUN，值为空的 ARG 传给 RUN
+	expected := []string{"W=3", "A=1", "B=dflt", "EMPTY=", "V=1"}
+	if env := d.runEnv(); !reflect.DeepEqual(env, expected) {
+		t.Errorf("RUN 的环境变量为 %q, 期望 %q", env, expected)
+	}
+	info := &ImageInfo{}
+	d.copy2ImageInfo(info)
+	if !reflect.DeepEqual(info.Env, []string{"W=3", "A=1", "B=dflt"}) {
+		t.Errorf("镜像的环境变量为 %q, 不应该包含构建参数", info.Env)
+	}
+}
@@ -0,0 +1,110 @@
+package containers
+
+import (
+	"dockerfile"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// CommitContainer 将容器的 upper 层提交为新的镜像
+// changes 为 dockerfile 格式的指令，用于覆盖 CMD/ENTRYPOINT/ENV/EXPOSE/LABEL/VOLUME/WORKDIR/STOPSIGNAL/HEALTHCHECK
+func CommitContainer(idOrName string, tag string, changes []string, author string, message string) (*ImageInfo, error) {
+	containerId := ResolveContainerId(idOrName, false)
+	if containerId == "" {
+		return nil, fmt.Errorf("容器标识: %s 不存在", idOrName)
+	}
+	info, err := GetContainerInfo(containerId)
+	if err != nil {
+		return nil, fmt.Errorf("获取容器信息失败: %v", err)
+	}
+	if info.Image == "" {
+		return nil, fmt.Errorf("容器 %s 没有记录使用的镜像", containerId)
+	}
+	fromImage, err := GetImageInfo(info.Image)
+	if err != nil {
+		return nil, fmt.Errorf("获取容器镜像 %s 失败: %v", info.Image, err)
+	}
+	// 以容器镜像的配置作为初始值，再应用 --change 中的指令
+	d := dockerFileFromImage(fromImage)
+	for _, change := range changes {
+		if err := d.applyChange(change); err != nil {
+			return nil, err
+		}
+	}
+	image := initImageInfo(tag)
+	d.copy2ImageInfo(image)
+	image.From = imageReference(fromImage)
+	image.Author = author
+	image.Comment = message
+	image.CreatedBy = info.Command
+	layers, err := upperLayers(info)
+	if err != nil {
+		return nil, err
+	}
+	image.Layers = layers
+	if err := createImage(image); err != nil {
+		return nil, err
+	}
+	LogContainerEvent(info, "commit", map[string]string{"imageId": image.Id, "imageName": imageReference(image)})
+	return image, nil
+}
+
+// 根据已有的镜像生成 DockerFile，镜像的配置作为默认值
+func dockerFileFromImage(info *ImageInfo) *DockerFile {
+	d := initDockerFile()
+	d.WorkDir = info.WorkDir
+	d.Env = append(d.Env, info.Env...)
+	d.Volumes = append(d.Volumes, info.Volume...)
+	d.Expose = append(d.Expose, info.Expose...)
+	d.CMD = append(d.CMD, info.CMD...)
+	d.CMDShellType = info.CMDShellType
+	d.EntryPoint = append(d.EntryPoint, info.EntryPoint...)
+	d.EntryPointShellType = info.EntryPointShellType
+	d.StopSignal = info.StopSignal
+	d.HealthCheck = info.HealthCheck
+	d.Labels = append(d.Labels, info.Label...)
+	return d
+}
+
+// commit --change 支持的指令
+var changeInstructions = map[string]bool{
+	dockerfile.Cmd: true, dockerfile.Entrypoint: true, dockerfile.Env: true, dockerfile.Expose: true, dockerfile.Label: true,
+	dockerfile.Volume: true, dockerfile.Workdir: true, dockerfile.StopSignal: true, dockerfile.Healthcheck: true,
+}
+
+// 应用 commit --change 中的单条指令
+func (d *DockerFile) applyChange(change string) error {
+	parsed, err := dockerfile.Parse(strings.NewReader(change))
+	if err != nil {
+		return fmt.Errorf("commit --change 解析失败: %v", err)
+	}
+	if len(parsed.Instructions) != 1 || !changeInstructions[parsed.Instructions[0].Command] {
+		return fmt.Errorf("commit 不支持的指令: %s", change)
+	}
+	return d.apply(parsed.Instructions[0])
+}
+
+// 镜像的引用名称，有名称时使用 name:version，否则使用镜像id
+func imageReference(info *ImageInfo) string {
+	if info.Name == "" {
+		return info.Id
+	}
+	if info.Version != "" {
+		return info.Name + ":" + info.Version
+	}
+	return info.Name
+}
+
+// 容器的 upper 目录保存为镜像层，返回容器镜像的镜像层加上这一层
+func upperLayers(info *ContainerInfo) ([]string, error) {
+	fromLayers, err := ImageLayers(info.Image)
+	if err != nil {
+		return nil, err
+	}
+	layer, err := CreateLayerFromDir(path.Join(info.BaseUrl, UPPER))
+	if err != nil {
+		return nil, fmt.Errorf("保存镜像层失败: %v", err)
+	}
+	return append(append([]string{}, fromLayers...), layer), nil
+}
@@ -0,0 +1,313 @@
+package containers
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"registry"
+	"strings"
+)
+
+// ImageHistory 镜像历史中的一个镜像层
+type ImageHistory struct {
+	// 创建这个镜像层的镜像，一个镜像创建了多个镜像层时只有最上面的镜像层记录镜像
+	Id         string `json:"id"`
+	CreateTime string `json:"createTime"`
+	CreatedBy  string `json:"createdBy"`
+	Comment    string `json:"comment"`
+	// 镜像层的摘要，镜像没有创建镜像层时为空
+	Layer string `json:"layer"`
+	// 未压缩的镜像层 tar 的大小
+	Size int64 `json:"size"`
+}
+
+// ImageDeleteResult rmi 的结果，每个元素是去掉的一个名称或者删除的一个镜像
+type ImageDeleteResult struct {
+	Untagged string `json:"untagged,omitempty"`
+	Deleted  string `json:"deleted,omitempty"`
+}
+
+// TagImage 给镜像加上新的名称，其他镜像上的同名名称被去掉
+func TagImage(source string, target string) error {
+	ref, err := registry.ParseReference(target)
+	if err != nil {
+		return err
+	}
+	if ref.Digest != "" {
+		return fmt.Errorf("镜像名称不能指定摘要: %s", target)
+	}
+	imageId, err := FindImageId(source)
+	if err != nil {
+		return err
+	}
+	migrateLegacyImages()
+	info, err := GetImageInfo(imageId)
+	if err != nil {
+		return fmt.Errorf("获取镜像 %s 失败 %v", source, err)
+	}
+	tag := normalizeTag(target)
+	untagImages(tag, info.Id)
+	addImageTag(info, tag)
+	recordImageInfo(info)
+	LogEvent(ImageEvent, "tag", info.Id, map[string]string{"name": tag})
+	return nil
+}
+
+// RemoveImage 删除镜像，按名称删除并且镜像还有其他名称时只去掉这个名称
+// 镜像有多个名称，被容器使用或者是其他镜像的基础镜像时需要 force
+// 被容器使用的镜像 force 时只去掉镜像的所有名称，容器删除后可以使用 image prune 删除
+func RemoveImage(idOrName string, force bool) ([]*ImageDeleteResult, error) {
+	imageId, err := FindImageId(idOrName)
+	if err != nil {
+		return nil, err
+	}
+	migrateLegacyImages()
+	info, err := GetImageInfo(imageId)
+	if err != nil {
+		return nil, fmt.Errorf("获取镜像 %s 失败 %v", idOrName, err)
+	}
+	tags := imageTags(info)
+	if tag := normalizeTag(idOrName); len(tags) > 1 && removeImageTag(info, tag) {
+		recordImageInfo(info)
+		LogEvent(ImageEvent, "untag", info.Id, map[string]string{"name": tag})
+		return []*ImageDeleteResult{{Untagged: tag}}, nil
+	}
+	usedBy := imageContainers(info.Id)
+	children := childImages(info.Id)
+	if !force {
+		if len(tags) > 1 {
+			return nil, fmt.Errorf("镜像 %s 有多个名称 %s, 需要使用 -f 删除", idOrName, strings.Join(tags, ", "))
+		}
+		if len(usedBy) > 0 {
+			return nil, fmt.Errorf("镜像 %s 正在被容器 %s 使用, 需要使用 -f 删除", idOrName, strings.Join(usedBy, ", "))
+		}
+		if len(children) > 0 {
+			return nil, fmt.Errorf("镜像 %s 是镜像 %s 的基础镜像, 需要使用 -f 删除", idOrName, strings.Join(children, ", "))
+		}
+	}
+	var result []*ImageDeleteResult
+	for _, tag := range tags {
+		result = append(result, &ImageDeleteResult{Untagged: tag})
+		LogEvent(ImageEvent, "untag", info.Id, map[string]string{"name": tag})
+	}
+	info.Name, info.Version, info.Tags = "", "", nil
+	if len(usedBy) > 0 {
+		// 容器启动时需要镜像的镜像层，镜像保留为没有名称的镜像
+		recordImageInfo(info)
+		log.Printf("镜像 %s 正在被容器 %s 使用, 只去掉镜像的名称\n", ShortImageId(info.Id), strings.Join(usedBy, ", "))
+		return result, nil
+	}
+	if _, err := deleteImage(info); err != nil {
+		return result, err
+	}
+	return append(result, &ImageDeleteResult{Deleted: info.Id}), nil
+}
+
+// PruneImages 删除没有名称，没有被容器使用，也不是其他镜像的基础镜像的镜像，返回删除的镜像和回收的空间
+// 基础镜像的子镜像都被删除后，没有名称的基础镜像也会被删除
+func PruneImages() ([]string, int64, error) {
+	migrateLegacyImages()
+	var deleted []string
+	var reclaimed int64
+	for {
+		var dangling []*ImageInfo
+		for _, info := range GetImageInfoList() {
+			if len(imageTags(info)) == 0 && len(imageContainers(info.Id)) == 0 && len(childImages(info.Id)) == 0 {
+				dangling = append(dangling, info)
+			}
+		}
+		if len(dangling) == 0 {
+			return deleted, reclaimed, nil
+		}
+		for _, info := range dangling {
+			size, err := deleteImage(info)
+			if err != nil {
+				return deleted, reclaimed, err
+			}
+			deleted = append(deleted, info.Id)
+			reclaimed += size
+		}
+	}
+}
+
+// 删除镜像的信息和镜像配置，没有其他镜像使用的镜像层一起删除，返回删除的镜像层的大小
+func deleteImage(info *ImageInfo) (int64, error) {
+	if err := os.RemoveAll(fmt.Sprintf(ImageInfoLocation, info.Id)); err != nil {
+		return 0, fmt.Errorf("删除镜像 %s 失败 %v", info.Id, err)
+	}
+	// 之前版本的镜像 id 不是镜像配置的摘要，没有保存镜像配置
+	if configPath, err := BlobPath(DigestPrefix + info.Id); err == nil {
+		_ = os.Remove(configPath)
+	}
+	LogEvent(ImageEvent, "delete", info.Id, nil)
+	used := map[string]bool{}
+	for _, other := range GetImageInfoList() {
+		for _, layer := range other.Layers {
+			used[layer] = true
+		}
+	}
+	var reclaimed int64
+	for _, layer := range info.Layers {
+		if used[layer] {
+			continue
+		}
+		used[layer] = true
+		reclaimed += layerSize(layer)
+		blobPath, err := BlobPath(layer)
+		if err != nil {
+			continue
+		}
+		layerDir, _ := LayerDir(layer)
+		if err := os.RemoveAll(layerDir); err != nil {
+			log.Printf("删除镜像层目录 %s 失败 %v\n", layerDir, err)
+			continue
+		}
+		if err := os.Remove(blobPath); err != nil {
+			log.Printf("删除镜像层 %s 失败 %v\n", layer, err)
+		}
+	}
+	return reclaimed, nil
+}
+
+// 使用镜像的容器的名称，没有名称的容器使用容器id
+func imageContainers(imageId string) []string {
+	var names []string
+	for _, info := range GetContainerInfoList() {
+		if info.Image != imageId {
+			continue
+		}
+		if info.Name != "" {
+			names = append(names, info.Name)
+		} else {
+			names = append(names, info.Id)
+		}
+	}
+	return names
+}
+
+// 以镜像为基础镜像的镜像，没有名称的镜像使用短的镜像id
+// 镜像的镜像层以这个镜像的所有镜像层开头并且更多时是它的子镜像，不依赖 From 中记录的名称，
+// 基础镜像被重新命名或者名称被其他镜像使用之后仍然能找到，之前版本没有 Layers 的镜像才按照 From 查找
+func childImages(imageId string) []string {
+	parent, err := GetImageInfo(imageId)
+	if err != nil {
+		return nil
+	}
+	var children []string
+	for _, info := range GetImageInfoList() {
+		if info.Id == imageId {
+			continue
+		}
+		if len(parent.Layers) > 0 && info.Layers != nil {
+			if len(info.Layers) <= len(parent.Layers) || !isLayerPrefix(parent.Layers, info.Layers) {
+				continue
+			}
+		} else if info.From == "" || ResolveImageId(info.From, false) != imageId {
+			continue
+		}
+		if info.Name != "" {
+			children = append(children, imageReference(info))
+		} else {
+			children = append(children, ShortImageId(info.Id))
+		}
+	}
+	return children
+}
+
+// 基础镜像的名称变化之后，之前版本的镜像按照 From 找不到原来的基础镜像，先把它们的层目录保存为镜像层
+func migrateLegacyImages() {
+	for _, info := range GetImageInfoList() {
+		if info.Layers != nil {
+			continue
+		}
+		if _, err := ImageLayers(info.Id); err != nil {
+			log.Printf("迁移镜像 %s 失败 %v\n", info.Id, err)
+		}
+	}
+}
+
+// GetImageHistory 按照镜像层找到镜像的所有基础镜像，从上到下列出每个镜像层，创建它的指令和大小
+func GetImageHistory(idOrName string) ([]*ImageHistory, error) {
+	imageId, err := FindImageId(idOrName)
+	if err != nil {
+		return nil, err
+	}
+	var history []*ImageHistory
+	for visited := map[string]bool{}; imageId != "" && !visited[imageId]; {
+		visited[imageId] = true
+		info, err := GetImageInfo(imageId)
+		if err != nil {
+			return nil, fmt.Errorf("获取镜像 %s 失败 %v", imageId, err)
+		}
+		layers, err := ImageLayers(imageId)
+		if err != nil {
+			return nil, err
+		}
+		parentId, parentLayers := parentImage(info, layers)
+		own := layers[len(parentLayers):]
+		top := &ImageHistory{Id: info.Id, CreateTime: info.CreateTime, CreatedBy: info.CreatedBy, Comment: info.Comment}
+		if len(own) == 0 {
+			history = append(history, top)
+		}
+		for i := len(own) - 1; i >= 0; i-- {
+			entry := &ImageHistory{}
+			if i == len(own)-1 {
+				entry = top
+			}
+			entry.Layer, entry.Size = own[i], layerSize(own[i])
+			history = append(history, entry)
+		}
+		imageId = parentId
+	}
+	return history, nil
+}
+
+// 镜像的基础镜像，和 childImages 相同按照镜像层查找，镜像层是 layers 的最长的真前缀的镜像是基础镜像，
+// 基础镜像被重新命名之后仍然能找到，有多个这样的镜像时优先使用 From 指向的镜像，
+// 之前版本没有 Layers 的镜像找不到时按照 From 查找，基础镜像被删除时返回空字符串
+func parentImage(info *ImageInfo, layers []string) (string, []string) {
+	fromId := ""
+	if info.From != "" {
+		fromId = ResolveImageId(info.From, false)
+	}
+	parentId, parentLayers := "", []string(nil)
+	for _, other := range GetImageInfoList() {
+		if other.Id == info.Id || len(other.Layers) == 0 || len(other.Layers) >= len(layers) || !isLayerPrefix(other.Layers, layers) {
+			continue
+		}
+		if len(other.Layers) > len(parentLayers) || (len(other.Layers) == len(parentLayers) && other.Id == fromId) {
+			parentId, parentLayers = other.Id, other.Layers
+		}
+	}
+	if parentId == "" && info.Layers == nil && fromId != "" && fromId != info.Id {
+		if fromLayers, err := ImageLayers(fromId); err == nil && isLayerPrefix(fromLayers, layers) {
+			return fromId, fromLayers
+		}
+	}
+	return parentId, parentLayers
+}
+
+func isLayerPrefix(prefix []string, layers []string) bool {
+	if len(prefix) > len(layers) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != layers[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 未压缩的镜像层 tar 的大小
+func layerSize(layer string) int64 {
+	blobPath, err := BlobPath(layer)
+	if err != nil {
+		return 0
+	}
+	stat, err := os.Stat(blobPath)
+	if err != nil {
+		return 0
+	}
+	return stat.Size()
+}
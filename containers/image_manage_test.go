@@ -0,0 +1,56 @@
+package containers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testImage(t *testing.T, tag string, from string, layers ...string) *ImageInfo {
+	t.Helper()
+	info := initImageInfo(tag)
+	info.From = from
+	info.Layers = layers
+	if err := createImage(info); err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+// 基础镜像的名称变化之后仍然按照镜像层找到子镜像
+func TestChildImages(t *testing.T) {
+	useTempImageStore(t)
+	l1, l2, l3 := DigestPrefix+strings.Repeat("1", 64), DigestPrefix+strings.Repeat("2", 64), DigestPrefix+strings.Repeat("3", 64)
+	parent := testImage(t, "app:v1", "", l1)
+	child := testImage(t, "child", "app:v1", l1, l2)
+	// 基础镜像的名称被新的镜像使用，原来的基础镜像没有名称
+	other := testImage(t, "app:v1", "", l3)
+	if children := childImages(parent.Id); !reflect.DeepEqual(children, []string{imageReference(child)}) {
+		t.Errorf("子镜像为 %v, 期望 %s", children, imageReference(child))
+	}
+	if children := childImages(other.Id); len(children) != 0 {
+		t.Errorf("使用了同名名称的镜像不应该有子镜像: %v", children)
+	}
+	// history 按照镜像层找到被重新命名的基础镜像
+	history, err := GetImageHistory(child.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids, layers []string
+	for _, entry := range history {
+		ids, layers = append(ids, entry.Id), append(layers, entry.Layer)
+	}
+	if !reflect.DeepEqual(ids, []string{child.Id, parent.Id}) || !reflect.DeepEqual(layers, []string{l2, l1}) {
+		t.Errorf("history 为 %v %v", ids, layers)
+	}
+	if _, err := RemoveImage(parent.Id, false); err == nil || !strings.Contains(err.Error(), "child") {
+		t.Errorf("有子镜像时不加 -f 不能删除, %v", err)
+	}
+
+	// 之前版本没有 Layers 的镜像按照 From 查找
+	legacy := &ImageInfo{Id: strings.Repeat("4", 64), Name: "legacy", From: "child"}
+	recordImageInfo(legacy)
+	if children := childImages(child.Id); !reflect.DeepEqual(children, []string{"legacy"}) {
+		t.Errorf("子镜像为 %v, 期望 legacy", children)
+	}
+}
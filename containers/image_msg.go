@@ -1,5 +1,7 @@
 package containers
 
+import "io"
+
 type ImageInfo struct {
 	Id                  string   `json:"id"`                  //镜像id
 	Name                string   `json:"name"`                //镜像name
@@ -15,16 +17,29 @@ type ImageInfo struct {
 	CMD                 []string `json:"cmd"`                 // CMD
 	CMDShellType        bool     `json:"CMDShellType"`        // cmd是shell类型还是exec类型
 	WorkDir             string   `json:"workDir"`             // workDir
+	Author              string   `json:"author"`              // 镜像作者，commit 时指定
+	Comment             string   `json:"comment"`             // 提交说明，commit 时指定
+	StopSignal          string   `json:"stopSignal"`          // 停止容器时发送的信号
+	// 健康检查的配置
+	HealthCheck *HealthConfig `json:"healthCheck"`
+	// 镜像层的摘要，从下到上排列，第一个是基础镜像的最底层
+	Layers []string `json:"layers"`
+	// 镜像的其他名称，格式为 名称[:版本]，Name 和 Version 是镜像的第一个名称
+	Tags []string `json:"tags"`
+	// 创建这个镜像的镜像层的指令
+	CreatedBy string `json:"createdBy"`
 }
 
 var (
 	// ImageInfoLocation %s 是镜像的标识
 	ImageInfoLocation = "/var/run/mydocker/images/%s/"
-	// ImageLayerLocation 镜像目录
-	ImageLayerLocation     = AllImageLocation + "%s/layer/"
-	AllImageLocation       = "/var/run/mydocker/images/"
-	BaseImageUrl           = AllImageLocation + "base/"
-	BaseImageLayerLocation = BaseImageUrl + "layer/"
+	// ImageLayerLocation 之前版本保存镜像层的目录，镜像层现在保存在 AllLayerLocation 中
+	ImageLayerLocation = AllImageLocation + "%s/layer/"
+	AllImageLocation   = "/var/run/mydocker/images/"
+	// AllBlobLocation blob 存储，镜像层 tar 和镜像配置以 sha256 摘要命名
+	AllBlobLocation = "/var/run/mydocker/blobs/sha256/"
+	// AllLayerLocation 解压后的镜像层，以镜像层 tar 的 sha256 摘要命名，作为 overlay 的只读层
+	AllLayerLocation = "/var/run/mydocker/layers/sha256/"
 	// ImageConfigName 存储镜像信息
 	ImageConfigName = "config.json"
 )
@@ -42,16 +57,19 @@ type DockerFile struct {
 	Volumes             []string
 	// 工作目录
 	WorkDir string
-	Info    *ContainerInfo // 构建过程中使用的容器的信息
+	// 停止容器时发送的信号
+	StopSignal string
+	// 健康检查的配置
+	HealthCheck *HealthConfig
+	// LABEL 指令设置的标签，格式为 key=value
+	Labels []string
+	// MAINTAINER 指令设置的作者
+	Author string
+	// ARG 指令定义的构建参数，只在构建过程中使用，不保存到镜像
+	Args map[string]string
+	Info *ContainerInfo // 构建过程中使用的容器的信息
+	// 构建上下文目录，ADD 和 COPY 的源路径相对于这个目录
+	context string
+	// 构建过程和 RUN 指令的输出
+	out io.Writer
 }
-
-const FROM = "FROM"
-const RUN = "RUN"
-const ADD = "ADD"
-const COPY = "COPY"
-const EXPOSE = "EXPOSE"
-const ENV = "ENV"
-const CMD = "CMD"
-const ENTRYPOINT = "ENTRYPOINT"
-const VOLUME = "VOLUME"
-const WORKDIR = "WORKDIR"
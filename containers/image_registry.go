@@ -0,0 +1,163 @@
+package containers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"registry"
+	"runtime"
+)
+
+// PullImage 从仓库拉取镜像，多平台镜像只拉取当前平台的镜像，本地已经有的镜像层不再下载，进度写到 out
+func PullImage(name string, options *registry.Options, out io.Writer) (*ImageInfo, error) {
+	ref, err := registry.ParseReference(name)
+	if err != nil {
+		return nil, err
+	}
+	client, err := registry.NewClient(ref.Domain, options)
+	if err != nil {
+		return nil, err
+	}
+	manifest, digest, err := pullManifest(client, ref)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(out, "%s 的 manifest 摘要为 %s\n", ref, digest)
+	config, err := pullBlob(client, ref, manifest.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	var layers []layerSource
+	for _, layer := range manifest.Layers {
+		layerDigest := layer.Digest
+		layers = append(layers, layerSource{name: layerDigest, open: func() (io.ReadCloser, error) {
+			return client.GetBlob(ref, layerDigest)
+		}})
+	}
+	info, err := importImage(config, layers, []string{ref.String()}, out)
+	if err != nil {
+		return nil, err
+	}
+	LogEvent(ImageEvent, "pull", info.Id, map[string]string{"name": ref.String(), "digest": digest})
+	return info, nil
+}
+
+// 获取镜像的 manifest，多平台镜像的 index 中选择当前平台的 manifest
+func pullManifest(client *registry.Client, ref *registry.Reference) (*ociManifest, string, error) {
+	content, mediaType, digest, err := client.GetManifest(ref)
+	if err != nil {
+		return nil, "", err
+	}
+	switch mediaType {
+	case registry.MediaTypeOCIManifest, registry.MediaTypeDockerManifest:
+		var manifest ociManifest
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			return nil, "", fmt.Errorf("解析 %s 的 manifest 失败 %v", ref, err)
+		}
+		return &manifest, digest, nil
+	case registry.MediaTypeOCIIndex, registry.MediaTypeDockerManifestList:
+		var index ociIndex
+		if err := json.Unmarshal(content, &index); err != nil {
+			return nil, "", fmt.Errorf("解析 %s 的 index 失败 %v", ref, err)
+		}
+		for _, m := range index.Manifests {
+			if m.Platform != nil && m.Platform.OS == "linux" && m.Platform.Architecture == runtime.GOARCH {
+				platformRef := *ref
+				platformRef.Digest = m.Digest
+				return pullManifest(client, &platformRef)
+			}
+		}
+		return nil, "", fmt.Errorf("%s 没有 linux/%s 平台的镜像", ref, runtime.GOARCH)
+	default:
+		return nil, "", fmt.Errorf("%s 的 manifest 类型 %s 不支持", ref, mediaType)
+	}
+}
+
+func pullBlob(client *registry.Client, ref *registry.Reference, digest string) ([]byte, error) {
+	blob, err := client.GetBlob(ref, digest)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+	content, err := io.ReadAll(blob)
+	if err != nil {
+		return nil, fmt.Errorf("下载 blob %s 失败 %v", digest, err)
+	}
+	return content, nil
+}
+
+// PushImage 推送镜像到仓库，target 为空时使用镜像的名称
+// 镜像层使用 gzip 压缩后分块上传，仓库中已经存在的镜像层跳过，进度写到 out
+func PushImage(name string, target string, options *registry.Options, out io.Writer) error {
+	imageId, err := FindImageId(name)
+	if err != nil {
+		return err
+	}
+	info, err := GetImageInfo(imageId)
+	if err != nil {
+		return fmt.Errorf("获取镜像 %s 失败 %v", name, err)
+	}
+	if target == "" {
+		if info.Name == "" {
+			return fmt.Errorf("镜像 %s 没有名称，需要指定推送的名称", name)
+		}
+		target = imageReference(info)
+	}
+	ref, err := registry.ParseReference(target)
+	if err != nil {
+		return err
+	}
+	if ref.Digest != "" {
+		return fmt.Errorf("推送的名称不能指定摘要: %s", target)
+	}
+	client, err := registry.NewClient(ref.Domain, options)
+	if err != nil {
+		return err
+	}
+	// 先在临时目录中生成 manifest，镜像配置和压缩后的镜像层，和 save 相同
+	dir, err := os.MkdirTemp("", "mydocker-push-")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败 %v", err)
+	}
+	defer os.RemoveAll(dir)
+	layout := &imageLayout{dir: dir, layers: map[string]ociDescriptor{}}
+	desc, _, err := layout.writeImage(info)
+	if err != nil {
+		return err
+	}
+	content, err := readArchiveBlob(dir, desc.Digest)
+	if err != nil {
+		return err
+	}
+	var manifest ociManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return err
+	}
+	for _, blob := range append(manifest.Layers, manifest.Config) {
+		fmt.Fprintf(out, "上传 %s\n", blob.Digest)
+		if err := pushBlob(client, ref, dir, blob); err != nil {
+			return err
+		}
+	}
+	digest, err := client.PutManifest(ref, manifest.MediaType, content)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s: digest: %s size: %d\n", ref, digest, len(content))
+	LogEvent(ImageEvent, "push", info.Id, map[string]string{"name": ref.String(), "digest": digest})
+	return nil
+}
+
+func pushBlob(client *registry.Client, ref *registry.Reference, dir string, blob ociDescriptor) error {
+	blobPath, err := archiveBlobPath(dir, blob.Digest)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(blobPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return client.UploadBlob(ref, blob.Digest, blob.Size, file)
+}
@@ -0,0 +1,61 @@
+package containers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"registry"
+	"strings"
+	"testing"
+)
+
+// 仓库中的镜像摘要都是正确的，镜像层中通过指向目录之外的符号链接创建硬链接
+func TestPullImageHardlinkEscape(t *testing.T) {
+	useTempImageStore(t)
+	outside := t.TempDir()
+	writeTestFile(t, filepath.Join(outside, "secret"), []byte("secret"))
+
+	layer := maliciousLayer(t, outside)
+	layerDigest := registry.Digest(layer)
+	config, _ := json.Marshal(&ociImageConfig{Architecture: "amd64", OS: "linux",
+		RootFS: ociRootFS{Type: "layers", DiffIDs: []string{layerDigest}}})
+	manifest, _ := json.Marshal(&ociManifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeOCIManifest,
+		Config:        ociDescriptor{MediaType: mediaTypeOCIConfig, Digest: registry.Digest(config), Size: int64(len(config))},
+		Layers:        []ociDescriptor{{MediaType: "application/vnd.oci.image.layer.v1.tar", Digest: layerDigest, Size: int64(len(layer))}},
+	})
+	blobs := map[string][]byte{registry.Digest(config): config, layerDigest: layer}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/evil/manifests/latest":
+			w.Header().Set("Content-Type", mediaTypeOCIManifest)
+			w.Write(manifest)
+		case strings.HasPrefix(r.URL.Path, "/v2/evil/blobs/"):
+			blob, ok := blobs[strings.TrimPrefix(r.URL.Path, "/v2/evil/blobs/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(blob)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	options := &registry.Options{Insecure: true, AuthFile: filepath.Join(t.TempDir(), "auth.json")}
+	host := strings.TrimPrefix(server.URL, "http://")
+	_, err := PullImage(host+"/evil", options, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "符号链接") {
+		t.Fatalf("拉取带有逃逸硬链接的镜像应该返回错误, %v", err)
+	}
+	if len(GetImageInfoList()) != 0 {
+		t.Errorf("不应该保存镜像")
+	}
+	if layerExists(layerDigest) {
+		t.Errorf("解压失败的镜像层不应该保留在 blob 存储中")
+	}
+}
@@ -0,0 +1,154 @@
+package containers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// 镜像的 id 是镜像配置的 sha256 摘要，镜像层是 blob 存储中的 tar，镜像配置中按从下到上的顺序记录镜像层的摘要
+// 相同的镜像层在镜像之间共享，只保存和解压一次
+
+// shortImageIdLength 列表中展示的镜像 id 的长度
+const shortImageIdLength = 12
+
+// ShortImageId 镜像 id 的前 12 位，用于列表展示
+func ShortImageId(id string) string {
+	if len(id) > shortImageIdLength {
+		return id[:shortImageIdLength]
+	}
+	return id
+}
+
+// 保存镜像配置到 blob 存储，使用配置的摘要作为镜像的 id，并记录镜像信息
+// 名称和版本不属于镜像的配置，其他镜像上的同名名称被去掉，没有其他名称的镜像成为没有名称的镜像
+func createImage(info *ImageInfo) error {
+	config := *info
+	config.Id, config.Name, config.Version, config.Tags = "", "", "", nil
+	content, err := json.Marshal(&config)
+	if err != nil {
+		return fmt.Errorf("序列化镜像配置失败 %v", err)
+	}
+	digest, err := WriteBlob(bytes.NewReader(content))
+	if err != nil {
+		return fmt.Errorf("保存镜像配置失败 %v", err)
+	}
+	info.Id = strings.TrimPrefix(digest, DigestPrefix)
+	// 已经有相同配置的镜像时保留它原来的名称
+	if FileExist(fmt.Sprintf(ImageInfoLocation, info.Id) + ImageConfigName) {
+		if existing, err := GetImageInfo(info.Id); err == nil {
+			for _, tag := range imageTags(existing) {
+				addImageTag(info, tag)
+			}
+		}
+	}
+	for _, tag := range imageTags(info) {
+		untagImages(tag, info.Id)
+	}
+	recordImageInfo(info)
+	return nil
+}
+
+// 去掉 id 之外的其他镜像上的名称 tag
+func untagImages(tag string, id string) {
+	for _, other := range GetImageInfoList() {
+		if other.Id == id || !removeImageTag(other, tag) {
+			continue
+		}
+		recordImageInfo(other)
+		LogEvent(ImageEvent, "untag", other.Id, map[string]string{"name": tag})
+	}
+}
+
+// 镜像的所有名称，格式为 名称[:版本]，第一个是 Name 和 Version
+func imageTags(info *ImageInfo) []string {
+	var tags []string
+	if info.Name != "" {
+		tags = append(tags, imageReference(info))
+	}
+	return append(tags, info.Tags...)
+}
+
+// 规范化镜像名称，去掉 docker hub 的前缀，版本 latest 和没有版本相同
+func normalizeTag(reference string) string {
+	name, version := parseReference(reference)
+	if version == "" {
+		return name
+	}
+	return name + ":" + version
+}
+
+// 给镜像加上名称，镜像没有名称时作为 Name 和 Version
+func addImageTag(info *ImageInfo, tag string) {
+	for _, existing := range imageTags(info) {
+		if existing == tag {
+			return
+		}
+	}
+	if info.Name == "" {
+		info.Name, info.Version = parseReference(tag)
+		return
+	}
+	info.Tags = append(info.Tags, tag)
+}
+
+// 去掉镜像的名称，去掉的是 Name 和 Version 时使用下一个名称，返回镜像是否有这个名称
+func removeImageTag(info *ImageInfo, tag string) bool {
+	if info.Name != "" && imageReference(info) == tag {
+		info.Name, info.Version = "", ""
+		if len(info.Tags) > 0 {
+			info.Name, info.Version = parseReference(info.Tags[0])
+			info.Tags = info.Tags[1:]
+		}
+		return true
+	}
+	for i, existing := range info.Tags {
+		if existing == tag {
+			info.Tags = append(info.Tags[:i:i], info.Tags[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ImageLayers 镜像的镜像层摘要，从下到上排列
+// 之前版本创建的镜像没有记录镜像层，按照 From 找到基础镜像，把每个镜像的层目录保存为镜像层
+func ImageLayers(imageId string) ([]string, error) {
+	return imageLayers(imageId, map[string]bool{})
+}
+
+func imageLayers(imageId string, visited map[string]bool) ([]string, error) {
+	info, err := GetImageInfo(imageId)
+	if err != nil {
+		return nil, fmt.Errorf("镜像 %s 不存在", imageId)
+	}
+	if info.Layers != nil {
+		return info.Layers, nil
+	}
+	if visited[imageId] {
+		return nil, fmt.Errorf("镜像 %s 的基础镜像循环引用", imageId)
+	}
+	visited[imageId] = true
+	var layers []string
+	if info.From != "" {
+		fromId := ResolveImageId(info.From, false)
+		if fromId == "" {
+			return nil, fmt.Errorf("基础镜像不存在: %s", info.From)
+		}
+		if layers, err = imageLayers(fromId, visited); err != nil {
+			return nil, err
+		}
+	}
+	layerDir := fmt.Sprintf(ImageLayerLocation, imageId)
+	log.Printf("保存镜像 %s 的层目录 %s\n", imageId, layerDir)
+	layer, err := CreateLayerFromDir(layerDir)
+	if err != nil {
+		return nil, fmt.Errorf("保存镜像 %s 的层目录失败: %v", imageId, err)
+	}
+	// 复制一份，避免和基础镜像共用底层数组
+	info.Layers = append(append([]string{}, layers...), layer)
+	recordImageInfo(info)
+	return info.Layers, nil
+}
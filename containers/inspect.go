@@ -0,0 +1,114 @@
+package containers
+
+import (
+	"cgroups"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// ContainerInspect inspect 容器时输出的信息，包括记录的容器信息以及计算出来的信息
+type ContainerInspect struct {
+	*ContainerInfo
+	// overlay 文件系统的目录
+	Overlay OverlayInfo `json:"overlay"`
+	// 容器在各个 subsystem 中的 cgroup 目录，key 是 subsystem 名称，容器没有运行时为空
+	CgroupPaths map[string]string `json:"cgroupPaths"`
+}
+
+// OverlayInfo 容器 overlay 文件系统的目录
+type OverlayInfo struct {
+	// 只读层，依次为镜像以及镜像的基础镜像的层目录
+	LowerDirs []string `json:"lowerDirs"`
+	UpperDir  string   `json:"upperDir"`
+	WorkDir   string   `json:"workDir"`
+	MergedDir string   `json:"mergedDir"`
+}
+
+// ImageInspect inspect 镜像时输出的信息
+type ImageInspect struct {
+	*ImageInfo
+	// 镜像层的目录，和 overlay 的 lowerdir 顺序相同，从上到下排列
+	LayerDirs []string `json:"layerDirs"`
+}
+
+// VolumeInspect inspect 卷时输出的信息，卷的信息记录在使用卷的容器中
+type VolumeInspect struct {
+	// 匿名卷是卷id，绑定挂载是宿主机上的目录
+	Name string `json:"name"`
+	// 卷在宿主机上的目录
+	Mountpoint string `json:"mountpoint"`
+	Anonymous  bool   `json:"anonymous"`
+	// 使用卷的容器
+	Containers []VolumeContainer `json:"containers"`
+}
+
+// VolumeContainer 使用卷的容器
+type VolumeContainer struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// 卷在容器中的路径
+	ContainerPath string `json:"containerPath"`
+}
+
+// InspectContainer 获取容器的详细信息
+func InspectContainer(info *ContainerInfo) *ContainerInspect {
+	result := &ContainerInspect{
+		ContainerInfo: info,
+		Overlay: OverlayInfo{
+			LowerDirs: strings.Split(getLowerDir(info.Image), ":"),
+			UpperDir:  path.Join(info.BaseUrl, UPPER),
+			WorkDir:   path.Join(info.BaseUrl, WORK),
+			MergedDir: path.Join(info.BaseUrl, MERGED),
+		},
+		CgroupPaths: map[string]string{},
+	}
+	if info.SetCgroup {
+		result.CgroupPaths = cgroups.NewCgroupManager(cgroups.RooutCgroupPath + info.Id).Paths()
+	}
+	return result
+}
+
+// InspectImage 获取镜像的详细信息
+func InspectImage(info *ImageInfo) *ImageInspect {
+	return &ImageInspect{
+		ImageInfo: info,
+		LayerDirs: strings.Split(getLowerDir(info.Id), ":"),
+	}
+}
+
+// InspectVolume 根据匿名卷的id或者宿主机目录获取卷的信息
+func InspectVolume(name string) (*VolumeInspect, error) {
+	var result *VolumeInspect
+	for _, info := range GetContainerInfoList() {
+		for _, v := range info.Volume {
+			volumeName := v.HostVolumePath
+			if v.Anonymous {
+				volumeName = path.Base(path.Clean(v.HostVolumePath))
+			}
+			if volumeName != name && path.Clean(v.HostVolumePath) != path.Clean(name) {
+				continue
+			}
+			if result == nil {
+				result = &VolumeInspect{Name: volumeName, Mountpoint: v.HostVolumePath, Anonymous: v.Anonymous}
+			}
+			result.Containers = append(result.Containers, VolumeContainer{
+				Id:            info.Id,
+				Name:          info.Name,
+				ContainerPath: v.ContainerPath,
+			})
+		}
+	}
+	if result != nil {
+		return result, nil
+	}
+	// 没有容器使用的匿名卷
+	mountpoint := fmt.Sprintf(VolumeInfoLocation, name)
+	if name != "" && !strings.Contains(name, "/") {
+		if _, err := os.Stat(mountpoint); err == nil {
+			return &VolumeInspect{Name: name, Mountpoint: mountpoint, Anonymous: true, Containers: []VolumeContainer{}}, nil
+		}
+	}
+	return nil, fmt.Errorf("卷 %s 不存在", name)
+}
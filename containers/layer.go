@@ -0,0 +1,443 @@
+package containers
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DigestPrefix 镜像层和镜像配置的摘要算法，摘要的格式为 sha256:十六进制
+const DigestPrefix = "sha256:"
+
+// 镜像层 tar 中的 whiteout，和 OCI 镜像规范相同，解压时转换为 overlay 的 whiteout
+const (
+	// .wh.name 表示删除了下层的 name
+	whiteoutPrefix = ".wh."
+	// 目录中的 .wh..wh..opq 表示目录是 opaque 的，下层目录中的内容被隐藏
+	whiteoutOpaque = whiteoutPrefix + whiteoutPrefix + ".opq"
+	// overlay 的 opaque 目录的扩展属性
+	overlayOpaqueXattr = "trusted.overlay.opaque"
+)
+
+// 校验摘要的格式，返回十六进制部分
+func digestHex(digest string) (string, error) {
+	hexDigest := strings.TrimPrefix(digest, DigestPrefix)
+	if len(hexDigest) != sha256.Size*2 || len(hexDigest) == len(digest) {
+		return "", fmt.Errorf("摘要格式错误: %s", digest)
+	}
+	if _, err := hex.DecodeString(hexDigest); err != nil {
+		return "", fmt.Errorf("摘要格式错误: %s", digest)
+	}
+	return hexDigest, nil
+}
+
+// BlobPath blob 在 blob 存储中的路径
+func BlobPath(digest string) (string, error) {
+	hexDigest, err := digestHex(digest)
+	if err != nil {
+		return "", err
+	}
+	return AllBlobLocation + hexDigest, nil
+}
+
+// WriteBlob 把内容写入 blob 存储，返回内容的摘要，内容相同的 blob 只保存一份
+func WriteBlob(r io.Reader) (string, error) {
+	digest, _, err := writeBlobTo(AllBlobLocation, r)
+	return digest, err
+}
+
+// 把内容写入 dir 中以摘要命名的文件，返回摘要和内容的长度
+func writeBlobTo(dir string, r io.Reader) (string, int64, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, fmt.Errorf("创建目录 %s 失败 %v", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-")
+	if err != nil {
+		return "", 0, fmt.Errorf("创建临时文件失败 %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("写入 blob 失败 %v", err)
+	}
+	hexDigest := hex.EncodeToString(hash.Sum(nil))
+	// 已经存在时内容相同，直接替换
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, hexDigest)); err != nil {
+		return "", 0, fmt.Errorf("写入 blob 失败 %v", err)
+	}
+	return DigestPrefix + hexDigest, size, nil
+}
+
+// OpenBlob 打开 blob 存储中的 blob
+func OpenBlob(digest string) (*os.File, error) {
+	blobPath, err := BlobPath(digest)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(blobPath)
+	if err != nil {
+		return nil, fmt.Errorf("blob %s 不存在: %v", digest, err)
+	}
+	return file, nil
+}
+
+// LayerDir 镜像层解压后的目录，作为 overlay 的只读层
+func LayerDir(digest string) (string, error) {
+	hexDigest, err := digestHex(digest)
+	if err != nil {
+		return "", err
+	}
+	return AllLayerLocation + hexDigest, nil
+}
+
+// 本地是否已经有这个镜像层
+func layerExists(digest string) bool {
+	blobPath, err := BlobPath(digest)
+	return err == nil && FileExist(blobPath)
+}
+
+// CreateLayer 保存未压缩的镜像层 tar，并解压为 overlay 的只读层，返回 tar 的摘要
+// 摘要相同的镜像层只保存和解压一次，在镜像之间共享
+func CreateLayer(r io.Reader) (string, error) {
+	digest, err := WriteBlob(r)
+	if err != nil {
+		return "", err
+	}
+	if err := extractLayer(digest); err != nil {
+		// 解压失败的镜像层不保留，否则之后导入时会被当作已经存在的镜像层
+		if blobPath, pathErr := BlobPath(digest); pathErr == nil {
+			os.Remove(blobPath)
+		}
+		return "", err
+	}
+	return digest, nil
+}
+
+// CreateLayerFromDir 把 overlay 的 upper 目录打包为镜像层，返回镜像层的摘要
+func CreateLayerFromDir(dir string) (string, error) {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(TarLayer(dir, writer))
+	}()
+	digest, err := CreateLayer(reader)
+	// 保存失败时结束打包
+	reader.Close()
+	return digest, err
+}
+
+// 解压 blob 存储中的镜像层，已经解压过时直接返回
+func extractLayer(digest string) error {
+	dir, err := LayerDir(digest)
+	if err != nil {
+		return err
+	}
+	if FileExist(dir) {
+		return nil
+	}
+	blob, err := OpenBlob(digest)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	if err := os.MkdirAll(AllLayerLocation, 0755); err != nil {
+		return fmt.Errorf("创建目录 %s 失败 %v", AllLayerLocation, err)
+	}
+	// 先解压到临时目录，解压完成后再重命名，不会使用到解压了一半的镜像层
+	tmp, err := os.MkdirTemp(AllLayerLocation, ".tmp-")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败 %v", err)
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("修改目录 %s 权限失败 %v", tmp, err)
+	}
+	if err := UntarLayer(blob, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("解压镜像层 %s 失败: %v", digest, err)
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		os.RemoveAll(tmp)
+		// 其他进程同时解压了相同的镜像层
+		if FileExist(dir) {
+			return nil
+		}
+		return fmt.Errorf("保存镜像层 %s 失败 %v", digest, err)
+	}
+	return nil
+}
+
+// TarLayer 把目录打包为镜像层 tar，overlay 的 whiteout 和 opaque 目录转换为 OCI 格式的 whiteout
+// 不记录访问时间以及用户名，相同内容的目录打包的结果相同
+func TarLayer(dir string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	// 硬链接，inode 对应第一次出现的路径
+	links := map[uint64]string{}
+	err := filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		stat, _ := fi.Sys().(*syscall.Stat_t)
+		// overlay 的 whiteout 是设备号为 0 的字符设备
+		if fi.Mode()&os.ModeCharDevice != 0 && stat != nil && stat.Rdev == 0 {
+			return tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     path.Join(path.Dir(rel), whiteoutPrefix+fi.Name()),
+				Mode:     0600,
+				ModTime:  fi.ModTime().Truncate(time.Second),
+			})
+		}
+		var link string
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if fi.IsDir() {
+			header.Name += "/"
+		}
+		header.Uname, header.Gname = "", ""
+		header.ModTime = header.ModTime.Truncate(time.Second)
+		header.AccessTime, header.ChangeTime = time.Time{}, time.Time{}
+		if fi.Mode().IsRegular() && stat != nil && stat.Nlink > 1 {
+			if first, ok := links[stat.Ino]; ok {
+				header.Typeflag, header.Linkname, header.Size = tar.TypeLink, first, 0
+			} else {
+				links[stat.Ino] = rel
+			}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg {
+			return copyFileTo(tw, file)
+		}
+		if fi.IsDir() && isOpaqueDir(file) {
+			return tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     path.Join(rel, whiteoutOpaque),
+				Mode:     0600,
+				ModTime:  header.ModTime,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func copyFileTo(w io.Writer, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// 目录是否是 overlay 的 opaque 目录
+func isOpaqueDir(dir string) bool {
+	value := make([]byte, 1)
+	n, err := syscall.Getxattr(dir, overlayOpaqueXattr, value)
+	return err == nil && n == 1 && value[0] == 'y'
+}
+
+// UntarLayer 把镜像层 tar 解压到目录，OCI 格式的 whiteout 转换为 overlay 的 whiteout，保留文件的所有者，权限和修改时间
+func UntarLayer(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	type dirTime struct {
+		path    string
+		modTime time.Time
+	}
+	// 目录的修改时间在解压完所有文件之后设置
+	var dirs []dirTime
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// 去掉开头的 ./ 和 /，不能解压到目录之外
+		rel := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		if rel == "" {
+			if header.Typeflag == tar.TypeDir {
+				if err := os.Chmod(dir, header.FileInfo().Mode()); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := checkParents(dir, rel); err != nil {
+			return err
+		}
+		target := filepath.Join(dir, rel)
+		parent, base := filepath.Split(target)
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return err
+		}
+		if base == whiteoutOpaque {
+			if err := syscall.Setxattr(parent, overlayOpaqueXattr, []byte("y"), 0); err != nil {
+				return fmt.Errorf("设置 opaque 目录 %s 失败 %v", parent, err)
+			}
+			continue
+		}
+		if strings.HasPrefix(base, whiteoutPrefix) {
+			whiteout := filepath.Join(parent, strings.TrimPrefix(base, whiteoutPrefix))
+			if err := syscall.Mknod(whiteout, syscall.S_IFCHR, 0); err != nil {
+				return fmt.Errorf("创建 whiteout %s 失败 %v", whiteout, err)
+			}
+			continue
+		}
+		// 同一个层中后面的文件覆盖前面的文件，目录合并
+		if fi, err := os.Lstat(target); err == nil && !(fi.IsDir() && header.Typeflag == tar.TypeDir) {
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+		}
+		mode := header.FileInfo().Mode()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.Mkdir(target, 0755); err != nil && !os.IsExist(err) {
+				return err
+			}
+			dirs = append(dirs, dirTime{target, header.ModTime})
+		case tar.TypeReg, tar.TypeRegA:
+			if err := writeFileFrom(target, tr); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			source, err := linkSource(dir, header.Linkname)
+			if err != nil {
+				return fmt.Errorf("%s: %v", header.Name, err)
+			}
+			if err := os.Link(source, target); err != nil {
+				return err
+			}
+			continue
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			fileType := uint32(syscall.S_IFIFO)
+			if header.Typeflag == tar.TypeChar {
+				fileType = syscall.S_IFCHR
+			} else if header.Typeflag == tar.TypeBlock {
+				fileType = syscall.S_IFBLK
+			}
+			if err := syscall.Mknod(target, fileType|uint32(mode.Perm()), mkdev(header.Devmajor, header.Devminor)); err != nil {
+				return err
+			}
+		default:
+			// 不支持的类型，例如 GNU tar 的扩展类型
+			continue
+		}
+		if err := os.Lchown(target, header.Uid, header.Gid); err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeSymlink {
+			continue
+		}
+		// 修改所有者会清除 setuid，最后设置权限
+		if err := os.Chmod(target, mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeDir {
+			if err := os.Chtimes(target, header.ModTime, header.ModTime); err != nil {
+				return err
+			}
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chtimes(dirs[i].path, dirs[i].modTime, dirs[i].modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 解压的文件的上级目录不能是符号链接，否则可能写到目录之外
+func checkParents(dir string, rel string) error {
+	current := dir
+	parts := strings.Split(rel, "/")
+	for _, part := range parts[:len(parts)-1] {
+		current = filepath.Join(current, part)
+		fi, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s 的上级目录 %s 是符号链接", rel, current)
+		}
+	}
+	return nil
+}
+
+// 硬链接的源文件必须是已经解压到目录中的普通文件，上级目录不能是符号链接
+// os.Link 会跟随路径中间的符号链接，不检查时可以把宿主机上的文件链接到镜像层中
+func linkSource(dir string, linkname string) (string, error) {
+	rel := strings.TrimPrefix(path.Clean("/"+linkname), "/")
+	if rel == "" {
+		return "", fmt.Errorf("硬链接的源文件 %s 不能是根目录", linkname)
+	}
+	if err := checkParents(dir, rel); err != nil {
+		return "", err
+	}
+	source := filepath.Join(dir, rel)
+	fi, err := os.Lstat(source)
+	if err != nil {
+		return "", fmt.Errorf("硬链接的源文件 %s 不存在", linkname)
+	}
+	if !fi.Mode().IsRegular() {
+		return "", fmt.Errorf("硬链接的源文件 %s 不是普通文件", linkname)
+	}
+	return source, nil
+}
+
+func writeFileFrom(target string, r io.Reader) error {
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// 设备号，和 glibc 的 makedev 相同
+func mkdev(major int64, minor int64) int {
+	return int((minor & 0xff) | ((major & 0xfff) << 8) | ((minor &^ 0xff) << 12) | ((major &^ 0xfff) << 32))
+}
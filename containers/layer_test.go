@@ -0,0 +1,128 @@
+package containers
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 镜像存储和事件日志使用临时目录，测试结束后恢复
+func useTempImageStore(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	imageInfo, allImage, allBlob, allLayer := ImageInfoLocation, AllImageLocation, AllBlobLocation, AllLayerLocation
+	events, rotated := EventsLocation, EventsRotatedLocation
+	AllImageLocation = root + "/images/"
+	ImageInfoLocation = AllImageLocation + "%s/"
+	AllBlobLocation = root + "/blobs/sha256/"
+	AllLayerLocation = root + "/layers/sha256/"
+	EventsLocation = root + "/events.log"
+	EventsRotatedLocation = root + "/events.log.1"
+	t.Cleanup(func() {
+		ImageInfoLocation, AllImageLocation, AllBlobLocation, AllLayerLocation = imageInfo, allImage, allBlob, allLayer
+		EventsLocation, EventsRotatedLocation = events, rotated
+	})
+	return root
+}
+
+// 生成 tar，普通文件的内容为 body
+type tarEntry struct {
+	header tar.Header
+	body   string
+}
+
+func buildTar(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		header := entry.header
+		header.Size = int64(len(entry.body))
+		header.ModTime = time.Unix(0, 0)
+		if header.Mode == 0 {
+			header.Mode = 0644
+		}
+		if err := tw.WriteHeader(&header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// 符号链接指向目录之外，再通过符号链接创建硬链接，可以把目录之外的文件链接进来
+func maliciousLayer(t *testing.T, outside string) []byte {
+	return buildTar(t, []tarEntry{
+		{header: tar.Header{Name: "a", Typeflag: tar.TypeSymlink, Linkname: outside}},
+		{header: tar.Header{Name: "x", Typeflag: tar.TypeLink, Linkname: "a/secret"}},
+	})
+}
+
+func TestUntarLayerHardlink(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	err := UntarLayer(bytes.NewReader(maliciousLayer(t, outside)), dir)
+	if err == nil || !strings.Contains(err.Error(), "符号链接") {
+		t.Fatalf("通过符号链接的硬链接应该返回错误, %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "x")); !os.IsNotExist(err) {
+		t.Fatalf("不应该创建硬链接 x")
+	}
+
+	cases := map[string][]tarEntry{
+		"不存在": {
+			{header: tar.Header{Name: "x", Typeflag: tar.TypeLink, Linkname: "missing"}},
+		},
+		"不是普通文件": {
+			{header: tar.Header{Name: "d", Typeflag: tar.TypeDir, Mode: 0755}},
+			{header: tar.Header{Name: "x", Typeflag: tar.TypeLink, Linkname: "d"}},
+		},
+	}
+	for expected, entries := range cases {
+		err := UntarLayer(bytes.NewReader(buildTar(t, entries)), t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("错误为 %v, 期望包含 %s", err, expected)
+		}
+	}
+
+	// 目录中的普通文件可以创建硬链接
+	dir = t.TempDir()
+	layer := buildTar(t, []tarEntry{
+		{header: tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{header: tar.Header{Name: "etc/file", Typeflag: tar.TypeReg}, body: "hello"},
+		{header: tar.Header{Name: "link", Typeflag: tar.TypeLink, Linkname: "./etc/file"}},
+	})
+	if err := UntarLayer(bytes.NewReader(layer), dir); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(filepath.Join(dir, "link")); err != nil || string(content) != "hello" {
+		t.Errorf("硬链接的内容错误: %q %v", content, err)
+	}
+}
+
+// 解压失败的镜像层不保留在 blob 存储中
+func TestCreateLayerHardlinkEscape(t *testing.T) {
+	root := useTempImageStore(t)
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateLayer(bytes.NewReader(maliciousLayer(t, outside))); err == nil {
+		t.Fatalf("通过符号链接的硬链接应该返回错误")
+	}
+	if entries, _ := os.ReadDir(filepath.Join(root, "blobs", "sha256")); len(entries) != 0 {
+		t.Errorf("blob 存储中不应该有文件: %d", len(entries))
+	}
+}
@@ -0,0 +1,81 @@
+package containers
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// WindowSize 终端的窗口大小
+type WindowSize struct {
+	Height uint16 `json:"height"`
+	Width  uint16 `json:"width"`
+}
+
+// 对应内核的 struct winsize
+type winsize struct {
+	Row    uint16
+	Col    uint16
+	Xpixel uint16
+	Ypixel uint16
+}
+
+// OpenPty 创建一对伪终端，返回主设备和从设备
+// 从设备作为容器进程的标准输入输出以及控制终端，主设备由 shim 或者 daemon 持有，读取容器的输出，写入容器的输入
+func OpenPty() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("打开 /dev/ptmx 失败: %v", err)
+	}
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("解锁伪终端失败: %v", err)
+	}
+	var n uint32
+	if err := ioctl(master, syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("获取伪终端编号失败: %v", err)
+	}
+	name := fmt.Sprintf("/dev/pts/%d", n)
+	slave, err := os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("打开 %s 失败: %v", name, err)
+	}
+	return master, slave, nil
+}
+
+// GetWindowSize 获取终端的窗口大小，f 不是终端时返回错误
+func GetWindowSize(f *os.File) (*WindowSize, error) {
+	var ws winsize
+	if err := ioctl(f, syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))); err != nil {
+		return nil, err
+	}
+	return &WindowSize{Height: ws.Row, Width: ws.Col}, nil
+}
+
+// SetWindowSize 设置伪终端的窗口大小，内核会向终端的前台进程组发送 SIGWINCH
+func SetWindowSize(f *os.File, size *WindowSize) error {
+	ws := winsize{Row: size.Height, Col: size.Width}
+	return ioctl(f, syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws)))
+}
+
+// 通过 SyscallConn 调用 ioctl，不会像 Fd() 一样把文件设置为阻塞模式，关闭文件时可以中断正在进行的读取
+func ioctl(f *os.File, request uintptr, arg uintptr) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	if err := conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg)
+	}); err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package containers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 重启策略
+const (
+	// RestartNo 不重新启动
+	RestartNo = "no"
+	// RestartOnFailure 退出码不为 0 时重新启动，可以限制最多重启的次数
+	RestartOnFailure = "on-failure"
+	// RestartAlways 总是重新启动，手动停止的容器在 daemon 启动时也会重新启动
+	RestartAlways = "always"
+	// RestartUnlessStopped 和 always 相同，但是手动停止的容器不会再启动
+	RestartUnlessStopped = "unless-stopped"
+)
+
+// RestartPolicy 容器退出后的重启策略
+type RestartPolicy struct {
+	// 策略名称 no, on-failure, always, unless-stopped
+	Name string `json:"name"`
+	// on-failure 时最多重启的次数，0 表示不限制
+	MaximumRetryCount int `json:"maximumRetryCount"`
+}
+
+// ParseRestartPolicy 解析 --restart 参数，格式为 no, on-failure[:最多重启次数], always, unless-stopped
+func ParseRestartPolicy(policy string) (*RestartPolicy, error) {
+	if policy == "" {
+		return &RestartPolicy{Name: RestartNo}, nil
+	}
+	name, count, hasCount := strings.Cut(policy, ":")
+	switch name {
+	case RestartNo, RestartAlways, RestartUnlessStopped:
+		if hasCount {
+			return nil, fmt.Errorf("重启策略 %s 不能指定重启次数", name)
+		}
+		return &RestartPolicy{Name: name}, nil
+	case RestartOnFailure:
+		result := &RestartPolicy{Name: name}
+		if hasCount {
+			n, err := strconv.Atoi(count)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("重启次数格式错误: %s", count)
+			}
+			result.MaximumRetryCount = n
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("不支持的重启策略: %s, 可选值为 no, on-failure[:N], always, unless-stopped", policy)
+}
+
+// String 返回 --restart 参数的格式
+func (p *RestartPolicy) String() string {
+	if p == nil {
+		return RestartNo
+	}
+	if p.Name == RestartOnFailure && p.MaximumRetryCount > 0 {
+		return fmt.Sprintf("%s:%d", p.Name, p.MaximumRetryCount)
+	}
+	return p.Name
+}
+
+// ShouldRestart 容器退出后是否需要根据重启策略重新启动，手动停止的容器不会重新启动
+// daemonStart 为 true 表示 daemon 启动时恢复容器，always 策略手动停止的容器也会重新启动
+func (info *ContainerInfo) ShouldRestart(daemonStart bool) bool {
+	p := info.RestartPolicy
+	if p == nil {
+		return false
+	}
+	if info.Status == Stop {
+		return daemonStart && p.Name == RestartAlways
+	}
+	if info.Status != Exit {
+		return false
+	}
+	switch p.Name {
+	case RestartAlways, RestartUnlessStopped:
+		return true
+	case RestartOnFailure:
+		return info.ExitCode != 0 && (p.MaximumRetryCount == 0 || info.RestartCount < p.MaximumRetryCount)
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package containers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		want    *RestartPolicy
+		wantErr bool
+	}{
+		{"", &RestartPolicy{Name: RestartNo}, false},
+		{"no", &RestartPolicy{Name: RestartNo}, false},
+		{"always", &RestartPolicy{Name: RestartAlways}, false},
+		{"unless-stopped", &RestartPolicy{Name: RestartUnlessStopped}, false},
+		{"on-failure", &RestartPolicy{Name: RestartOnFailure}, false},
+		{"on-failure:3", &RestartPolicy{Name: RestartOnFailure, MaximumRetryCount: 3}, false},
+		{"on-failure:-1", nil, true},
+		{"on-failure:x", nil, true},
+		{"always:3", nil, true},
+		{"sometimes", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRestartPolicy(tt.policy)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRestartPolicy(%q) 错误为 %v, 期望错误 %v", tt.policy, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRestartPolicy(%q) = %+v, 期望 %+v", tt.policy, got, tt.want)
+		}
+		// 解析结果可以还原为相同的参数
+		if got != nil && tt.policy != "" && got.String() != tt.policy {
+			t.Errorf("%q 还原为 %q", tt.policy, got.String())
+		}
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       string
+		status       string
+		exitCode     int
+		restartCount int
+		daemonStart  bool
+		want         bool
+	}{
+		{"没有策略", "", Exit, 1, 0, false, false},
+		{"no", "no", Exit, 1, 0, false, false},
+		{"always 正常退出", "always", Exit, 0, 0, false, true},
+		{"always 运行中", "always", Running, 0, 0, false, false},
+		{"always 手动停止", "always", Stop, 0, 0, false, false},
+		{"always 手动停止 daemon 启动", "always", Stop, 0, 0, true, true},
+		{"unless-stopped 退出", "unless-stopped", Exit, 0, 0, false, true},
+		{"unless-stopped 手动停止 daemon 启动", "unless-stopped", Stop, 0, 0, true, false},
+		{"on-failure 正常退出", "on-failure", Exit, 0, 0, false, false},
+		{"on-failure 失败", "on-failure", Exit, 1, 10, false, true},
+		{"on-failure 未达到次数", "on-failure:3", Exit, 1, 2, false, true},
+		{"on-failure 达到次数", "on-failure:3", Exit, 1, 3, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &ContainerInfo{Status: tt.status, ExitCode: tt.exitCode, RestartCount: tt.restartCount}
+			if tt.policy != "" {
+				policy, err := ParseRestartPolicy(tt.policy)
+				if err != nil {
+					t.Fatal(err)
+				}
+				info.RestartPolicy = policy
+			}
+			if got := info.ShouldRestart(tt.daemonStart); got != tt.want {
+				t.Errorf("ShouldRestart(%v) = %v, 期望 %v", tt.daemonStart, got, tt.want)
+			}
+		})
+	}
+}
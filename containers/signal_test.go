@@ -0,0 +1,32 @@
+package containers
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		signal  string
+		want    syscall.Signal
+		wantErr bool
+	}{
+		{"SIGTERM", syscall.SIGTERM, false},
+		{"TERM", syscall.SIGTERM, false},
+		{"sigkill", syscall.SIGKILL, false},
+		{"usr1", syscall.SIGUSR1, false},
+		{"9", syscall.SIGKILL, false},
+		{"64", syscall.Signal(64), false},
+		{"0", 0, true},
+		{"65", 0, true},
+		{"-1", 0, true},
+		{"SIGFOO", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSignal(tt.signal)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSignal(%q) = %v, %v, 期望 %v, 错误 %v", tt.signal, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
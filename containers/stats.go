@@ -0,0 +1,160 @@
+package containers
+
+import (
+	"cgroups"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContainerStats 容器某一时刻的资源使用量，两次采样的差值用来计算 cpu 使用率
+type ContainerStats struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// 采样时间
+	Read time.Time `json:"read"`
+	// 从容器 cgroup 中读取的资源使用量
+	Cgroup *cgroups.Stats `json:"cgroup"`
+	// 容器网络 namespace 中除了 lo 之外所有网卡累计接收和发送的字节数
+	NetworkRx uint64 `json:"networkRx"`
+	NetworkTx uint64 `json:"networkTx"`
+	// 宿主机所有 cpu 累计的时间，单位是纳秒
+	SystemCpuUsage uint64 `json:"systemCpuUsage"`
+	// 宿主机在线的 cpu 数量
+	OnlineCpus int `json:"onlineCpus"`
+}
+
+// GetContainerStats 读取运行中容器的资源使用量
+func GetContainerStats(info *ContainerInfo) (*ContainerStats, error) {
+	if !info.IsRunning() {
+		return nil, fmt.Errorf("容器 %s 没有运行", info.Name)
+	}
+	stats := &ContainerStats{
+		Id:     info.Id,
+		Name:   info.Name,
+		Read:   time.Now(),
+		Cgroup: cgroups.NewCgroupManager(cgroups.RooutCgroupPath + info.Id).Stats(),
+	}
+	// 没有内存限制时使用宿主机的内存大小
+	if stats.Cgroup.MemoryLimit == 0 {
+		stats.Cgroup.MemoryLimit = hostMemory()
+	}
+	stats.NetworkRx, stats.NetworkTx = readNetDev(info.Pid)
+	stats.SystemCpuUsage, stats.OnlineCpus = readSystemCpu()
+	return stats, nil
+}
+
+// StatsEntry 根据两次采样计算出的容器资源使用情况
+type StatsEntry struct {
+	Id            string  `json:"id"`
+	Name          string  `json:"name"`
+	CpuPercent    float64 `json:"cpuPercent"`
+	MemoryUsage   uint64  `json:"memoryUsage"`
+	MemoryLimit   uint64  `json:"memoryLimit"`
+	MemoryPercent float64 `json:"memoryPercent"`
+	NetworkRx     uint64  `json:"networkRx"`
+	NetworkTx     uint64  `json:"networkTx"`
+	BlockRead     uint64  `json:"blockRead"`
+	BlockWrite    uint64  `json:"blockWrite"`
+	Pids          uint64  `json:"pids"`
+}
+
+// CalculateStats 计算容器的资源使用情况，cpu 使用率是两次采样之间容器使用的 cpu 时间占宿主机 cpu 时间的比例，
+// 乘以 cpu 数量，使用满一个 cpu 时为 100%，prev 为空时 cpu 使用率为 0
+func CalculateStats(prev *ContainerStats, cur *ContainerStats) *StatsEntry {
+	entry := &StatsEntry{
+		Id:          cur.Id,
+		Name:        cur.Name,
+		MemoryUsage: cur.Cgroup.MemoryUsage,
+		MemoryLimit: cur.Cgroup.MemoryLimit,
+		NetworkRx:   cur.NetworkRx,
+		NetworkTx:   cur.NetworkTx,
+		BlockRead:   cur.Cgroup.BlockRead,
+		BlockWrite:  cur.Cgroup.BlockWrite,
+		Pids:        cur.Cgroup.Pids,
+	}
+	if cur.Cgroup.MemoryLimit > 0 {
+		entry.MemoryPercent = float64(cur.Cgroup.MemoryUsage) / float64(cur.Cgroup.MemoryLimit) * 100
+	}
+	if prev != nil && cur.Cgroup.CpuUsage > prev.Cgroup.CpuUsage && cur.SystemCpuUsage > prev.SystemCpuUsage {
+		cpuDelta := float64(cur.Cgroup.CpuUsage - prev.Cgroup.CpuUsage)
+		systemDelta := float64(cur.SystemCpuUsage - prev.SystemCpuUsage)
+		entry.CpuPercent = cpuDelta / systemDelta * float64(cur.OnlineCpus) * 100
+	}
+	return entry
+}
+
+// 读取进程所在网络 namespace 的 /proc/<pid>/net/dev，格式如下，累加除了 lo 之外所有网卡的接收和发送字节数
+// Inter-|   Receive                            |  Transmit
+//
+//	face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets ...
+//	  lo:       0       0    0    0    0     0          0         0        0       0 ...
+//	eth0:    1296      16    0    0    0     0          0         0      656       8 ...
+func readNetDev(pid string) (uint64, uint64) {
+	content, err := os.ReadFile(fmt.Sprintf("/proc/%s/net/dev", pid))
+	if err != nil {
+		return 0, 0
+	}
+	var rx, tx uint64
+	for _, line := range strings.Split(string(content), "\n") {
+		name, counters, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) == "lo" {
+			continue
+		}
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			continue
+		}
+		r, _ := strconv.ParseUint(fields[0], 10, 64)
+		t, _ := strconv.ParseUint(fields[8], 10, 64)
+		rx += r
+		tx += t
+	}
+	return rx, tx
+}
+
+// 读取 /proc/stat 中所有 cpu 累计的时间，单位转换为纳秒，以及 cpu 的数量
+// cpu  10132153 290696 3084719 46828483 16683 0 25195 0 0 0
+// cpu0 1393280 32966 572056 13343292 6130 0 17875 0 0 0
+func readSystemCpu() (uint64, int) {
+	content, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return 0, 0
+	}
+	var total uint64
+	cpus := 0
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		if fields[0] != "cpu" {
+			cpus++
+			continue
+		}
+		// user, nice, system, idle, iowait, irq, softirq, steal，之后的 guest 已经包含在 user 中
+		for i := 1; i < len(fields) && i <= 8; i++ {
+			value, _ := strconv.ParseUint(fields[i], 10, 64)
+			total += value
+		}
+	}
+	return total * uint64(time.Second) / clockTicks, cpus
+}
+
+// 宿主机的内存大小，读取 /proc/meminfo 中的 MemTotal，单位是 kB
+func hostMemory() uint64 {
+	content, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			value, _ := strconv.ParseUint(fields[1], 10, 64)
+			return value * 1024
+		}
+	}
+	return 0
+}
@@ -0,0 +1,93 @@
+package containers
+
+import (
+	"cgroups"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProcessInfo 容器中的进程信息，从宿主机的 /proc 中读取
+type ProcessInfo struct {
+	// 宿主机上的 pid
+	Pid int `json:"pid"`
+	// 容器 pid namespace 中的 pid
+	ContainerPid int `json:"containerPid"`
+	Ppid         int `json:"ppid"`
+	// 进程的用户，宿主机上没有对应的用户时是 uid
+	User string `json:"user"`
+	// 进程状态，例如 R, S
+	Stat string `json:"stat"`
+	// 进程使用的 cpu 时间，用户态加内核态
+	CpuTime time.Duration `json:"cpuTime"`
+	Command string        `json:"command"`
+}
+
+// 每秒的时钟周期数，/proc/<pid>/stat 中的时间单位，Linux 上固定为 100
+const clockTicks = 100
+
+// ListProcesses 列出容器 cgroup 中的所有进程
+func ListProcesses(containerId string) ([]*ProcessInfo, error) {
+	pids, err := cgroups.NewCgroupManager(cgroups.RooutCgroupPath + containerId).Pids()
+	if err != nil {
+		return nil, fmt.Errorf("获取容器 %s 的进程失败: %v", containerId, err)
+	}
+	processes := []*ProcessInfo{}
+	for _, pid := range pids {
+		process, err := readProcess(pid)
+		if err != nil {
+			// 进程可能已经退出
+			continue
+		}
+		processes = append(processes, process)
+	}
+	return processes, nil
+}
+
+// 从 /proc/<pid> 中读取进程信息
+func readProcess(pid int) (*ProcessInfo, error) {
+	fields := readProcessStat(pid)
+	// utime, stime 是第14，15个字段
+	if len(fields) < 13 {
+		return nil, fmt.Errorf("进程 %d 不存在", pid)
+	}
+	process := &ProcessInfo{Pid: pid, ContainerPid: pid, Stat: fields[0]}
+	process.Ppid, _ = strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	process.CpuTime = time.Duration(utime+stime) * time.Second / clockTicks
+
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		parts := strings.Fields(line)
+		if len(parts) < 2 {
+			continue
+		}
+		switch parts[0] {
+		case "Uid:":
+			// 依次为 real, effective, saved, filesystem uid
+			process.User = parts[1]
+			if u, err := user.LookupId(parts[1]); err == nil {
+				process.User = u.Username
+			}
+		case "NSpid:":
+			// 依次为各级 pid namespace 中的 pid，最后一个是进程所在 namespace 中的 pid
+			process.ContainerPid, _ = strconv.Atoi(parts[len(parts)-1])
+		}
+	}
+
+	cmdline, _ := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	process.Command = strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+	if process.Command == "" {
+		// 内核线程或者僵尸进程没有命令行，使用进程名称
+		comm, _ := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+		process.Command = "[" + strings.TrimSpace(string(comm)) + "]"
+	}
+	return process, nil
+}
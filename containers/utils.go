@@ -1,41 +1,44 @@
 package containers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
-	"math/rand"
 	"os"
 	"os/exec"
 	"path"
-	"time"
 )
 
-// ContainerId 生成容器id
+// ContainerId 生成容器id，12 位十六进制，和已有的容器不重复
 func ContainerId() string {
-	return randStringBytes(10)
+	return randomId(12, func(id string) bool {
+		return FileExist(fmt.Sprintf(ContainerInfoLocation, id))
+	})
 }
 
 // VolumeId 生成默认卷id
 func VolumeId() string {
-	return randStringBytes(5)
+	return randomId(12, func(id string) bool {
+		return FileExist(fmt.Sprintf(VolumeInfoLocation, id))
+	})
 }
 
-func randStringBytes(n int) string {
-	letterBytes := "1234567890"
-	rand.NewSource(time.Now().UnixNano())
-	b := make([]byte, n)
-	for i := range b {
-		b[i] = letterBytes[rand.Intn(len(letterBytes))]
+// 使用 crypto/rand 生成 n 位十六进制的 id，exists 为 true 时重新生成
+func randomId(n int, exists func(id string) bool) string {
+	b := make([]byte, (n+1)/2)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			log.Fatalf("生成随机 id 失败 %v", err)
+		}
+		id := hex.EncodeToString(b)[:n]
+		if !exists(id) {
+			return id
+		}
 	}
-	return string(b)
-}
-
-// ImageId 生成镜像id, 生成15位的镜像id；与 容器id作区分
-func ImageId() string {
-	return randStringBytes(15)
 }
 
-// GetBaseImageId 最基础的镜像id,为和其他镜像区分，名称不使用数字
+// GetBaseImageId 最基础的镜像的名称，镜像id 由镜像配置生成
 func GetBaseImageId() string {
 	return "base"
 }
@@ -1,11 +1,15 @@
 package containers
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -15,28 +19,32 @@ func NewWorkSpace(info *ContainerInfo, volumes []string, imageId string) string
 	createUpperDir(info.BaseUrl)
 	createWorkDir(info.BaseUrl)
 	mergedDir := createMergedDir(info.BaseUrl, lowDir)
-	//创建卷的挂载
-	CreateVolume(info, mergedDir, volumes, imageId)
+	if len(info.Volume) > 0 {
+		// 重新启动的容器挂载之前记录的卷，匿名卷也继续使用原来的目录
+		RemountVolume(info)
+	} else {
+		//创建卷的挂载
+		CreateVolume(info, mergedDir, volumes, imageId)
+	}
 	return mergedDir
 }
 
-// 获取只读层 目录
+// 获取只读层 目录，按照镜像记录的镜像层摘要找到解压后的目录，从上到下排列
 func getLowerDir(image string) string {
-	var lowDirs []string
-	lowDirs = append(lowDirs, fmt.Sprintf(ImageLayerLocation, image))
-	info, err := GetImageInfo(image)
+	layers, err := ImageLayers(image)
 	if err != nil {
-		log.Println("镜像不存在")
-	}
-	for {
-		//按层查找
-		if info.From != "" {
-			from := info.From
-			info, err = GetImageInfo(ResolveImageId(info.From, false))
-			lowDirs = append(lowDirs, fmt.Sprintf(ImageLayerLocation, from))
-		} else {
-			break
+		log.Printf("获取镜像 %s 的镜像层失败: %v\n", image, err)
+		return ""
+	}
+	var lowDirs []string
+	for i := len(layers) - 1; i >= 0; i-- {
+		// 导入的镜像层可能还没有解压
+		if err := extractLayer(layers[i]); err != nil {
+			log.Printf("解压镜像层失败: %v\n", err)
+			return ""
 		}
+		dir, _ := LayerDir(layers[i])
+		lowDirs = append(lowDirs, dir)
 	}
 	return strings.Join(lowDirs, ":")
 }
@@ -134,6 +142,24 @@ func MountVolume(info *ContainerInfo, hostPath string, containerPath string, mer
 	})
 
 }
+
+// RemountVolume 重新挂载容器记录的卷
+func RemountVolume(info *ContainerInfo) {
+	for _, v := range info.Volume {
+		for _, dir := range []string{v.HostVolumePath, v.ContainerPathInHost} {
+			if err := os.MkdirAll(dir, 0777); err != nil {
+				log.Printf("创建目录: %s，失败: %v \n", dir, err)
+			}
+		}
+		cmd := exec.Command("mount", "--bind", v.HostVolumePath, v.ContainerPathInHost)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			log.Printf("挂载卷失败： %v", err)
+		}
+	}
+}
+
 func PathExists(path string) (bool, error) {
 	_, err := os.Stat(path)
 	if err == nil {
@@ -161,6 +187,10 @@ func DeleteVolumeMount(info *ContainerInfo) {
 	}
 }
 func umount(mountedPath string) {
+	// 容器退出后可能已经取消挂载
+	if !isMountPoint(mountedPath) {
+		return
+	}
 	cmd := exec.Command("umount", mountedPath)
 	err := cmd.Run()
 	if err != nil {
@@ -168,3 +198,51 @@ func umount(mountedPath string) {
 		return
 	}
 }
+
+// 判断目录是否是挂载点，按照 /proc/self/mountinfo 中的挂载目录判断
+// 同一个文件系统中的目录绑定挂载之后设备号和父目录相同，不能通过 stat 判断
+func isMountPoint(dir string) bool {
+	// mountinfo 中记录的是解析符号链接之后的路径
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false
+	}
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return inMountInfo(f, dir)
+}
+
+// 挂载信息中是否有挂载在 dir 的文件系统，格式如下，第五个字段为挂载目录
+// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func inMountInfo(r io.Reader, dir string) bool {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), " ")
+		if len(fields) > 4 && unescapeMountPath(fields[4]) == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// 挂载目录中的空格、制表符、换行和反斜杠被转义为 \ 加三位八进制数
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,30 @@
+package containers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInMountInfo(t *testing.T) {
+	mountinfo := `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+36 22 8:1 /data /mnt/data rw,relatime shared:1 - ext4 /dev/sda1 rw
+37 22 0:45 / /mnt/my\040volume rw,relatime - tmpfs tmpfs rw
+`
+	tests := []struct {
+		dir  string
+		want bool
+	}{
+		{"/", true},
+		// 同一个文件系统中的绑定挂载
+		{"/mnt/data", true},
+		{"/mnt/my volume", true},
+		{"/mnt", false},
+		{"/mnt/data/sub", false},
+		{"/data", false},
+	}
+	for _, tt := range tests {
+		if got := inMountInfo(strings.NewReader(mountinfo), tt.dir); got != tt.want {
+			t.Errorf("inMountInfo(%q) = %v, 期望 %v", tt.dir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package daemon
+
+import (
+	"bufio"
+	"containers"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"run"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AttachUpgrade attach 接口(run -i, start -a, attach)使用的协议
+// 连接升级后，双方都发送 containers.WriteFrame 格式的数据帧，客户端发送标准输入和终端窗口大小，标准输入结束时关闭连接的写端，
+// daemon 返回容器的标准输出，标准错误，最后一帧是 containers.AttachResult
+// daemon 只在客户端和容器的 shim 进程之间转发数据，分离按键由 shim 进程处理，exec -t 时 daemon 直接持有伪终端
+const AttachUpgrade = "mydocker-attach"
+
+// 请求是否要求升级为 attach 连接
+func isAttachUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), AttachUpgrade)
+}
+
+// 读取 attach 的参数，参数 stdin 为 true 时附加标准输入，参数 detachKeys 是分离按键
+func readAttachRequest(w http.ResponseWriter, r *http.Request) (*containers.AttachRequest, bool) {
+	query := r.URL.Query()
+	request := &containers.AttachRequest{
+		Stdin:      query.Get("stdin") == "true",
+		DetachKeys: query.Get("detachKeys"),
+	}
+	if _, err := containers.ParseDetachKeys(request.DetachKeys); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	return request, true
+}
+
+// 附加到运行中的容器的标准输入输出，按下分离按键或者容器退出时结束
+func (d *Daemon) attachContainer(w http.ResponseWriter, r *http.Request, vars []string) {
+	request, ok := readAttachRequest(w, r)
+	if !ok {
+		return
+	}
+	if !isAttachUpgrade(r) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("attach 需要升级为 %s 连接", AttachUpgrade))
+		return
+	}
+	d.lock.Lock()
+	info, ok := d.resolveContainer(w, vars[0])
+	d.lock.Unlock()
+	if !ok {
+		return
+	}
+	if !info.IsRunning() {
+		writeError(w, http.StatusConflict, fmt.Errorf("容器 %s 没有运行", info.Id))
+		return
+	}
+	// 没有使用 -i 启动的容器没有标准输入
+	request.Stdin = request.Stdin && info.Config != nil && info.Config.OpenStdin
+	shimConn, err := containers.DialAttach(info.Id, request)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	proxyAttach(w, shimConn)
+}
+
+// 升级客户端的连接，在客户端和 shim 进程之间转发数据，直到 shim 结束 attach 或者客户端断开
+func proxyAttach(w http.ResponseWriter, shimConn net.Conn) {
+	defer shimConn.Close()
+	conn, reader, err := hijackAttach(w)
+	if err != nil {
+		log.Printf("attach 容器失败: %v\n", err)
+		return
+	}
+	defer conn.Close()
+	go func() {
+		// 客户端的标准输入结束，通知 shim
+		_, _ = io.Copy(shimConn, reader)
+		if unixConn, ok := shimConn.(*net.UnixConn); ok {
+			_ = unixConn.CloseWrite()
+		}
+	}()
+	_, _ = io.Copy(conn, shimConn)
+}
+
+// 使用伪终端在容器中执行命令，daemon 持有伪终端的主设备，在客户端和主设备之间转发数据，命令结束后返回命令的退出码
+func execTerminal(w http.ResponseWriter, containerId string, cmd []string) {
+	master, slave, err := containers.OpenPty()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer master.Close()
+	process, err := containers.StartExecTerminal(containerId, cmd, slave)
+	// 从设备已经交给命令，命令及其子进程都退出后读取主设备返回 EIO
+	slave.Close()
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	conn, reader, err := hijackAttach(w)
+	if err != nil {
+		log.Printf("exec 容器失败: %v\n", err)
+		_ = process.Process.Kill()
+		_ = process.Wait()
+		return
+	}
+	defer conn.Close()
+	// 输出和最后的结果都写到客户端的连接
+	var lock sync.Mutex
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := master.Read(buf)
+			if n > 0 {
+				lock.Lock()
+				writeErr := containers.WriteFrame(conn, containers.AttachStdout, buf[:n])
+				lock.Unlock()
+				// 客户端已经断开，关闭主设备，命令收到 SIGHUP
+				if writeErr != nil {
+					master.Close()
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		for {
+			stream, data, err := containers.ReadFrame(reader)
+			if err != nil {
+				return
+			}
+			switch stream {
+			case containers.AttachStdin:
+				_, _ = master.Write(data)
+			case containers.AttachResize:
+				var size containers.WindowSize
+				if err := json.Unmarshal(data, &size); err == nil {
+					_ = containers.SetWindowSize(master, &size)
+				}
+			}
+		}
+	}()
+	_ = process.Wait()
+	// 命令在后台启动的进程可能还持有从设备，最多等待一秒
+	select {
+	case <-copied:
+	case <-time.After(time.Second):
+	}
+	content, _ := json.Marshal(&containers.AttachResult{Id: containerId, ExitCode: run.ExitCode(process.ProcessState)})
+	lock.Lock()
+	defer lock.Unlock()
+	_ = containers.WriteFrame(conn, containers.AttachEnd, content)
+}
+
+// 升级为 attach 连接，返回的 reader 读取客户端发送的数据帧
+func hijackAttach(w http.ResponseWriter) (net.Conn, *bufio.Reader, error) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("连接不支持升级")
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, fmt.Errorf("升级连接失败: %v", err)
+	}
+	_, _ = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: " + AttachUpgrade + "\r\n\r\n")
+	if err := buf.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("升级连接失败: %v", err)
+	}
+	return conn, buf.Reader, nil
+}
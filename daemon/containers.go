@@ -0,0 +1,576 @@
+package daemon
+
+import (
+	"containers"
+	"fmt"
+	"log"
+	"logger"
+	"net"
+	"net/http"
+	"os/exec"
+	"run"
+	"strconv"
+	"time"
+)
+
+// 列出容器，参数 all 为 true 时包括没有运行的容器，参数 filter 是过滤条件，可以指定多个
+func (d *Daemon) listContainers(w http.ResponseWriter, r *http.Request, vars []string) {
+	query := r.URL.Query()
+	filter, err := containers.ParseContainerFilter(query["filter"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	list := containers.FilterContainers(containers.GetContainerInfoList(), query.Get("all") == "true", filter)
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (d *Daemon) inspectContainer(w http.ResponseWriter, r *http.Request, vars []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	info, ok := d.resolveContainer(w, vars[0])
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, containers.InspectContainer(info))
+}
+
+// 启动容器，升级为 attach 连接时附加到容器的标准输入输出
+func (d *Daemon) runContainer(w http.ResponseWriter, r *http.Request, vars []string) {
+	config, ok := readRunConfig(w, r)
+	if !ok {
+		return
+	}
+	if isAttachUpgrade(r) {
+		d.runAttached(w, r, *config)
+		return
+	}
+	d.lock.Lock()
+	info, parent, err := run.Run(*config, nil)
+	if err == nil {
+		d.watch(info, parent)
+	}
+	d.lock.Unlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, info)
+}
+
+// 启动容器并附加到容器的标准输入输出，前台交互式启动的容器在客户端附加期间退出后删除容器
+func (d *Daemon) runAttached(w http.ResponseWriter, r *http.Request, config containers.RunContainerConfig) {
+	request, ok := readAttachRequest(w, r)
+	if !ok {
+		return
+	}
+	var shimConn net.Conn
+	attach := func(info *containers.ContainerInfo) (err error) {
+		shimConn, err = containers.DialAttach(info.Id, request)
+		return err
+	}
+	d.lock.Lock()
+	info, parent, err := run.Run(config, attach)
+	if err == nil {
+		d.watch(info, parent)
+	}
+	d.lock.Unlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	proxyAttach(w, shimConn)
+	if !config.Interactive() {
+		return
+	}
+	// 按下分离按键或者客户端断开时容器继续运行
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if latest, err := containers.GetContainerInfo(info.Id); err == nil && !latest.IsRunning() {
+		run.Clean(latest)
+		d.notify()
+	}
+}
+
+// 创建容器，不启动
+func (d *Daemon) createContainer(w http.ResponseWriter, r *http.Request, vars []string) {
+	config, ok := readRunConfig(w, r)
+	if !ok {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	info, err := run.Create(*config)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, info)
+}
+
+// 启动新创建的或者已经停止的容器，升级为 attach 连接时附加到容器的标准输入输出
+func (d *Daemon) startContainer(w http.ResponseWriter, r *http.Request, vars []string) {
+	if isAttachUpgrade(r) {
+		d.startAttached(w, r, vars[0])
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	info, ok := d.resolveContainer(w, vars[0])
+	if !ok {
+		return
+	}
+	// 手动启动时清零自动重启的次数
+	info.RestartCount = 0
+	shim, err := run.Start(info, nil)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	d.watch(info, shim)
+	writeJSON(w, http.StatusOK, info)
+}
+
+// 启动容器并附加到容器的标准输入输出，容器退出后保留容器
+func (d *Daemon) startAttached(w http.ResponseWriter, r *http.Request, idOrName string) {
+	request, ok := readAttachRequest(w, r)
+	if !ok {
+		return
+	}
+	d.lock.Lock()
+	info, ok := d.resolveContainer(w, idOrName)
+	if !ok {
+		d.lock.Unlock()
+		return
+	}
+	var shimConn net.Conn
+	info.RestartCount = 0
+	shim, err := run.Start(info, func(info *containers.ContainerInfo) (err error) {
+		shimConn, err = containers.DialAttach(info.Id, request)
+		return err
+	})
+	if err == nil {
+		d.watch(info, shim)
+	}
+	d.lock.Unlock()
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	proxyAttach(w, shimConn)
+}
+
+// 重新启动容器，运行中的容器先停止，超过 t 秒没有退出时强制杀死
+func (d *Daemon) restartContainer(w http.ResponseWriter, r *http.Request, vars []string) {
+	timeout, err := stopTimeout(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	d.lock.Lock()
+	info, ok := d.resolveContainer(w, vars[0])
+	d.lock.Unlock()
+	if !ok {
+		return
+	}
+	// 等待容器退出时不持有锁，shim 记录退出信息不需要 daemon
+	if err := run.Stop(info.Id, timeout); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	info, ok = d.resolveContainer(w, info.Id)
+	if !ok {
+		return
+	}
+	info.RestartCount = 0
+	shim, err := run.Start(info, nil)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	d.watch(info, shim)
+	containers.LogContainerEvent(info, "restart", nil)
+	writeJSON(w, http.StatusOK, info)
+}
+
+// 停止容器，先发送容器的停止信号，超过 t 秒没有退出时发送 SIGKILL
+func (d *Daemon) stopContainer(w http.ResponseWriter, r *http.Request, vars []string) {
+	timeout, err := stopTimeout(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	d.lock.Lock()
+	info, ok := d.resolveContainer(w, vars[0])
+	d.lock.Unlock()
+	if !ok {
+		return
+	}
+	if err := run.Stop(info.Id, timeout); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// 向容器发送信号，参数 signal 是信号，默认是 SIGKILL，参数 all 为 true 时发送给容器中的所有进程
+func (d *Daemon) killContainer(w http.ResponseWriter, r *http.Request, vars []string) {
+	query := r.URL.Query()
+	signal := query.Get("signal")
+	if signal == "" {
+		signal = "SIGKILL"
+	}
+	all := query.Get("all") == "true"
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	info, ok := d.resolveContainer(w, vars[0])
+	if !ok {
+		return
+	}
+	if !info.IsRunning() {
+		writeError(w, http.StatusConflict, fmt.Errorf("容器 %s 没有运行", info.Id))
+		return
+	}
+	if err := run.Kill(info.Id, signal, all); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// 冻结容器中的所有进程
+func (d *Daemon) pauseContainer(w http.ResponseWriter, r *http.Request, vars []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	info, ok := d.resolveContainer(w, vars[0])
+	if !ok {
+		return
+	}
+	if err := run.Pause(info.Id); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// 恢复暂停的容器
+func (d *Daemon) unpauseContainer(w http.ResponseWriter, r *http.Request, vars []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	info, ok := d.resolveContainer(w, vars[0])
+	if !ok {
+		return
+	}
+	if err := run.Unpause(info.Id); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// 解析停止容器的等待时间，参数 t 单位是秒，没有指定时使用默认值
+func stopTimeout(r *http.Request) (time.Duration, error) {
+	t := r.URL.Query().Get("t")
+	if t == "" {
+		return run.DefaultStopTimeout, nil
+	}
+	seconds, err := strconv.Atoi(t)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("无效的等待时间: %s", t)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func (d *Daemon) removeContainer(w http.ResponseWriter, r *http.Request, vars []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	info, ok := d.resolveContainer(w, vars[0])
+	if !ok {
+		return
+	}
+	if err := run.Remove(info.Id); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	delete(d.exits, info.Id)
+	d.notify()
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// 等待容器满足 condition 参数指定的条件，返回容器最近一次退出时记录的退出码
+func (d *Daemon) waitContainer(w http.ResponseWriter, r *http.Request, vars []string) {
+	condition := r.URL.Query().Get("condition")
+	if condition == "" {
+		condition = WaitNotRunning
+	}
+	if condition != WaitNotRunning && condition != WaitNextExit && condition != WaitRemoved {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("不支持的等待条件: %s", condition))
+		return
+	}
+	d.lock.Lock()
+	info, ok := d.resolveContainer(w, vars[0])
+	if !ok {
+		d.lock.Unlock()
+		return
+	}
+	// next-exit 时等待的退出状态，容器运行中时是这次运行的退出状态，否则是下一次运行的退出状态
+	initial := d.exits[info.Id]
+	pending := initial != nil && !initial.exited()
+	exitCode := -1
+	for {
+		latest, err := containers.GetContainerInfo(info.Id)
+		removed := err != nil
+		if !removed && !latest.IsRunning() && latest.FinishedAt != "" {
+			exitCode = latest.ExitCode
+		}
+		satisfied := false
+		switch condition {
+		case WaitNotRunning:
+			satisfied = removed || !latest.IsRunning()
+		case WaitNextExit:
+			exit := d.exits[info.Id]
+			if exit != nil && (exit != initial || pending) && exit.exited() {
+				exitCode, satisfied = exit.exitCode, true
+			}
+			satisfied = satisfied || removed
+		case WaitRemoved:
+			satisfied = removed
+		}
+		if satisfied {
+			d.lock.Unlock()
+			writeJSON(w, http.StatusOK, &WaitResponse{ExitCode: exitCode})
+			return
+		}
+		changed := d.changed
+		d.lock.Unlock()
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+		d.lock.Lock()
+	}
+}
+
+// 列出容器中的所有进程
+func (d *Daemon) topContainer(w http.ResponseWriter, r *http.Request, vars []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	info, ok := d.resolveContainer(w, vars[0])
+	if !ok {
+		return
+	}
+	if !info.IsRunning() {
+		writeError(w, http.StatusConflict, fmt.Errorf("容器 %s 没有运行", info.Id))
+		return
+	}
+	processes, err := containers.ListProcesses(info.Id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, processes)
+}
+
+// 返回容器的资源使用量，客户端根据两次采样计算 cpu 使用率
+func (d *Daemon) containerStats(w http.ResponseWriter, r *http.Request, vars []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	info, ok := d.resolveContainer(w, vars[0])
+	if !ok {
+		return
+	}
+	if !info.IsRunning() {
+		writeError(w, http.StatusConflict, fmt.Errorf("容器 %s 没有运行", info.Id))
+		return
+	}
+	stats, err := containers.GetContainerStats(info)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// 日志前面加上的时间，固定长度便于对齐
+const logTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// 按照容器的日志驱动读取日志，以 containers.WriteFrame 的格式返回标准输出和标准错误的日志
+// 参数 follow 为 true 时持续返回新的日志，直到容器退出，tail 是从末尾开始返回的日志条数，为空或者 all 时返回所有日志，
+// since, until 是 unix 时间戳，timestamps 为 true 时在每条日志前面加上时间
+func (d *Daemon) containerLogs(w http.ResponseWriter, r *http.Request, vars []string) {
+	query := r.URL.Query()
+	config := &logger.ReadConfig{Tail: -1, Follow: query.Get("follow") == "true"}
+	if tail := query.Get("tail"); tail != "" && tail != "all" {
+		n, err := strconv.Atoi(tail)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("tail 必须是非负整数或者 all: %s", tail))
+			return
+		}
+		config.Tail = n
+	}
+	now := time.Now()
+	var err error
+	if value := query.Get("since"); value != "" {
+		if config.Since, err = containers.ParseEventTime(value, now); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if value := query.Get("until"); value != "" {
+		if config.Until, err = containers.ParseEventTime(value, now); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	timestamps := query.Get("timestamps") == "true"
+	d.lock.Lock()
+	info, ok := d.resolveContainer(w, vars[0])
+	var exit *containerExit
+	if ok {
+		exit = d.exits[info.Id]
+	}
+	d.lock.Unlock()
+	if !ok {
+		return
+	}
+	reader, err := run.LogReader(info.Id)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	// 持续读取时等待 shim 进程退出，这时容器的输出都已经写入日志
+	done := make(chan struct{})
+	config.Done = done
+	if config.Follow && info.IsRunning() && exit != nil {
+		go func() {
+			select {
+			case <-exit.done:
+			case <-r.Context().Done():
+			}
+			close(done)
+		}()
+	} else {
+		close(done)
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	err = reader.ReadLogs(config, func(msg *logger.Message) error {
+		var stream byte = containers.AttachStdout
+		if msg.Source == logger.Stderr {
+			stream = containers.AttachStderr
+		}
+		line := msg.Line
+		if timestamps {
+			line = append([]byte(msg.Time.Format(logTimeFormat)+" "), line...)
+		}
+		if err := containers.WriteFrame(w, stream, line); err != nil {
+			return err
+		}
+		if config.Follow && flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("返回容器日志失败: %v\n", err)
+	}
+}
+
+// 在容器中执行命令，升级连接，命令使用客户端的标准输入输出
+func (d *Daemon) execContainer(w http.ResponseWriter, r *http.Request, vars []string) {
+	var req ExecRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Cmd) == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("执行的命令不能为空"))
+		return
+	}
+	containerId := containers.ResolveContainerId(vars[0], false)
+	if containerId == "" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("无法根据提供的容器标识定位到容器: %s", vars[0]))
+		return
+	}
+	if req.Tty {
+		if !isAttachUpgrade(r) {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("exec -t 需要升级为 %s 连接", AttachUpgrade))
+			return
+		}
+		execTerminal(w, containerId, req.Cmd)
+		return
+	}
+	if !isStdioUpgrade(r) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("exec 需要升级为交互式连接"))
+		return
+	}
+	conn, stdio, err := hijackStdio(w)
+	if err != nil {
+		log.Printf("exec 容器失败: %v\n", err)
+		return
+	}
+	defer conn.Close()
+	err = run.Exec(containerId, req.Cmd, stdio)
+	closeFiles(stdio)
+	if err != nil {
+		writeStreamResult(conn, &StreamResult{Id: containerId, Message: err.Error()})
+		return
+	}
+	writeStreamResult(conn, &StreamResult{Id: containerId})
+}
+
+// 读取启动容器的配置
+func readRunConfig(w http.ResponseWriter, r *http.Request) (*containers.RunContainerConfig, bool) {
+	var config containers.RunContainerConfig
+	if err := readJSON(r, &config); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	if config.Image == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("镜像id不能为空"))
+		return nil, false
+	}
+	return &config, true
+}
+
+// 根据容器标识获取容器信息，找不到时返回 404
+func (d *Daemon) resolveContainer(w http.ResponseWriter, idOrName string) (*containers.ContainerInfo, bool) {
+	containerId := containers.ResolveContainerId(idOrName, false)
+	if containerId == "" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("无法根据提供的容器标识定位到容器: %s", idOrName))
+		return nil, false
+	}
+	info, err := containers.GetContainerInfo(containerId)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return nil, false
+	}
+	return info, true
+}
+
+// daemon 是容器 shim 进程的父进程，需要等待 shim 退出，回收子进程，避免产生僵尸进程
+// shim 退出后读取它记录的退出码，供 wait 接口使用，再根据重启策略决定是否重新启动，调用时需要持有锁
+func (d *Daemon) watch(info *containers.ContainerInfo, shim *exec.Cmd) {
+	exit := &containerExit{done: make(chan struct{})}
+	d.exits[info.Id] = exit
+	d.notify()
+	d.startHealthCheck(info, exit)
+	started := time.Now()
+	go func() {
+		if err := shim.Wait(); err != nil {
+			log.Printf("容器 %s 的 shim 进程退出: %v\n", info.Id, err)
+		}
+		exit.exitCode = -1
+		if latest, err := containers.GetContainerInfo(info.Id); err == nil && latest.FinishedAt != "" {
+			exit.exitCode = latest.ExitCode
+		}
+		close(exit.done)
+		d.handleExit(info.Id, time.Since(started))
+	}()
+}
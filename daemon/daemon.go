@@ -0,0 +1,116 @@
+package daemon
+
+import (
+	"containers"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"networks"
+	"os"
+	"os/signal"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultSocket daemon 默认监听的 unix socket
+const DefaultSocket = "/var/run/mydocker/mydocker.sock"
+
+// ApiVersion 接口版本，所有的接口路径都以 /v1 开头
+const ApiVersion = "v1"
+
+// Daemon 常驻的 mydocker 服务，持有容器，镜像，网络以及端口映射的状态
+// 所有的修改都在 daemon 进程中串行执行，避免多个命令行进程同时修改状态
+type Daemon struct {
+	// 修改状态时持有的锁
+	lock sync.Mutex
+	// 修改镜像时持有的锁，拉取和构建镜像的时间比较长，和 lock 分开，不影响容器的操作
+	// 同时需要两个锁时先获取 imageLock
+	imageLock sync.Mutex
+	// 接口路由
+	routes []route
+	// 当前 daemon 监控的容器最近一次运行的退出状态, key 是容器id
+	exits map[string]*containerExit
+	// 根据重启策略重新启动容器时的退避时间, key 是容器id
+	delays map[string]time.Duration
+	// 容器启动，退出或者删除时关闭，通知等待容器的请求重新检查状态
+	changed chan struct{}
+}
+
+// containerExit 容器一次运行的退出状态，容器退出时关闭 done
+type containerExit struct {
+	done     chan struct{}
+	exitCode int
+}
+
+// 容器是否已经退出
+func (e *containerExit) exited() bool {
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// 通知等待容器的请求容器的状态发生了变化，调用时需要持有锁
+func (d *Daemon) notify() {
+	close(d.changed)
+	d.changed = make(chan struct{})
+}
+
+// Start 启动 daemon，监听 unix socket，阻塞直到 daemon 退出
+func Start(socket string) error {
+	if err := os.MkdirAll(path.Dir(socket), 0755); err != nil {
+		return fmt.Errorf("创建目录 %s 失败: %v", path.Dir(socket), err)
+	}
+	if containers.FileExist(socket) {
+		// socket 可以连接，说明已经有 daemon 在运行
+		if conn, err := net.Dial("unix", socket); err == nil {
+			conn.Close()
+			return fmt.Errorf("mydocker daemon 已经在运行: %s", socket)
+		}
+		// 删除上次遗留的 socket 文件
+		if err := os.Remove(socket); err != nil {
+			return fmt.Errorf("删除 socket 文件 %s 失败: %v", socket, err)
+		}
+	}
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("监听 %s 失败: %v", socket, err)
+	}
+	if err := os.Chmod(socket, 0660); err != nil {
+		log.Printf("修改 socket 权限失败: %v\n", err)
+	}
+	// 加载网络，恢复运行中容器的端口映射
+	if err := networks.Init(); err != nil {
+		log.Printf("加载网络失败: %v\n", err)
+	}
+	networks.RestorePortMapping(containers.GetContainerInfoList())
+
+	d := &Daemon{
+		exits:   map[string]*containerExit{},
+		delays:  map[string]time.Duration{},
+		changed: make(chan struct{}),
+	}
+	d.initRoutes()
+	d.restoreContainers()
+	server := &http.Server{Handler: d}
+	// 收到退出信号时关闭服务，删除 socket 文件
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Printf("收到信号 %v, daemon 退出\n", sig)
+		server.Close()
+	}()
+	log.Printf("mydocker daemon 启动, 监听 %s\n", socket)
+	err = server.Serve(listener)
+	_ = os.Remove(socket)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package daemon
+
+import (
+	"containers"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// 持续读取事件日志时检查新事件的间隔
+const eventsPollInterval = 200 * time.Millisecond
+
+// 以 json lines 的格式返回事件，参数 since, until 是 unix 时间戳，filter 是过滤条件，可以指定多个
+// 没有 since 时只返回之后发生的事件，没有 until 时一直等待新的事件，直到客户端断开连接
+func (d *Daemon) events(w http.ResponseWriter, r *http.Request, vars []string) {
+	query := r.URL.Query()
+	filter, err := containers.ParseEventFilter(query["filter"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	now := time.Now()
+	since, until := now, time.Time{}
+	if value := query.Get("since"); value != "" {
+		if since, err = containers.ParseEventTime(value, now); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if value := query.Get("until"); value != "" {
+		if until, err = containers.ParseEventTime(value, now); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if !until.IsZero() && until.Before(since) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("until 不能早于 since"))
+		return
+	}
+	history, cursor, err := containers.ReadEvents()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("读取事件日志失败: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	// 返回时间范围内满足条件的事件，超过 until 时返回 false
+	send := func(events []*containers.Event) bool {
+		matched, more := containers.FilterEvents(events, since, until, filter)
+		for _, event := range matched {
+			if err := encoder.Encode(event); err != nil {
+				return false
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return more
+	}
+	if !send(history) {
+		return
+	}
+	ticker := time.NewTicker(eventsPollInterval)
+	defer ticker.Stop()
+	for {
+		if !until.IsZero() && time.Now().After(until) {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		events, err := cursor.Next()
+		if err != nil {
+			return
+		}
+		if !send(events) {
+			return
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package daemon
+
+import (
+	"containers"
+	"log"
+	"networks"
+	"run"
+	"time"
+)
+
+// 定期在容器中执行健康检查命令，直到容器退出，调用时需要持有锁
+// 容器启动后等待一个检查间隔再执行第一次检查，暂停的容器跳过检查
+func (d *Daemon) startHealthCheck(info *containers.ContainerInfo, exit *containerExit) {
+	config := info.HealthCheck
+	if !config.Enabled() {
+		return
+	}
+	containerId := info.Id
+	go func() {
+		started := time.Now()
+		timer := time.NewTimer(config.Interval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-exit.done:
+				return
+			case <-timer.C:
+			}
+			timer.Reset(config.Interval)
+			latest, err := containers.GetContainerInfo(containerId)
+			if err != nil || !latest.IsRunning() {
+				return
+			}
+			if latest.Status == containers.Paused {
+				continue
+			}
+			probe := containers.RunHealthProbe(latest, config)
+			countFailure := time.Since(started) >= config.StartPeriod
+			latest, changed, err := containers.RecordHealthProbe(containerId, probe, config.Retries, countFailure)
+			if err != nil {
+				log.Printf("记录容器 %s 的健康检查结果失败: %v\n", containerId, err)
+				continue
+			}
+			if changed {
+				d.lock.Lock()
+				d.handleHealthChange(latest)
+				d.lock.Unlock()
+			}
+		}
+	}()
+}
+
+// 容器的健康状态发生变化，调用时需要持有锁
+// 健康检查失败的容器移除端口映射，有重启策略时杀死容器，由重启策略重新启动，恢复健康后重新添加端口映射
+func (d *Daemon) handleHealthChange(info *containers.ContainerInfo) {
+	switch info.Health.Status {
+	case containers.HealthHealthy:
+		networks.EnablePortMapping(info)
+	case containers.HealthUnhealthy:
+		log.Printf("容器 %s 健康检查连续失败 %d 次\n", info.Id, info.Health.FailingStreak)
+		networks.DisablePortMapping(info)
+		if info.RestartPolicy != nil && info.RestartPolicy.Name != containers.RestartNo {
+			log.Printf("容器 %s 根据重启策略 %s 重新启动\n", info.Id, info.RestartPolicy)
+			if err := run.Kill(info.Id, "SIGKILL", false); err != nil {
+				log.Printf("杀死健康检查失败的容器 %s 失败: %v\n", info.Id, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package daemon
+
+import (
+	"containers"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"registry"
+	"run"
+)
+
+func (d *Daemon) listImages(w http.ResponseWriter, r *http.Request, vars []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	writeJSON(w, http.StatusOK, containers.GetImageInfoList())
+}
+
+// 根据镜像名称或者id获取镜像的详细信息
+func (d *Daemon) inspectImage(w http.ResponseWriter, r *http.Request, vars []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	imageId, err := containers.FindImageId(vars[0])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	info, err := containers.GetImageInfo(imageId)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, containers.InspectImage(info))
+}
+
+// 删除镜像，参数 force 为 true 时强制删除，返回去掉的名称和删除的镜像
+func (d *Daemon) removeImage(w http.ResponseWriter, r *http.Request, vars []string) {
+	d.imageLock.Lock()
+	defer d.imageLock.Unlock()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, err := containers.FindImageId(vars[0]); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	result, err := containers.RemoveImage(vars[0], r.URL.Query().Get("force") == "true")
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// 给镜像加上参数 tag 指定的名称
+func (d *Daemon) tagImage(w http.ResponseWriter, r *http.Request, vars []string) {
+	d.imageLock.Lock()
+	defer d.imageLock.Unlock()
+	if _, err := containers.FindImageId(vars[0]); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err := containers.TagImage(vars[0], r.URL.Query().Get("tag")); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// 镜像的每个镜像层和创建它的指令
+func (d *Daemon) imageHistory(w http.ResponseWriter, r *http.Request, vars []string) {
+	d.imageLock.Lock()
+	defer d.imageLock.Unlock()
+	if _, err := containers.FindImageId(vars[0]); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	history, err := containers.GetImageHistory(vars[0])
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// 删除没有名称，没有被容器使用，也不是其他镜像的基础镜像的镜像
+func (d *Daemon) pruneImages(w http.ResponseWriter, r *http.Request, vars []string) {
+	d.imageLock.Lock()
+	defer d.imageLock.Unlock()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	deleted, reclaimed, err := containers.PruneImages()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &ImagePruneResponse{Deleted: deleted, SpaceReclaimed: reclaimed})
+}
+
+// 提交容器为镜像，参数 pause 为 true 时提交期间暂停运行中的容器
+func (d *Daemon) commitContainer(w http.ResponseWriter, r *http.Request, vars []string) {
+	var req CommitRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	d.imageLock.Lock()
+	defer d.imageLock.Unlock()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	info, ok := d.resolveContainer(w, vars[0])
+	if !ok {
+		return
+	}
+	if req.Pause && info.Status == containers.Running {
+		if err := run.Pause(info.Id); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		defer func() {
+			if err := run.Unpause(info.Id); err != nil {
+				log.Printf("恢复容器 %s 失败: %v\n", info.Id, err)
+			}
+		}()
+	}
+	image, err := containers.CommitContainer(info.Id, req.Tag, req.Changes, req.Author, req.Message)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, image)
+}
+
+// 导入 tar 包作为基础镜像
+func (d *Daemon) buildBaseImage(w http.ResponseWriter, r *http.Request, vars []string) {
+	var req BaseImageRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	d.imageLock.Lock()
+	defer d.imageLock.Unlock()
+	image, err := containers.BuildBaseImage(req.File)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, image)
+}
+
+// 保存镜像或者容器的文件系统到 tar 文件
+func (d *Daemon) saveImages(w http.ResponseWriter, r *http.Request, vars []string) {
+	var req SaveRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Output == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("保存的文件路径不能为空"))
+		return
+	}
+	d.imageLock.Lock()
+	defer d.imageLock.Unlock()
+	var err error
+	if req.Container != "" {
+		d.lock.Lock()
+		err = containers.SaveContainer(req.Container, req.Output)
+		d.lock.Unlock()
+	} else {
+		err = containers.SaveImages(req.Images, req.Output)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// 根据 Dockerfile 构建镜像，构建的输出写到客户端的标准输出
+func (d *Daemon) buildImage(w http.ResponseWriter, r *http.Request, vars []string) {
+	var req BuildRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	d.streamImage(w, r, "build", func(stdio []*os.File) (string, error) {
+		image, err := containers.BuildImage(req.Tag, req.Dockerfile, req.Context, stdio[1])
+		if err != nil {
+			return "", err
+		}
+		return image.Id, nil
+	})
+}
+
+// 从仓库拉取镜像，进度写到客户端的标准输出
+func (d *Daemon) pullImage(w http.ResponseWriter, r *http.Request, vars []string) {
+	var req PullRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	options := &registry.Options{Insecure: req.Insecure, AuthFile: req.AuthFile}
+	d.streamImage(w, r, "pull", func(stdio []*os.File) (string, error) {
+		image, err := containers.PullImage(req.Name, options, stdio[1])
+		if err != nil {
+			return "", err
+		}
+		return image.Id, nil
+	})
+}
+
+// 推送镜像到仓库，进度写到客户端的标准输出
+func (d *Daemon) pushImage(w http.ResponseWriter, r *http.Request, vars []string) {
+	var req PushRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	options := &registry.Options{Insecure: req.Insecure, AuthFile: req.AuthFile, ChunkSize: req.ChunkSize}
+	d.streamImage(w, r, "push", func(stdio []*os.File) (string, error) {
+		return "", containers.PushImage(vars[0], req.Target, options, stdio[1])
+	})
+}
+
+// 导入镜像归档，没有指定文件时从客户端的标准输入读取
+func (d *Daemon) loadImages(w http.ResponseWriter, r *http.Request, vars []string) {
+	var req LoadRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	d.streamImage(w, r, "load", func(stdio []*os.File) (string, error) {
+		images, err := containers.LoadImages(req.Input, stdio[0], stdio[1])
+		for _, info := range images {
+			name := info.Name
+			if info.Version != "" {
+				name += ":" + info.Version
+			}
+			fmt.Fprintf(stdio[1], "导入镜像 %s %s\n", containers.ShortImageId(info.Id), name)
+		}
+		return "", err
+	})
+}
+
+// 升级连接后持有 imageLock 执行镜像操作，op 使用客户端的标准输入输出，返回镜像id
+func (d *Daemon) streamImage(w http.ResponseWriter, r *http.Request, action string, op func(stdio []*os.File) (string, error)) {
+	if !isStdioUpgrade(r) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%s 需要升级为交互式连接", action))
+		return
+	}
+	conn, stdio, err := hijackStdio(w)
+	if err != nil {
+		log.Printf("%s 镜像失败: %v\n", action, err)
+		return
+	}
+	defer conn.Close()
+	d.imageLock.Lock()
+	id, err := op(stdio)
+	d.imageLock.Unlock()
+	closeFiles(stdio)
+	if err != nil {
+		writeStreamResult(conn, &StreamResult{Id: id, Message: err.Error()})
+		return
+	}
+	writeStreamResult(conn, &StreamResult{Id: id})
+}
@@ -0,0 +1,73 @@
+package daemon
+
+import (
+	"fmt"
+	"net/http"
+	"networks"
+	"portmapping"
+)
+
+func (d *Daemon) listNetworks(w http.ResponseWriter, r *http.Request, vars []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	writeJSON(w, http.StatusOK, networks.GetNetworkList())
+}
+
+// 获取网络的详细信息
+func (d *Daemon) inspectNetwork(w http.ResponseWriter, r *http.Request, vars []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	info, err := networks.InspectNetwork(vars[0])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (d *Daemon) createNetwork(w http.ResponseWriter, r *http.Request, vars []string) {
+	var req NetworkCreateRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("缺少网络名称"))
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err := networks.CreateNetwork(req.Driver, req.Subnet, req.Name); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("create network error: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+func (d *Daemon) removeNetwork(w http.ResponseWriter, r *http.Request, vars []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err := networks.DeleteNetwork(vars[0]); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("remove network error: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+func (d *Daemon) listPortMapping(w http.ResponseWriter, r *http.Request, vars []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	writeJSON(w, http.StatusOK, portmapping.ListPortMapping())
+}
+
+func (d *Daemon) updatePortMapping(w http.ResponseWriter, r *http.Request, vars []string) {
+	var req networks.PortMappingStruct
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	networks.ApplyPortMapping(req.PortMapping, req.PortUnMapping)
+	writeJSON(w, http.StatusNoContent, nil)
+}
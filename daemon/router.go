@@ -0,0 +1,158 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// handler 接口处理函数, vars 是路径中 * 匹配到的值
+type handler func(w http.ResponseWriter, r *http.Request, vars []string)
+
+// route 接口路由, pattern 中的 * 匹配路径中的任意一段，例如 containers/*/stop
+type route struct {
+	method  string
+	pattern []string
+	handler handler
+}
+
+func (d *Daemon) initRoutes() {
+	d.addRoute(http.MethodGet, "version", d.version)
+	d.addRoute(http.MethodGet, "events", d.events)
+	// 容器
+	d.addRoute(http.MethodGet, "containers", d.listContainers)
+	d.addRoute(http.MethodPost, "containers", d.runContainer)
+	d.addRoute(http.MethodPost, "containers/create", d.createContainer)
+	d.addRoute(http.MethodGet, "containers/*", d.inspectContainer)
+	d.addRoute(http.MethodPost, "containers/*/start", d.startContainer)
+	d.addRoute(http.MethodPost, "containers/*/stop", d.stopContainer)
+	d.addRoute(http.MethodPost, "containers/*/restart", d.restartContainer)
+	d.addRoute(http.MethodPost, "containers/*/kill", d.killContainer)
+	d.addRoute(http.MethodPost, "containers/*/pause", d.pauseContainer)
+	d.addRoute(http.MethodPost, "containers/*/unpause", d.unpauseContainer)
+	d.addRoute(http.MethodPost, "containers/*/wait", d.waitContainer)
+	d.addRoute(http.MethodGet, "containers/*/logs", d.containerLogs)
+	d.addRoute(http.MethodGet, "containers/*/top", d.topContainer)
+	d.addRoute(http.MethodGet, "containers/*/stats", d.containerStats)
+	d.addRoute(http.MethodPost, "containers/*/attach", d.attachContainer)
+	d.addRoute(http.MethodPost, "containers/*/exec", d.execContainer)
+	d.addRoute(http.MethodPost, "containers/*/commit", d.commitContainer)
+	d.addRoute(http.MethodDelete, "containers/*", d.removeContainer)
+	// 镜像
+	d.addRoute(http.MethodGet, "images", d.listImages)
+	d.addRoute(http.MethodPost, "images/prune", d.pruneImages)
+	d.addRoute(http.MethodPost, "images/build", d.buildImage)
+	d.addRoute(http.MethodPost, "images/base", d.buildBaseImage)
+	d.addRoute(http.MethodPost, "images/pull", d.pullImage)
+	d.addRoute(http.MethodPost, "images/load", d.loadImages)
+	d.addRoute(http.MethodPost, "images/save", d.saveImages)
+	d.addRoute(http.MethodGet, "images/*", d.inspectImage)
+	d.addRoute(http.MethodDelete, "images/*", d.removeImage)
+	d.addRoute(http.MethodPost, "images/*/tag", d.tagImage)
+	d.addRoute(http.MethodGet, "images/*/history", d.imageHistory)
+	d.addRoute(http.MethodPost, "images/*/push", d.pushImage)
+	// 网络
+	d.addRoute(http.MethodGet, "networks", d.listNetworks)
+	d.addRoute(http.MethodGet, "networks/*", d.inspectNetwork)
+	d.addRoute(http.MethodPost, "networks", d.createNetwork)
+	d.addRoute(http.MethodDelete, "networks/*", d.removeNetwork)
+	// 卷
+	d.addRoute(http.MethodGet, "volumes/*", d.inspectVolume)
+	// 端口映射
+	d.addRoute(http.MethodGet, "portmap", d.listPortMapping)
+	d.addRoute(http.MethodPost, "portmap", d.updatePortMapping)
+}
+
+func (d *Daemon) addRoute(method string, pattern string, h handler) {
+	d.routes = append(d.routes, route{
+		method:  method,
+		pattern: strings.Split(pattern, "/"),
+		handler: h,
+	})
+}
+
+// ServeHTTP 根据请求的方法和路径分发到对应的处理函数
+func (d *Daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.Path)
+	prefix := "/" + ApiVersion + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("不支持的接口: %s", r.URL.Path))
+		return
+	}
+	// 按照转义后的路径切分，路径参数中可以包含转义的 /，例如卷的宿主机目录
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), prefix), "/"), "/")
+	for i, part := range parts {
+		if unescaped, err := url.PathUnescape(part); err == nil {
+			parts[i] = unescaped
+		}
+	}
+	pathMatched := false
+	for _, rt := range d.routes {
+		vars, ok := rt.match(parts)
+		if !ok {
+			continue
+		}
+		pathMatched = true
+		if rt.method != r.Method {
+			continue
+		}
+		rt.handler(w, r, vars)
+		return
+	}
+	if pathMatched {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("接口 %s 不支持 %s 方法", r.URL.Path, r.Method))
+		return
+	}
+	writeError(w, http.StatusNotFound, fmt.Errorf("不支持的接口: %s", r.URL.Path))
+}
+
+// 匹配路径，返回 * 匹配到的值
+func (rt route) match(parts []string) ([]string, bool) {
+	if len(parts) != len(rt.pattern) {
+		return nil, false
+	}
+	var vars []string
+	for i, p := range rt.pattern {
+		if p == "*" {
+			vars = append(vars, parts[i])
+			continue
+		}
+		if p != parts[i] {
+			return nil, false
+		}
+	}
+	return vars, true
+}
+
+// 以 json 格式返回结果
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if v == nil {
+		return
+	}
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("返回结果失败: %v\n", err)
+	}
+}
+
+// 返回错误信息
+func writeError(w http.ResponseWriter, code int, err error) {
+	log.Printf("请求失败: %v\n", err)
+	writeJSON(w, code, &ErrorResponse{Message: err.Error()})
+}
+
+// 解析请求体
+func readJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fmt.Errorf("解析请求参数失败: %v", err)
+	}
+	return nil
+}
+
+func (d *Daemon) version(w http.ResponseWriter, r *http.Request, vars []string) {
+	writeJSON(w, http.StatusOK, &VersionResponse{ApiVersion: ApiVersion})
+}
@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// StdioUpgrade 交互式接口(run -ti, exec)使用的协议
+// 连接升级后，客户端通过 unix socket 把自己的标准输入，标准输出，标准错误的文件描述符传递给 daemon,
+// daemon 直接把这些文件描述符交给容器进程使用，接口结束时 daemon 返回一行 json 格式的 StreamResult
+const StdioUpgrade = "mydocker-stdio"
+
+// 请求是否要求升级为交互式连接
+func isStdioUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), StdioUpgrade)
+}
+
+// hijackStdio 升级连接，并接收客户端传递的标准输入，标准输出，标准错误
+func hijackStdio(w http.ResponseWriter) (net.Conn, []*os.File, error) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("连接不支持升级")
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, fmt.Errorf("升级连接失败: %v", err)
+	}
+	_, _ = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: " + StdioUpgrade + "\r\n\r\n")
+	if err := buf.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("升级连接失败: %v", err)
+	}
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		conn.Close()
+		return nil, nil, fmt.Errorf("只有 unix socket 支持交互式连接")
+	}
+	files, err := receiveFiles(unixConn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, files, nil
+}
+
+// 接收 unix socket 传递过来的文件描述符，依次为标准输入，标准输出，标准错误
+func receiveFiles(conn *net.UnixConn) ([]*os.File, error) {
+	buf := make([]byte, 1)
+	oob := make([]byte, syscall.CmsgSpace(3*4))
+	_, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return nil, fmt.Errorf("接收文件描述符失败: %v", err)
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, fmt.Errorf("解析文件描述符失败: %v", err)
+	}
+	var files []*os.File
+	for i := range msgs {
+		fds, err := syscall.ParseUnixRights(&msgs[i])
+		if err != nil {
+			closeFiles(files)
+			return nil, fmt.Errorf("解析文件描述符失败: %v", err)
+		}
+		for _, fd := range fds {
+			files = append(files, os.NewFile(uintptr(fd), "stdio"))
+		}
+	}
+	if len(files) != 3 {
+		closeFiles(files)
+		return nil, fmt.Errorf("需要传递3个文件描述符, 实际为 %d 个", len(files))
+	}
+	return files, nil
+}
+
+// 交互式接口结束，返回结果
+func writeStreamResult(conn net.Conn, result *StreamResult) {
+	if err := json.NewEncoder(conn).Encode(result); err != nil {
+		log.Printf("返回结果失败: %v\n", err)
+	}
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
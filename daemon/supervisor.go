@@ -0,0 +1,96 @@
+package daemon
+
+import (
+	"containers"
+	"log"
+	"run"
+	"time"
+)
+
+// 根据重启策略重新启动容器时的退避时间，连续重启时每次翻倍，
+// 容器运行超过 backoffResetTime 后重新从 minRestartDelay 开始
+const (
+	minRestartDelay  = 100 * time.Millisecond
+	maxRestartDelay  = time.Minute
+	backoffResetTime = 10 * time.Second
+)
+
+// 容器退出后根据重启策略决定是否重新启动, runTime 是容器这次运行的时间
+func (d *Daemon) handleExit(containerId string, runTime time.Duration) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.notify()
+	info, err := containers.GetContainerInfo(containerId)
+	if err != nil || !info.ShouldRestart(false) {
+		delete(d.delays, containerId)
+		return
+	}
+	delay := d.delays[containerId] * 2
+	if delay < minRestartDelay || runTime >= backoffResetTime {
+		delay = minRestartDelay
+	}
+	if delay > maxRestartDelay {
+		delay = maxRestartDelay
+	}
+	d.delays[containerId] = delay
+	log.Printf("容器 %s 退出, 退出码: %d, %v 后根据重启策略 %s 重新启动\n", containerId, info.ExitCode, delay, info.RestartPolicy)
+	time.AfterFunc(delay, func() {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		d.autoRestart(containerId, false)
+	})
+}
+
+// 根据重启策略重新启动容器，调用时需要持有锁
+func (d *Daemon) autoRestart(containerId string, daemonStart bool) {
+	info, err := containers.GetContainerInfo(containerId)
+	// 等待期间容器可能被手动启动，停止或者删除
+	if err != nil || !info.ShouldRestart(daemonStart) {
+		return
+	}
+	info.RestartCount++
+	shim, err := run.Start(info, nil)
+	if err != nil {
+		log.Printf("根据重启策略重新启动容器 %s 失败: %v\n", containerId, err)
+		return
+	}
+	d.watch(info, shim)
+}
+
+// 监控不是由当前 daemon 启动的容器，例如 daemon 重启之前启动的容器
+// daemon 不是这些容器 shim 进程的父进程，只能等待 shim 记录退出信息，调用时需要持有锁
+func (d *Daemon) monitor(containerId string) {
+	exit := &containerExit{done: make(chan struct{})}
+	d.exits[containerId] = exit
+	if info, err := containers.GetContainerInfo(containerId); err == nil {
+		d.startHealthCheck(info, exit)
+	}
+	go func() {
+		for !run.WaitExit(containerId, time.Minute) {
+		}
+		exit.exitCode = -1
+		if latest, err := containers.GetContainerInfo(containerId); err == nil && latest.FinishedAt != "" {
+			exit.exitCode = latest.ExitCode
+		}
+		close(exit.done)
+		d.handleExit(containerId, backoffResetTime)
+	}()
+}
+
+// daemon 启动时恢复容器，shim 还在运行的容器继续监控，
+// shim 已经不存在的运行中的容器标记为退出，例如宿主机重启，然后根据重启策略重新启动
+func (d *Daemon) restoreContainers() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, info := range containers.GetContainerInfoList() {
+		if run.ShimRunning(info) {
+			d.monitor(info.Id)
+			continue
+		}
+		if info.IsRunning() {
+			log.Printf("容器 %s 的 shim 进程已经不存在, 标记为退出\n", info.Id)
+			run.MarkExited(info.Id)
+		}
+		d.autoRestart(info.Id, true)
+	}
+}
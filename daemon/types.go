@@ -0,0 +1,115 @@
+package daemon
+
+// ErrorResponse 接口调用失败时返回的信息
+type ErrorResponse struct {
+	Message string `json:"message"`
+}
+
+// VersionResponse 版本信息
+type VersionResponse struct {
+	ApiVersion string `json:"apiVersion"`
+}
+
+// ExecRequest 在容器中执行命令的参数
+type ExecRequest struct {
+	Cmd []string `json:"cmd"`
+	// 为 true 时分配伪终端，需要升级为 attach 连接
+	Tty bool `json:"tty"`
+}
+
+// 等待容器的条件
+const (
+	// WaitNotRunning 默认条件，容器没有运行时立即返回，否则等待容器退出
+	WaitNotRunning = "not-running"
+	// WaitNextExit 等待容器下一次退出，容器没有运行时等待容器启动后再退出
+	WaitNextExit = "next-exit"
+	// WaitRemoved 等待容器被删除
+	WaitRemoved = "removed"
+)
+
+// WaitResponse 等待容器退出的结果
+type WaitResponse struct {
+	// 容器的退出码，无法获取时为 -1
+	ExitCode int `json:"exitCode"`
+}
+
+// NetworkCreateRequest 创建网络的参数
+type NetworkCreateRequest struct {
+	Name   string `json:"name"`
+	Driver string `json:"driver"`
+	Subnet string `json:"subnet"`
+}
+
+// CommitRequest 提交容器为镜像的参数
+type CommitRequest struct {
+	// 镜像名称:版本
+	Tag string `json:"tag"`
+	// dockerfile 格式的指令，修改镜像的配置
+	Changes []string `json:"changes"`
+	Author  string   `json:"author"`
+	Message string   `json:"message"`
+	// 提交时暂停运行中的容器，保证文件系统的内容一致
+	Pause bool `json:"pause"`
+}
+
+// BuildRequest 构建镜像的参数，路径都是绝对路径
+type BuildRequest struct {
+	Tag        string `json:"tag"`
+	Dockerfile string `json:"dockerfile"`
+	// 构建上下文目录，ADD 和 COPY 的源路径相对于这个目录
+	Context string `json:"context"`
+}
+
+// BaseImageRequest 导入基础镜像的参数
+type BaseImageRequest struct {
+	// tar 包的绝对路径
+	File string `json:"file"`
+}
+
+// PullRequest 拉取镜像的参数
+type PullRequest struct {
+	Name     string `json:"name"`
+	Insecure bool   `json:"insecure"`
+	// 凭据文件的绝对路径，为空时使用 daemon 的默认凭据文件
+	AuthFile string `json:"authFile"`
+}
+
+// PushRequest 推送镜像的参数
+type PushRequest struct {
+	// 推送的名称，为空时使用镜像的名称
+	Target    string `json:"target"`
+	Insecure  bool   `json:"insecure"`
+	AuthFile  string `json:"authFile"`
+	ChunkSize int64  `json:"chunkSize"`
+}
+
+// LoadRequest 导入镜像归档的参数
+type LoadRequest struct {
+	// 镜像归档的绝对路径，为空时从客户端的标准输入读取 tar
+	Input string `json:"input"`
+}
+
+// SaveRequest 保存镜像或者容器的文件系统的参数
+type SaveRequest struct {
+	Images []string `json:"images"`
+	// 容器标识，不为空时保存容器的文件系统
+	Container string `json:"container"`
+	// 保存的绝对路径
+	Output string `json:"output"`
+}
+
+// ImagePruneResponse 清理镜像的结果
+type ImagePruneResponse struct {
+	// 删除的镜像id
+	Deleted []string `json:"deleted"`
+	// 删除的镜像层回收的空间，字节数
+	SpaceReclaimed int64 `json:"spaceReclaimed"`
+}
+
+// StreamResult 交互式接口结束时返回的结果
+type StreamResult struct {
+	// 容器id
+	Id string `json:"id"`
+	// 失败时的错误信息
+	Message string `json:"message,omitempty"`
+}
@@ -0,0 +1,18 @@
+package daemon
+
+import (
+	"containers"
+	"net/http"
+)
+
+// 根据匿名卷的id或者宿主机目录获取卷的信息
+func (d *Daemon) inspectVolume(w http.ResponseWriter, r *http.Request, vars []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	info, err := containers.InspectVolume(vars[0])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
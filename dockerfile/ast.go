@@ -0,0 +1,125 @@
+package dockerfile
+
+import "fmt"
+
+// 支持的指令
+const (
+	From        = "FROM"
+	Run         = "RUN"
+	Cmd         = "CMD"
+	Label       = "LABEL"
+	Maintainer  = "MAINTAINER"
+	Expose      = "EXPOSE"
+	Env         = "ENV"
+	Add         = "ADD"
+	Copy        = "COPY"
+	Entrypoint  = "ENTRYPOINT"
+	Volume      = "VOLUME"
+	User        = "USER"
+	Workdir     = "WORKDIR"
+	Arg         = "ARG"
+	Onbuild     = "ONBUILD"
+	StopSignal  = "STOPSIGNAL"
+	Healthcheck = "HEALTHCHECK"
+	Shell       = "SHELL"
+)
+
+// File 解析后的 dockerfile
+type File struct {
+	// 文件开头的解析器指令，例如 # syntax=docker/dockerfile:1 和 # escape=`，key 为小写
+	Directives map[string]string
+	// 转义字符，默认为 \，可以通过 # escape= 修改为 `
+	Escape rune
+	// 按顺序排列的指令
+	Instructions []*Instruction
+	// 不影响解析的问题，例如续行中的空行
+	Warnings []string
+}
+
+// Instruction 一条指令，续行已经合并
+type Instruction struct {
+	// 大写的指令名称
+	Command string
+	// 指令所在的行，从 1 开始，包括续行和 heredoc
+	StartLine int
+	EndLine   int
+	// 合并续行之后的指令文本，不包括 heredoc 的内容
+	Source string
+	// 指令名称之后的 --key=value 参数，例如 COPY --from=builder
+	Flags []*Flag
+	// JSON 数组格式时为 true，Args 为数组的元素
+	JSON bool
+	// shell 格式时为按空白拆分的单词，保留引号和转义字符，使用 Words 处理引号和变量替换
+	Args []string
+	// 去掉指令名称和参数之后的原始文本，RUN CMD ENTRYPOINT 的 shell 格式交给 shell 执行
+	Original string
+	// RUN COPY ADD 中的 heredoc，按出现的顺序排列
+	Heredocs []*Heredoc
+	// HEALTHCHECK CMD 和 ONBUILD 中的指令
+	Next *Instruction
+	// 解析时使用的转义字符
+	escape rune
+}
+
+// Flag 指令的 --key=value 参数，只写 --key 时 Value 为空
+type Flag struct {
+	Name  string
+	Value string
+}
+
+// Heredoc <<EOF 到 EOF 之间的内容
+type Heredoc struct {
+	// 结束标记，例如 EOF
+	Name string
+	// 内容，每行以换行结尾，<<- 时去掉了每行开头的 tab
+	Content string
+	// 结束标记没有使用引号时，内容中的变量需要替换
+	Expand bool
+	// 使用 <<- 时为 true
+	Chomp bool
+}
+
+// KeyValue ENV LABEL ARG 中的一项，ARG 没有默认值时 HasValue 为 false
+type KeyValue struct {
+	Key      string
+	Value    string
+	HasValue bool
+}
+
+// Error 带有行号的解析错误
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("dockerfile 第 %d 行: %s", e.Line, e.Msg)
+}
+
+func errorf(line int, format string, args ...interface{}) *Error {
+	return &Error{Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Flag 返回参数的值，没有这个参数时 ok 为 false
+func (i *Instruction) Flag(name string) (string, bool) {
+	for _, flag := range i.Flags {
+		if flag.Name == name {
+			return flag.Value, true
+		}
+	}
+	return "", false
+}
+
+// Heredoc 返回名称为 name 的 heredoc
+func (i *Instruction) Heredoc(name string) *Heredoc {
+	for _, heredoc := range i.Heredocs {
+		if heredoc.Name == name {
+			return heredoc
+		}
+	}
+	return nil
+}
+
+func (i *Instruction) errorf(format string, args ...interface{}) *Error {
+	return errorf(i.StartLine, "%s %s", i.Command, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,3 @@
+module dockerfile
+
+go 1.20
@@ -0,0 +1,143 @@
+package dockerfile
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// 解析器指令只能出现在文件开头，格式为 # key=value
+var directivePattern = regexp.MustCompile(`^#\s*([a-zA-Z][a-zA-Z0-9]*)\s*=\s*(.+?)\s*$`)
+
+// 支持的解析器指令，其他格式相同的注释作为普通注释
+var knownDirectives = map[string]bool{"syntax": true, "escape": true, "check": true}
+
+// 默认的转义字符
+const defaultEscape = '\\'
+
+// lexer 把文件拆分为逻辑行，处理解析器指令，注释，续行和 heredoc
+type lexer struct {
+	lines []string
+	// 下一个要读取的行的下标，行号为 pos+1
+	pos    int
+	escape rune
+	// 收集到的警告
+	warnings []string
+}
+
+// logicalLine 合并续行之后的一条指令文本
+type logicalLine struct {
+	text      string
+	startLine int
+	endLine   int
+}
+
+func newLexer(r io.Reader) (*lexer, error) {
+	l := &lexer{escape: defaultEscape}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if len(l.lines) == 0 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		l.lines = append(l.lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// 读取文件开头的解析器指令，遇到第一个不是解析器指令的行时结束
+func (l *lexer) directives() (map[string]string, error) {
+	directives := map[string]string{}
+	for ; l.pos < len(l.lines); l.pos++ {
+		match := directivePattern.FindStringSubmatch(l.lines[l.pos])
+		if match == nil {
+			break
+		}
+		key := strings.ToLower(match[1])
+		if !knownDirectives[key] {
+			break
+		}
+		if _, ok := directives[key]; ok {
+			return nil, errorf(l.pos+1, "解析器指令 %s 重复", key)
+		}
+		directives[key] = match[2]
+	}
+	if escape, ok := directives["escape"]; ok {
+		if escape != "\\" && escape != "`" {
+			return nil, errorf(1, "转义字符只能是 \\ 或者 `, 不能是 %s", escape)
+		}
+		l.escape = rune(escape[0])
+	}
+	return directives, nil
+}
+
+// 读取下一条指令的文本，跳过空行和注释，合并以转义字符结尾的续行
+// 续行中的注释被去掉，续行中的空行被忽略并记录警告，文件结束时返回 false
+func (l *lexer) next() (*logicalLine, bool) {
+	for l.pos < len(l.lines) && isBlankOrComment(l.lines[l.pos]) {
+		l.pos++
+	}
+	if l.pos >= len(l.lines) {
+		return nil, false
+	}
+	line := &logicalLine{startLine: l.pos + 1}
+	var text strings.Builder
+	for l.pos < len(l.lines) {
+		current, continued := l.trimContinuation(l.lines[l.pos])
+		text.WriteString(current)
+		line.endLine = l.pos + 1
+		l.pos++
+		if !continued {
+			break
+		}
+		for l.pos < len(l.lines) && isBlankOrComment(l.lines[l.pos]) {
+			if strings.TrimSpace(l.lines[l.pos]) == "" {
+				l.warnf(l.pos+1, "续行中的空行被忽略")
+			}
+			l.pos++
+		}
+	}
+	line.text = text.String()
+	return line, true
+}
+
+// 去掉行尾的转义字符，返回去掉之后的文本以及是否还有续行
+func (l *lexer) trimContinuation(line string) (string, bool) {
+	trimmed := strings.TrimRight(line, " \t")
+	if !strings.HasSuffix(trimmed, string(l.escape)) {
+		return line, false
+	}
+	return trimmed[:len(trimmed)-1], true
+}
+
+// 读取 heredoc 的内容，直到只有结束标记的一行，chomp 时去掉每行开头的 tab
+func (l *lexer) heredoc(name string, chomp bool, startLine int) (string, error) {
+	var content strings.Builder
+	for ; l.pos < len(l.lines); l.pos++ {
+		line := l.lines[l.pos]
+		if chomp {
+			line = strings.TrimLeft(line, "\t")
+		}
+		if line == name {
+			l.pos++
+			return content.String(), nil
+		}
+		content.WriteString(line)
+		content.WriteString("\n")
+	}
+	return "", errorf(startLine, "heredoc %s 没有结束标记", name)
+}
+
+func (l *lexer) warnf(line int, format string, args ...interface{}) {
+	l.warnings = append(l.warnings, errorf(line, format, args...).Error())
+}
+
+func isBlankOrComment(line string) bool {
+	trimmed := strings.TrimLeft(line, " \t")
+	return trimmed == "" || strings.HasPrefix(trimmed, "#")
+}
@@ -0,0 +1,321 @@
+package dockerfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// 每个指令支持的 --key=value 参数，不在这里的指令不解析参数
+var allowedFlags = map[string][]string{
+	From:        {"platform"},
+	Run:         {"mount", "network", "security"},
+	Copy:        {"from", "chown", "chmod", "link", "parents", "exclude"},
+	Add:         {"chown", "chmod", "link", "checksum", "keep-git-dir", "exclude"},
+	Healthcheck: {"interval", "timeout", "start-period", "start-interval", "retries"},
+}
+
+// 可以使用 JSON 数组格式的指令，RUN CMD ENTRYPOINT 不是 JSON 数组时作为 shell 格式
+var jsonInstructions = map[string]bool{
+	Run: true, Cmd: true, Entrypoint: true, Shell: true, Copy: true, Add: true, Volume: true,
+}
+
+// 所有的指令
+var instructions = map[string]bool{
+	From: true, Run: true, Cmd: true, Label: true, Maintainer: true, Expose: true, Env: true, Add: true, Copy: true,
+	Entrypoint: true, Volume: true, User: true, Workdir: true, Arg: true, Onbuild: true, StopSignal: true, Healthcheck: true, Shell: true,
+}
+
+// heredoc 的开始标记，例如 <<EOF <<-EOF <<"EOF"
+var heredocPattern = regexp.MustCompile(`^<<(-?)(["']?)([a-zA-Z_][a-zA-Z0-9_]*)(["']?)$`)
+
+// Parse 解析 dockerfile，返回按顺序排列的指令
+// 支持文件开头的解析器指令，注释，续行，JSON 数组和 shell 格式，引号，以及 RUN COPY ADD 中的 heredoc
+func Parse(r io.Reader) (*File, error) {
+	l, err := newLexer(r)
+	if err != nil {
+		return nil, fmt.Errorf("读取 dockerfile 失败 %v", err)
+	}
+	directives, err := l.directives()
+	if err != nil {
+		return nil, err
+	}
+	file := &File{Directives: directives, Escape: l.escape}
+	for {
+		line, ok := l.next()
+		if !ok {
+			break
+		}
+		inst, err := parseInstruction(line.text, line.startLine, l.escape)
+		if err != nil {
+			return nil, err
+		}
+		inst.EndLine = line.endLine
+		if err := readHeredocs(l, inst); err != nil {
+			return nil, err
+		}
+		file.Instructions = append(file.Instructions, inst)
+	}
+	file.Warnings = l.warnings
+	if len(file.Instructions) == 0 {
+		return nil, errorf(len(l.lines)+1, "文件中没有指令")
+	}
+	return file, nil
+}
+
+// 解析一条指令，text 是合并续行之后的文本
+func parseInstruction(text string, line int, escape rune) (*Instruction, error) {
+	text = strings.TrimSpace(text)
+	name, rest := cutSpace(text)
+	command := strings.ToUpper(name)
+	if !instructions[command] {
+		return nil, errorf(line, "未知的指令 %s", name)
+	}
+	inst := &Instruction{Command: command, StartLine: line, EndLine: line, Source: text, escape: escape}
+	if flags, ok := allowedFlags[command]; ok {
+		var err error
+		if rest, err = inst.parseFlags(rest, flags); err != nil {
+			return nil, err
+		}
+	}
+	inst.Original = rest
+	if rest == "" {
+		return nil, inst.errorf("缺少参数")
+	}
+	if jsonInstructions[command] && strings.HasPrefix(rest, "[") {
+		var args []string
+		if err := json.Unmarshal([]byte(rest), &args); err == nil {
+			if len(args) == 0 {
+				return nil, inst.errorf("JSON 数组不能为空")
+			}
+			inst.JSON, inst.Args = true, args
+			return inst, inst.validate()
+		}
+		if command != Run && command != Cmd && command != Entrypoint {
+			return nil, inst.errorf("JSON 数组格式错误: %s", rest)
+		}
+	}
+	switch command {
+	case Run, Cmd, Entrypoint:
+		// shell 格式交给 shell 处理，引号不完整时由 shell 报错
+		inst.Args, _ = splitWords(rest, escape)
+		return inst, nil
+	case Shell:
+		return nil, inst.errorf("只支持 JSON 数组格式, 例如 SHELL [\"/bin/sh\", \"-c\"]")
+	case Healthcheck:
+		return inst, inst.parseHealthcheck(rest)
+	case Onbuild:
+		next, err := parseInstruction(rest, line, escape)
+		if err != nil {
+			return nil, err
+		}
+		if next.Command == Onbuild || next.Command == From || next.Command == Maintainer {
+			return nil, inst.errorf("不能包含 %s", next.Command)
+		}
+		inst.Next = next
+		return inst, nil
+	case Maintainer, Workdir:
+		inst.Args = []string{rest}
+		return inst, nil
+	}
+	args, err := splitWords(rest, escape)
+	if err != nil {
+		return nil, inst.errorf("%v", err)
+	}
+	inst.Args = args
+	return inst, inst.validate()
+}
+
+// 解析指令名称之后的 --key=value 参数，返回剩下的文本
+func (i *Instruction) parseFlags(rest string, allowed []string) (string, error) {
+	for strings.HasPrefix(rest, "--") {
+		var flag string
+		flag, rest = cutSpace(rest)
+		name, value, _ := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+		if !contains(allowed, name) {
+			return "", i.errorf("不支持的参数 --%s, 支持的参数有 --%s", name, strings.Join(allowed, " --"))
+		}
+		i.Flags = append(i.Flags, &Flag{Name: name, Value: value})
+	}
+	return rest, nil
+}
+
+// HEALTHCHECK [参数] CMD 命令 或者 HEALTHCHECK NONE
+func (i *Instruction) parseHealthcheck(rest string) error {
+	first, remain := cutSpace(rest)
+	switch strings.ToUpper(first) {
+	case "NONE":
+		if remain != "" || len(i.Flags) > 0 {
+			return i.errorf("NONE 不能有其他参数")
+		}
+		i.Args = []string{"NONE"}
+		return nil
+	case Cmd:
+		next, err := parseInstruction(rest, i.StartLine, i.escape)
+		if err != nil {
+			return err
+		}
+		i.Next = next
+		return nil
+	default:
+		return i.errorf("格式为 HEALTHCHECK [参数] CMD 命令 或者 HEALTHCHECK NONE")
+	}
+}
+
+// 检查参数的个数和格式
+func (i *Instruction) validate() error {
+	switch i.Command {
+	case From:
+		if len(i.Args) != 1 && !(len(i.Args) == 3 && strings.EqualFold(i.Args[1], "AS")) {
+			return i.errorf("格式为 FROM 镜像 [AS 名称]")
+		}
+	case Copy, Add:
+		if len(i.Args) < 2 {
+			return i.errorf("需要至少一个源路径和一个目标路径")
+		}
+	case User, StopSignal:
+		if len(i.Args) != 1 {
+			return i.errorf("只能有一个参数")
+		}
+	case Env, Label, Arg:
+		_, err := i.KeyValues(nil)
+		return err
+	}
+	return nil
+}
+
+// 读取 RUN COPY ADD 中的 heredoc，内容在指令之后的行中
+func readHeredocs(l *lexer, inst *Instruction) error {
+	if inst.JSON || (inst.Command != Run && inst.Command != Copy && inst.Command != Add) {
+		return nil
+	}
+	for _, arg := range inst.Args {
+		match := heredocPattern.FindStringSubmatch(arg)
+		if match == nil {
+			continue
+		}
+		if match[2] != match[4] {
+			return inst.errorf("heredoc %s 的引号不匹配", arg)
+		}
+		name, chomp := match[3], match[1] == "-"
+		content, err := l.heredoc(name, chomp, inst.StartLine)
+		if err != nil {
+			return err
+		}
+		inst.Heredocs = append(inst.Heredocs, &Heredoc{Name: name, Content: content, Expand: match[2] == "", Chomp: chomp})
+		inst.EndLine = l.pos
+	}
+	return nil
+}
+
+// Words 处理参数中的引号和转义字符，lookup 不为空时替换变量，JSON 数组格式的参数不做处理
+func (i *Instruction) Words(lookup func(string) (string, bool)) ([]string, error) {
+	if i.JSON {
+		return append([]string{}, i.Args...), nil
+	}
+	words := make([]string, 0, len(i.Args))
+	for _, arg := range i.Args {
+		word, err := processWord(arg, i.escape, lookup)
+		if err != nil {
+			return nil, i.errorf("%v", err)
+		}
+		words = append(words, word)
+	}
+	return words, nil
+}
+
+// Expanded 替换 heredoc 中的变量，结束标记使用引号时不替换
+func (h *Heredoc) Expanded(lookup func(string) (string, bool)) (string, error) {
+	if !h.Expand || lookup == nil {
+		return h.Content, nil
+	}
+	// heredoc 中的引号是普通字符，只替换变量
+	var result strings.Builder
+	p := &wordProcessor{runes: []rune(h.Content), escape: defaultEscape, lookup: lookup}
+	for p.pos < len(p.runes) {
+		c := p.runes[p.pos]
+		if c == '\\' && p.pos+1 < len(p.runes) && p.runes[p.pos+1] == '$' {
+			result.WriteRune('$')
+			p.pos += 2
+			continue
+		}
+		if c != '$' {
+			result.WriteRune(c)
+			p.pos++
+			continue
+		}
+		value, err := p.variable()
+		if err != nil {
+			return "", fmt.Errorf("heredoc %s: %v", h.Name, err)
+		}
+		result.WriteString(value)
+	}
+	return result.String(), nil
+}
+
+// KeyValues 解析 ENV LABEL 的 key=value 或者 ENV key value，以及 ARG 的 name[=默认值]
+// lookup 不为空时替换值中的变量
+func (i *Instruction) KeyValues(lookup func(string) (string, bool)) ([]KeyValue, error) {
+	if len(i.Args) == 0 {
+		return nil, i.errorf("缺少参数")
+	}
+	// 旧的格式 ENV key value，value 是 key 之后的所有内容
+	if i.Command != Arg && !strings.Contains(i.Args[0], "=") {
+		rest := strings.TrimSpace(strings.TrimPrefix(i.Original, i.Args[0]))
+		if rest == "" {
+			return nil, i.errorf("%s 缺少值, 格式为 %s key=value 或者 %s key value", i.Args[0], i.Command, i.Command)
+		}
+		key, err := processWord(i.Args[0], i.escape, nil)
+		if err != nil {
+			return nil, i.errorf("%v", err)
+		}
+		value, err := processWord(rest, i.escape, lookup)
+		if err != nil {
+			return nil, i.errorf("%v", err)
+		}
+		return []KeyValue{{Key: key, Value: value, HasValue: true}}, nil
+	}
+	var result []KeyValue
+	for _, arg := range i.Args {
+		rawKey, rawValue, hasValue := strings.Cut(arg, "=")
+		if !hasValue && i.Command != Arg {
+			return nil, i.errorf("%s 格式错误, 格式为 key=value", arg)
+		}
+		key, err := processWord(rawKey, i.escape, nil)
+		if err != nil {
+			return nil, i.errorf("%v", err)
+		}
+		if key == "" {
+			return nil, i.errorf("%s 缺少名称", arg)
+		}
+		kv := KeyValue{Key: key, HasValue: hasValue}
+		if hasValue {
+			if kv.Value, err = processWord(rawValue, i.escape, lookup); err != nil {
+				return nil, i.errorf("%v", err)
+			}
+		}
+		result = append(result, kv)
+	}
+	return result, nil
+}
+
+// 按第一个空白拆分，返回第一个单词和去掉开头空白的剩余部分
+func cutSpace(s string) (string, string) {
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimLeftFunc(s[i:], unicode.IsSpace)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
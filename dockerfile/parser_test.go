@@ -0,0 +1,171 @@
+package dockerfile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, content string) *File {
+	t.Helper()
+	file, err := Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestParse(t *testing.T) {
+	file := parse(t, `# syntax=docker/dockerfile:1
+# 注释
+from base AS build
+RUN apk add \
+    # 续行中的注释
+    curl \
+
+    git
+CMD ["sh", "-c", "echo hi"]
+ENTRYPOINT echo "a b"
+COPY --chown=1:1 a.txt /dst/
+HEALTHCHECK --interval=10s CMD ["ls"]
+`)
+	if file.Directives["syntax"] != "docker/dockerfile:1" {
+		t.Errorf("解析器指令错误: %v", file.Directives)
+	}
+	var commands []string
+	for _, inst := range file.Instructions {
+		commands = append(commands, inst.Command)
+	}
+	if !reflect.DeepEqual(commands, []string{From, Run, Cmd, Entrypoint, Copy, Healthcheck}) {
+		t.Fatalf("指令错误: %v", commands)
+	}
+	run := file.Instructions[1]
+	if run.StartLine != 4 || run.EndLine != 8 || run.Original != "apk add     curl     git" {
+		t.Errorf("RUN 解析错误: %d-%d %q", run.StartLine, run.EndLine, run.Original)
+	}
+	if len(file.Warnings) != 1 || !strings.Contains(file.Warnings[0], "第 7 行") {
+		t.Errorf("续行中的空行应该有警告: %v", file.Warnings)
+	}
+	if cmd := file.Instructions[2]; !cmd.JSON || !reflect.DeepEqual(cmd.Args, []string{"sh", "-c", "echo hi"}) {
+		t.Errorf("CMD 解析错误: %v", cmd.Args)
+	}
+	if entrypoint := file.Instructions[3]; entrypoint.JSON || entrypoint.Original != `echo "a b"` {
+		t.Errorf("ENTRYPOINT 解析错误: %q", entrypoint.Original)
+	}
+	if chown, _ := file.Instructions[4].Flag("chown"); chown != "1:1" {
+		t.Errorf("COPY 参数解析错误: %v", file.Instructions[4].Flags)
+	}
+	health := file.Instructions[5]
+	if interval, _ := health.Flag("interval"); interval != "10s" || health.Next == nil || !health.Next.JSON {
+		t.Errorf("HEALTHCHECK 解析错误")
+	}
+}
+
+func TestEscapeDirective(t *testing.T) {
+	file := parse(t, "# escape=`\nFROM base\nRUN dir c:\\ `\n  && echo done\nCOPY a `\"b c`\" d\n")
+	if file.Escape != '`' {
+		t.Fatalf("转义字符错误: %c", file.Escape)
+	}
+	if run := file.Instructions[1]; run.Original != `dir c:\   && echo done` {
+		t.Errorf("续行错误: %q", run.Original)
+	}
+	words, err := file.Instructions[2].Words(nil)
+	if err != nil || !reflect.DeepEqual(words, []string{"a", `"b`, `c"`, "d"}) {
+		t.Errorf("转义错误: %q %v", words, err)
+	}
+}
+
+func TestWords(t *testing.T) {
+	env := map[string]string{"HOME": "/root", "EMPTY": "", "NAME": "my app"}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	cases := map[string][]string{
+		`$HOME/a ${HOME}b`:                     {"/root/a", "/rootb"},
+		`'$HOME' "$HOME" \$HOME`:               {"$HOME", "/root", "$HOME"},
+		`${MISSING:-dflt} ${EMPTY:-dflt}`:      {"dflt", "dflt"},
+		`${EMPTY-dflt} ${HOME:+set} ${NONE+x}`: {"", "set", ""},
+		`"${NAME}" a\ b $ $1`:                  {"my app", "a b", "$", "$1"},
+		`${MISSING:-${HOME}/x}`:                {"/root/x"},
+	}
+	for args, expected := range cases {
+		file := parse(t, "WORKDIR /\nUSER x\nVOLUME "+args)
+		words, err := file.Instructions[2].Words(lookup)
+		if err != nil {
+			t.Errorf("%s: %v", args, err)
+			continue
+		}
+		if !reflect.DeepEqual(words, expected) {
+			t.Errorf("%s: 结果为 %q, 期望 %q", args, words, expected)
+		}
+	}
+	file := parse(t, "VOLUME ${MISSING:?需要设置}")
+	if _, err := file.Instructions[0].Words(lookup); err == nil || !strings.Contains(err.Error(), "需要设置") {
+		t.Errorf("${VAR:?} 应该返回错误, %v", err)
+	}
+}
+
+func TestKeyValues(t *testing.T) {
+	file := parse(t, `ENV A=1 B="two words" C=${A}x
+ENV LEGACY value with spaces
+ARG VERSION
+ARG TAG=latest`)
+	lookup := func(name string) (string, bool) { return map[string]string{"A": "old"}[name], true }
+	kvs, err := file.Instructions[0].KeyValues(lookup)
+	expected := []KeyValue{{"A", "1", true}, {"B", "two words", true}, {"C", "oldx", true}}
+	if err != nil || !reflect.DeepEqual(kvs, expected) {
+		t.Errorf("ENV 解析错误: %v %v", kvs, err)
+	}
+	kvs, _ = file.Instructions[1].KeyValues(nil)
+	if len(kvs) != 1 || kvs[0].Key != "LEGACY" || kvs[0].Value != "value with spaces" {
+		t.Errorf("旧格式的 ENV 解析错误: %v", kvs)
+	}
+	kvs, _ = file.Instructions[2].KeyValues(nil)
+	if len(kvs) != 1 || kvs[0].HasValue {
+		t.Errorf("ARG 解析错误: %v", kvs)
+	}
+}
+
+func TestHeredoc(t *testing.T) {
+	file := parse(t, "FROM base\nRUN <<EOF\necho $HOME\n\necho done\nEOF\nCOPY <<-'CONF' /etc/app.conf\n\tkey=$HOME\n\tCONF\nCMD sh\n")
+	run := file.Instructions[1]
+	if len(run.Heredocs) != 1 || run.Heredocs[0].Content != "echo $HOME\n\necho done\n" || run.EndLine != 6 {
+		t.Fatalf("RUN heredoc 解析错误: %+v", run.Heredocs)
+	}
+	content, _ := run.Heredocs[0].Expanded(func(string) (string, bool) { return "/root", true })
+	if content != "echo /root\n\necho done\n" {
+		t.Errorf("heredoc 变量替换错误: %q", content)
+	}
+	conf := file.Instructions[2].Heredoc("CONF")
+	if conf == nil || conf.Content != "key=$HOME\n" || conf.Expand || !conf.Chomp {
+		t.Fatalf("COPY heredoc 解析错误: %+v", conf)
+	}
+	if file.Instructions[3].Command != Cmd || file.Instructions[3].StartLine != 10 {
+		t.Errorf("heredoc 之后的指令解析错误")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"FROM base\nRUNNER=1 echo":            "第 2 行: 未知的指令 RUNNER=1",
+		"FROM base\nCOPY a":                   "第 2 行: COPY 需要至少一个源路径和一个目标路径",
+		"FROM base\n\nENV A=\"1":              "第 3 行: ENV 引号 \" 没有闭合",
+		"FROM base\nRUN <<EOF\necho":          "第 2 行: heredoc EOF 没有结束标记",
+		"FROM\n":                              "第 1 行: FROM 缺少参数",
+		"FROM base\nCOPY --mode=1 a b":        "第 2 行: COPY 不支持的参数 --mode",
+		"# escape=x\nFROM base":               "第 1 行: 转义字符只能是",
+		"FROM base\nHEALTHCHECK echo":         "第 2 行: HEALTHCHECK 格式为",
+		"FROM base\nSHELL sh -c":              "第 2 行: SHELL 只支持 JSON 数组格式",
+		"FROM base\nENV A":                    "第 2 行: ENV A 缺少值",
+		"# 注释\n\n":                            "文件中没有指令",
+		"FROM base\nONBUILD FROM other":       "第 2 行: ONBUILD 不能包含 FROM",
+		"# syntax=a\n# syntax=b\nFROM base\n": "第 2 行: 解析器指令 syntax 重复",
+	}
+	for content, expected := range cases {
+		_, err := Parse(strings.NewReader(content))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: 错误为 %v, 期望包含 %s", content, err, expected)
+		}
+	}
+}
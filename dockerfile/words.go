@@ -0,0 +1,239 @@
+package dockerfile
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// 按没有被引号包围和转义的空白拆分单词，单词中保留引号和转义字符
+func splitWords(s string, escape rune) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case quote == '"':
+			if c == escape && i+1 < len(runes) {
+				word.WriteRune(c)
+				i++
+				c = runes[i]
+			} else if c == '"' {
+				quote = 0
+			}
+		case unicode.IsSpace(c):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			continue
+		case c == '\'' || c == '"':
+			quote = c
+		case c == escape && i+1 < len(runes):
+			word.WriteRune(c)
+			i++
+			c = runes[i]
+		}
+		word.WriteRune(c)
+		inWord = true
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("引号 %c 没有闭合", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// 处理单词中的引号和转义字符，lookup 不为空时替换变量
+// 支持 $VAR ${VAR} ${VAR:-默认值} ${VAR-默认值} ${VAR:+替换值} ${VAR+替换值} ${VAR:?错误信息} ${VAR?错误信息}
+// 单引号中的内容不做处理，双引号中的转义字符只转义 " $ 和转义字符本身
+func processWord(word string, escape rune, lookup func(string) (string, bool)) (string, error) {
+	p := &wordProcessor{runes: []rune(word), escape: escape, lookup: lookup}
+	return p.process(0)
+}
+
+type wordProcessor struct {
+	runes  []rune
+	pos    int
+	escape rune
+	lookup func(string) (string, bool)
+}
+
+// 处理到结尾，或者处理 ${} 中的值时遇到 }，stop 为 0 时处理到结尾
+func (p *wordProcessor) process(stop rune) (string, error) {
+	var result strings.Builder
+	for p.pos < len(p.runes) {
+		c := p.runes[p.pos]
+		switch {
+		case stop != 0 && c == stop:
+			return result.String(), nil
+		case c == '\'':
+			end := p.indexFrom(p.pos+1, '\'')
+			if end < 0 {
+				return "", fmt.Errorf("单引号没有闭合")
+			}
+			result.WriteString(string(p.runes[p.pos+1 : end]))
+			p.pos = end + 1
+		case c == '"':
+			p.pos++
+			value, err := p.doubleQuoted()
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(value)
+		case c == p.escape:
+			p.pos++
+			if p.pos < len(p.runes) {
+				result.WriteRune(p.runes[p.pos])
+				p.pos++
+			} else {
+				result.WriteRune(c)
+			}
+		case c == '$' && p.lookup != nil:
+			value, err := p.variable()
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(value)
+		default:
+			result.WriteRune(c)
+			p.pos++
+		}
+	}
+	if stop != 0 {
+		return "", fmt.Errorf("变量替换缺少 %c", stop)
+	}
+	return result.String(), nil
+}
+
+// 处理双引号中的内容，直到结束的双引号
+func (p *wordProcessor) doubleQuoted() (string, error) {
+	var result strings.Builder
+	for p.pos < len(p.runes) {
+		c := p.runes[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return result.String(), nil
+		case c == p.escape && p.pos+1 < len(p.runes):
+			next := p.runes[p.pos+1]
+			if next == '"' || next == '$' || next == p.escape {
+				result.WriteRune(next)
+			} else {
+				result.WriteRune(c)
+				result.WriteRune(next)
+			}
+			p.pos += 2
+		case c == '$' && p.lookup != nil:
+			value, err := p.variable()
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(value)
+		default:
+			result.WriteRune(c)
+			p.pos++
+		}
+	}
+	return "", fmt.Errorf("双引号没有闭合")
+}
+
+// 处理 $ 开始的变量，$ 后面不是变量名称时作为普通字符
+func (p *wordProcessor) variable() (string, error) {
+	p.pos++
+	if p.pos >= len(p.runes) {
+		return "$", nil
+	}
+	if p.runes[p.pos] != '{' {
+		name := p.name()
+		if name == "" {
+			return "$", nil
+		}
+		value, _ := p.lookup(name)
+		return value, nil
+	}
+	p.pos++
+	name := p.name()
+	if name == "" {
+		return "", fmt.Errorf("变量替换 ${ 后面缺少变量名称")
+	}
+	if p.pos >= len(p.runes) {
+		return "", fmt.Errorf("变量 %s 的替换缺少 }", name)
+	}
+	value, ok := p.lookup(name)
+	if p.runes[p.pos] == '}' {
+		p.pos++
+		return value, nil
+	}
+	// ${VAR:-x} 中的 : 表示变量为空时也使用默认值
+	colon := p.runes[p.pos] == ':'
+	if colon {
+		p.pos++
+	}
+	if p.pos >= len(p.runes) {
+		return "", fmt.Errorf("变量 %s 的替换缺少 }", name)
+	}
+	modifier := p.runes[p.pos]
+	p.pos++
+	word, err := p.process('}')
+	if err != nil {
+		return "", fmt.Errorf("变量 %s 的替换缺少 }", name)
+	}
+	p.pos++
+	set := ok && (!colon || value != "")
+	switch modifier {
+	case '-':
+		if !set {
+			return word, nil
+		}
+		return value, nil
+	case '+':
+		if set {
+			return word, nil
+		}
+		return "", nil
+	case '?':
+		if !set {
+			if word == "" {
+				word = "没有设置"
+			}
+			return "", fmt.Errorf("变量 %s %s", name, word)
+		}
+		return value, nil
+	default:
+		return "", fmt.Errorf("变量 %s 不支持的替换方式 %c", name, modifier)
+	}
+}
+
+// 读取变量名称，由字母，数字和下划线组成，不能以数字开头
+func (p *wordProcessor) name() string {
+	start := p.pos
+	for p.pos < len(p.runes) {
+		c := p.runes[p.pos]
+		if c == '_' || unicode.IsLetter(c) || (p.pos > start && unicode.IsDigit(c)) {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return string(p.runes[start:p.pos])
+}
+
+func (p *wordProcessor) indexFrom(start int, c rune) int {
+	for i := start; i < len(p.runes); i++ {
+		if p.runes[i] == c {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"bytes"
+	"time"
+)
+
+// MaxLineSize 一条日志的最大长度，超过时拆分为多条日志
+const MaxLineSize = 16 * 1024
+
+// Copier 把容器的一个输出流按行拆分，每一行作为一条日志写入 Logger
+type Copier struct {
+	logger Logger
+	source string
+	// 还没有读取到换行符的输出
+	buf []byte
+}
+
+// NewCopier 创建输出流 source 的 Copier
+func NewCopier(logger Logger, source string) *Copier {
+	return &Copier{logger: logger, source: source}
+}
+
+// Write 写入容器的输出，完整的行立即写入 Logger，最后不完整的一行等待后续的输出
+func (c *Copier) Write(p []byte) (int, error) {
+	c.buf = append(c.buf, p...)
+	var err error
+	for {
+		line := c.buf
+		if i := bytes.IndexByte(c.buf, '\n'); i >= 0 {
+			line = c.buf[:i+1]
+		} else if len(c.buf) < MaxLineSize {
+			break
+		}
+		if len(line) > MaxLineSize {
+			line = line[:MaxLineSize]
+		}
+		if logErr := c.log(line); logErr != nil && err == nil {
+			err = logErr
+		}
+		c.buf = c.buf[len(line):]
+	}
+	// 不保留已经写入的部分，避免缓冲区一直增长
+	c.buf = append([]byte(nil), c.buf...)
+	return len(p), err
+}
+
+// Flush 写入最后没有换行符的输出，输出流结束时调用
+func (c *Copier) Flush() error {
+	if len(c.buf) == 0 {
+		return nil
+	}
+	line := c.buf
+	c.buf = nil
+	return c.log(line)
+}
+
+func (c *Copier) log(line []byte) error {
+	return c.logger.Log(&Message{
+		Source: c.source,
+		Time:   time.Now().UTC(),
+		Line:   append([]byte(nil), line...),
+	})
+}
@@ -0,0 +1,172 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// json-file 和 local 驱动的参数
+type fileOptions struct {
+	// 日志文件的最大字节数，超过后轮转，小于等于 0 时不限制
+	maxSize int64
+	// 最多保留的日志文件数量，包括正在写入的文件
+	maxFile int
+}
+
+// 解析 max-size 和 max-file 参数，不支持其他参数
+func parseFileOptions(options map[string]string, defaults fileOptions) (fileOptions, error) {
+	result := defaults
+	for key, value := range options {
+		switch key {
+		case "max-size":
+			size, err := parseSize(value)
+			if err != nil {
+				return result, err
+			}
+			result.maxSize = size
+		case "max-file":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return result, fmt.Errorf("max-file 必须是正整数: %s", value)
+			}
+			result.maxFile = n
+		default:
+			return result, fmt.Errorf("不支持的参数: %s", key)
+		}
+	}
+	if result.maxFile > 1 && result.maxSize <= 0 {
+		return result, fmt.Errorf("设置 max-file 时需要同时设置 max-size")
+	}
+	return result, nil
+}
+
+// 解析大小，例如 100k, 10m, 1g，-1 表示不限制
+func parseSize(value string) (int64, error) {
+	if value == "-1" {
+		return -1, nil
+	}
+	s := strings.TrimSuffix(strings.ToLower(value), "b")
+	unit := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'k':
+			unit = 1 << 10
+		case 'm':
+			unit = 1 << 20
+		case 'g':
+			unit = 1 << 30
+		}
+		if unit > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("max-size 格式错误: %s, 例如 100k, 10m, 1g", value)
+	}
+	return n * unit, nil
+}
+
+// 按大小轮转的日志文件，正在写入的文件是 path，轮转后依次是 path.1, path.2 ...，编号越大越旧
+type rotatingFile struct {
+	path    string
+	options fileOptions
+	lock    sync.Mutex
+	file    *os.File
+	size    int64
+}
+
+func openRotatingFile(path string, options fileOptions) (*rotatingFile, error) {
+	// 容器重新启动时保留之前的日志
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("创建日志文件 %s 失败 %v", path, err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("读取日志文件 %s 失败 %v", path, err)
+	}
+	return &rotatingFile{path: path, options: options, file: file, size: stat.Size()}, nil
+}
+
+// 写入一条完整的日志，一条日志不会被拆分到两个文件中
+func (f *rotatingFile) write(p []byte) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return fmt.Errorf("日志文件 %s 已经关闭", f.path)
+	}
+	if f.options.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.options.maxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return err
+}
+
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+	for i := f.options.maxFile - 1; i > 0; i-- {
+		from := f.path
+		if i > 1 {
+			from = fmt.Sprintf("%s.%d", f.path, i-1)
+		}
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", f.path, i)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("轮转日志文件 %s 失败 %v", from, err)
+		}
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("创建日志文件 %s 失败 %v", f.path, err)
+	}
+	f.file = file
+	f.size = 0
+	return nil
+}
+
+func (f *rotatingFile) close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// 日志文件 path 以及轮转后的文件，从旧到新排列，只返回存在的文件
+func rotatedFiles(path string) []string {
+	type rotated struct {
+		path  string
+		index int
+	}
+	var files []rotated
+	matches, _ := filepath.Glob(path + ".*")
+	for _, match := range matches {
+		index, err := strconv.Atoi(strings.TrimPrefix(match, path+"."))
+		if err == nil && index > 0 {
+			files = append(files, rotated{match, index})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].index > files[j].index
+	})
+	var result []string
+	for _, file := range files {
+		result = append(result, file.path)
+	}
+	if _, err := os.Stat(path); err == nil {
+		result = append(result, path)
+	}
+	return result
+}
@@ -0,0 +1,128 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{"100", 100, false},
+		{"100b", 100, false},
+		{"10k", 10 << 10, false},
+		{"10KB", 10 << 10, false},
+		{"10m", 10 << 20, false},
+		{"1g", 1 << 30, false},
+		{"-1", -1, false},
+		{"0", 0, true},
+		{"k", 0, true},
+		{"10t", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v, 期望 %d, 错误 %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseFileOptions(t *testing.T) {
+	defaults := fileOptions{maxSize: 20 << 20, maxFile: 5}
+	tests := []struct {
+		name     string
+		options  map[string]string
+		defaults fileOptions
+		want     fileOptions
+		wantErr  bool
+	}{
+		{"默认值", nil, defaults, defaults, false},
+		{"max-size", map[string]string{"max-size": "1m"}, defaults, fileOptions{maxSize: 1 << 20, maxFile: 5}, false},
+		{"max-file", map[string]string{"max-size": "1k", "max-file": "3"}, fileOptions{maxFile: 1}, fileOptions{maxSize: 1 << 10, maxFile: 3}, false},
+		{"不限制大小", map[string]string{"max-size": "-1", "max-file": "1"}, defaults, fileOptions{maxSize: -1, maxFile: 1}, false},
+		{"max-file 需要 max-size", map[string]string{"max-file": "3"}, fileOptions{maxFile: 1}, fileOptions{}, true},
+		{"max-file 不是正整数", map[string]string{"max-file": "0"}, defaults, fileOptions{}, true},
+		{"max-size 格式错误", map[string]string{"max-size": "big"}, defaults, fileOptions{}, true},
+		{"不支持的参数", map[string]string{"compress": "true"}, defaults, fileOptions{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFileOptions(tt.options, tt.defaults)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("错误为 %v, 期望错误 %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("参数为 %+v, 期望 %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "container.log")
+	tests := []struct {
+		name    string
+		options fileOptions
+		writes  []string
+		want    []string
+	}{
+		// 从旧到新排列，超过 maxFile 的最旧的文件被删除
+		{"轮转", fileOptions{maxSize: 4, maxFile: 3}, []string{"aaa\n", "bbb\n", "ccc\n", "ddd\n"}, []string{"bbb\n", "ccc\n", "ddd\n"}},
+		// 一条日志超过 maxSize 时也完整写入一个文件
+		{"超过大小的日志", fileOptions{maxSize: 4, maxFile: 2}, []string{"a\n", "bbbbbb\n", "c\n"}, []string{"bbbbbb\n", "c\n"}},
+		{"没有超过大小", fileOptions{maxSize: 10, maxFile: 3}, []string{"aaa\n", "bbb\n"}, []string{"aaa\nbbb\n"}},
+		{"只保留一个文件", fileOptions{maxSize: 4, maxFile: 1}, []string{"aaa\n", "bbb\n"}, []string{"bbb\n"}},
+		{"不限制大小", fileOptions{maxSize: -1, maxFile: 1}, []string{"aaa\n", "bbb\n"}, []string{"aaa\nbbb\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, _ := filepath.Glob(path + "*")
+			for _, match := range matches {
+				os.Remove(match)
+			}
+			f, err := openRotatingFile(path, tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.writes {
+				if err := f.write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			f.close()
+			var contents []string
+			for _, file := range rotatedFiles(path) {
+				content, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				contents = append(contents, string(content))
+			}
+			if !reflect.DeepEqual(contents, tt.want) {
+				t.Errorf("日志文件内容为 %q, 期望 %q", contents, tt.want)
+			}
+		})
+	}
+}
+
+// 编号按照数字排序，path.10 比 path.9 更旧
+func TestRotatedFilesOrder(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "container.log")
+	for _, name := range []string{"container.log", "container.log.1", "container.log.2", "container.log.9", "container.log.10", "container.log.x", "container.log.0"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{path + ".10", path + ".9", path + ".2", path + ".1", path}
+	if got := rotatedFiles(path); !reflect.DeepEqual(got, want) {
+		t.Errorf("日志文件为 %v, 期望 %v", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// JSONFileName json-file 驱动的日志文件，在容器的目录下
+const JSONFileName = "container.log"
+
+// json-file 驱动的一条日志，和 docker 的 json-file 格式相同，例如
+// {"log":"hello\n","stream":"stdout","time":"2024-01-02T15:04:05.999999999Z"}
+type jsonLog struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+// json-file 驱动，每条日志是一行 json，默认不限制文件的大小
+type jsonFileLogger struct {
+	file *rotatingFile
+}
+
+func init() {
+	defaults := fileOptions{maxSize: -1, maxFile: 1}
+	Register("json-file", &Driver{
+		New: func(dir string, options map[string]string) (Logger, error) {
+			opts, err := parseFileOptions(options, defaults)
+			if err != nil {
+				return nil, err
+			}
+			file, err := openRotatingFile(filepath.Join(dir, JSONFileName), opts)
+			if err != nil {
+				return nil, err
+			}
+			return &jsonFileLogger{file: file}, nil
+		},
+		NewReader: func(dir string, options map[string]string) (Reader, error) {
+			return &fileReader{path: filepath.Join(dir, JSONFileName), decode: decodeJSONLog, tail: tailJSONLog}, nil
+		},
+		ValidateOptions: func(options map[string]string) error {
+			_, err := parseFileOptions(options, defaults)
+			return err
+		},
+	})
+}
+
+func (l *jsonFileLogger) Log(msg *Message) error {
+	content, err := json.Marshal(&jsonLog{Log: string(msg.Line), Stream: msg.Source, Time: msg.Time})
+	if err != nil {
+		return err
+	}
+	return l.file.write(append(content, '\n'))
+}
+
+func (l *jsonFileLogger) Close() error {
+	return l.file.close()
+}
+
+// 读取一行日志，旧版本的容器日志文件直接保存标准输出，不是 json 的行作为标准输出读取
+func decodeJSONLog(r *bufio.Reader) (*Message, error) {
+	line, err := r.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		// 没有换行符的 json 可能正在写入，旧版本的日志文件最后一行可能没有换行符
+		if bytes.HasPrefix(line, []byte("{")) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry jsonLog
+	if bytes.HasPrefix(line, []byte("{")) && json.Unmarshal(line, &entry) == nil && entry.Stream != "" {
+		return &Message{Source: entry.Stream, Time: entry.Time, Line: []byte(entry.Log)}, nil
+	}
+	return &Message{Source: Stdout, Line: line}, nil
+}
+
+// 从文件末尾向前查找换行符，最后 n 行的开始位置
+func tailJSONLog(f *os.File, size int64, n int) (int64, int, error) {
+	if n == 0 || size == 0 {
+		return size, 0, nil
+	}
+	end := size
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, size-1); err != nil {
+		return 0, 0, err
+	}
+	// 最后一行结尾的换行符
+	if last[0] == '\n' {
+		end--
+	}
+	found := 0
+	buf := make([]byte, 32*1024)
+	for end > 0 {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return 0, 0, err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] != '\n' {
+				continue
+			}
+			found++
+			if found == n {
+				return start + int64(i) + 1, found, nil
+			}
+		}
+		end = start
+	}
+	// 文件的第一行
+	return 0, found + 1, nil
+}
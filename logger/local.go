@@ -0,0 +1,118 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LocalFileName local 驱动的日志文件，在容器的目录下
+const LocalFileName = "container-local.log"
+
+// local 驱动记录的输出来源
+const (
+	localStdout = 1
+	localStderr = 2
+)
+
+// local 驱动，使用二进制格式保存日志，比 json-file 紧凑，默认每个文件 20m，最多保留 5 个文件
+// 每条日志依次是 4 字节大端序的长度，1 字节的来源，8 字节大端序的纳秒时间戳，日志内容，最后再写一遍长度，
+// 结尾的长度用于从文件末尾向前读取
+type localLogger struct {
+	file *rotatingFile
+}
+
+func init() {
+	defaults := fileOptions{maxSize: 20 << 20, maxFile: 5}
+	Register("local", &Driver{
+		New: func(dir string, options map[string]string) (Logger, error) {
+			opts, err := parseFileOptions(options, defaults)
+			if err != nil {
+				return nil, err
+			}
+			file, err := openRotatingFile(filepath.Join(dir, LocalFileName), opts)
+			if err != nil {
+				return nil, err
+			}
+			return &localLogger{file: file}, nil
+		},
+		NewReader: func(dir string, options map[string]string) (Reader, error) {
+			return &fileReader{path: filepath.Join(dir, LocalFileName), decode: decodeLocalLog, tail: tailLocalLog}, nil
+		},
+		ValidateOptions: func(options map[string]string) error {
+			_, err := parseFileOptions(options, defaults)
+			return err
+		},
+	})
+}
+
+func (l *localLogger) Log(msg *Message) error {
+	size := 1 + 8 + len(msg.Line)
+	record := make([]byte, 4+size+4)
+	binary.BigEndian.PutUint32(record[0:4], uint32(size))
+	record[4] = localStdout
+	if msg.Source == Stderr {
+		record[4] = localStderr
+	}
+	binary.BigEndian.PutUint64(record[5:13], uint64(msg.Time.UnixNano()))
+	copy(record[13:], msg.Line)
+	binary.BigEndian.PutUint32(record[4+size:], uint32(size))
+	return l.file.write(record)
+}
+
+func (l *localLogger) Close() error {
+	return l.file.close()
+}
+
+// 读取一条日志
+func decodeLocalLog(r *bufio.Reader) (*Message, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header)
+	if size < 9 {
+		return nil, fmt.Errorf("日志长度错误: %d", size)
+	}
+	record := make([]byte, size+4)
+	if _, err := io.ReadFull(r, record); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(record[size:]) != size {
+		return nil, fmt.Errorf("日志的结尾长度和开头不一致")
+	}
+	msg := &Message{
+		Source: Stdout,
+		Time:   time.Unix(0, int64(binary.BigEndian.Uint64(record[1:9]))).UTC(),
+		Line:   record[9:size],
+	}
+	if record[0] == localStderr {
+		msg.Source = Stderr
+	}
+	return msg, nil
+}
+
+// 根据每条日志结尾的长度从文件末尾向前查找，最后 n 条日志的开始位置
+func tailLocalLog(f *os.File, size int64, n int) (int64, int, error) {
+	offset, found := size, 0
+	trailer := make([]byte, 4)
+	for found < n && offset > 0 {
+		if _, err := f.ReadAt(trailer, offset-4); err != nil {
+			return 0, 0, err
+		}
+		start := offset - 4 - int64(binary.BigEndian.Uint32(trailer)) - 4
+		if start < 0 {
+			return 0, 0, fmt.Errorf("日志长度错误")
+		}
+		offset = start
+		found++
+	}
+	return offset, found, nil
+}
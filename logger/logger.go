@@ -0,0 +1,161 @@
+package logger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultDriver 没有指定 --log-driver 时使用的日志驱动
+const DefaultDriver = "json-file"
+
+// 容器输出的来源
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// Message 容器输出的一行日志
+type Message struct {
+	// 输出的来源，Stdout 或者 Stderr
+	Source string
+	// 读取到这一行输出的时间
+	Time time.Time
+	// 一行输出，包括结尾的换行符，容器退出前最后没有换行符的输出以及超过 MaxLineSize 的部分没有换行符
+	Line []byte
+}
+
+// Logger 日志驱动写入日志的接口，shim 进程把容器的每一行输出交给 Logger，标准输出和标准错误会同时写入
+type Logger interface {
+	Log(msg *Message) error
+	Close() error
+}
+
+// Reader 读取日志驱动保存的日志
+type Reader interface {
+	// ReadLogs 按照写入的顺序读取满足 config 的日志，handle 返回错误时停止读取并返回这个错误
+	ReadLogs(config *ReadConfig, handle func(msg *Message) error) error
+}
+
+// ReadConfig 读取日志的参数
+type ReadConfig struct {
+	// 只读取这个时间之后的日志，零值表示不限制
+	Since time.Time
+	// 读取到这个时间为止的日志，零值表示不限制
+	Until time.Time
+	// 只读取最后 Tail 条日志，从文件末尾向前查找，小于 0 时读取所有日志
+	Tail int
+	// 读取完已有的日志后继续等待新的日志，直到 Done 关闭，关闭后读取剩余的日志再返回
+	Follow bool
+	Done   <-chan struct{}
+}
+
+// Config 容器的日志配置
+type Config struct {
+	// 日志驱动的名称
+	Type string `json:"type"`
+	// --log-opt 指定的日志驱动参数
+	Config map[string]string `json:"config,omitempty"`
+}
+
+// Driver 日志驱动
+type Driver struct {
+	// 创建写入日志的 Logger，dir 是容器的目录
+	New func(dir string, options map[string]string) (Logger, error)
+	// 创建读取日志的 Reader，为空表示这个驱动不保存日志
+	NewReader func(dir string, options map[string]string) (Reader, error)
+	// 检查日志驱动的参数，创建容器时调用
+	ValidateOptions func(options map[string]string) error
+}
+
+var drivers = map[string]*Driver{}
+
+// Register 注册日志驱动，在 init 中调用
+func Register(name string, driver *Driver) {
+	if _, ok := drivers[name]; ok {
+		panic(fmt.Sprintf("日志驱动 %s 重复注册", name))
+	}
+	drivers[name] = driver
+}
+
+// Drivers 所有注册的日志驱动的名称
+func Drivers() []string {
+	var names []string
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseConfig 解析 run 的 --log-driver 和 --log-opt，参数的格式为 key=value，driver 为空时使用 DefaultDriver
+func ParseConfig(driver string, opts []string) (*Config, error) {
+	if driver == "" {
+		driver = DefaultDriver
+	}
+	config := &Config{Type: driver}
+	for _, opt := range opts {
+		key, value, ok := strings.Cut(opt, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("日志参数格式错误: %s, 格式为 key=value", opt)
+		}
+		if config.Config == nil {
+			config.Config = map[string]string{}
+		}
+		config.Config[key] = value
+	}
+	d, err := config.driver()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.ValidateOptions(config.Config); err != nil {
+		return nil, fmt.Errorf("日志驱动 %s 的参数错误: %v", driver, err)
+	}
+	return config, nil
+}
+
+// 日志驱动的名称，没有记录日志配置的容器使用 DefaultDriver
+func (c *Config) name() string {
+	if c == nil || c.Type == "" {
+		return DefaultDriver
+	}
+	return c.Type
+}
+
+func (c *Config) driver() (*Driver, error) {
+	name := c.name()
+	d, ok := drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("不支持的日志驱动: %s, 可以使用 %s", name, strings.Join(Drivers(), ", "))
+	}
+	return d, nil
+}
+
+func (c *Config) options() map[string]string {
+	if c == nil {
+		return nil
+	}
+	return c.Config
+}
+
+// New 按照日志配置创建容器的 Logger，dir 是容器的目录
+func New(config *Config, dir string) (Logger, error) {
+	d, err := config.driver()
+	if err != nil {
+		return nil, err
+	}
+	return d.New(dir, config.options())
+}
+
+// NewReader 按照日志配置创建读取容器日志的 Reader，dir 是容器的目录
+func NewReader(config *Config, dir string) (Reader, error) {
+	d, err := config.driver()
+	if err != nil {
+		return nil, err
+	}
+	if d.NewReader == nil {
+		return nil, fmt.Errorf("日志驱动 %s 不保存日志，无法读取", config.name())
+	}
+	return d.NewReader(dir, config.options())
+}
@@ -0,0 +1,28 @@
+package logger
+
+import "fmt"
+
+// none 驱动，丢弃容器的所有输出，attach 仍然可以看到容器的输出
+type noneLogger struct{}
+
+func init() {
+	Register("none", &Driver{
+		New: func(dir string, options map[string]string) (Logger, error) {
+			return noneLogger{}, nil
+		},
+		ValidateOptions: func(options map[string]string) error {
+			for key := range options {
+				return fmt.Errorf("不支持的参数: %s", key)
+			}
+			return nil
+		},
+	})
+}
+
+func (noneLogger) Log(msg *Message) error {
+	return nil
+}
+
+func (noneLogger) Close() error {
+	return nil
+}
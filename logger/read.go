@@ -0,0 +1,266 @@
+package logger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// 持续读取日志时检查新日志的间隔
+const followInterval = 200 * time.Millisecond
+
+// 超过 until 后停止读取
+var errUntil = errors.New("超过 until")
+
+// 读取日志文件及其轮转后的文件
+type fileReader struct {
+	path string
+	// 从文件中解码一条日志，没有数据时返回 io.EOF，文件末尾的日志不完整时返回 io.ErrUnexpectedEOF
+	decode func(r *bufio.Reader) (*Message, error)
+	// 从文件末尾向前查找最后 n 条日志，返回第一条日志的位置以及找到的日志数量
+	tail func(f *os.File, size int64, n int) (int64, int, error)
+}
+
+func (r *fileReader) ReadLogs(config *ReadConfig, handle func(msg *Message) error) error {
+	if config == nil {
+		config = &ReadConfig{Tail: -1}
+	}
+	filter := func(msg *Message) error {
+		if !config.Until.IsZero() && msg.Time.After(config.Until) {
+			return errUntil
+		}
+		if !config.Since.IsZero() && msg.Time.Before(config.Since) {
+			return nil
+		}
+		return handle(msg)
+	}
+	err := r.read(config, filter)
+	if err == errUntil {
+		return nil
+	}
+	return err
+}
+
+func (r *fileReader) read(config *ReadConfig, handle func(msg *Message) error) error {
+	files, offset, err := r.start(config.Tail)
+	if err != nil {
+		return err
+	}
+	var current *logFile
+	for i, path := range files {
+		f, err := openLogFile(path, offset, r.decode)
+		offset = 0
+		// 读取过程中文件被轮转
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = f.readAll(handle)
+		// 持续读取时继续使用正在写入的文件
+		if err == nil && config.Follow && i == len(files)-1 {
+			current = f
+			break
+		}
+		f.close()
+		if err != nil {
+			return err
+		}
+	}
+	if !config.Follow {
+		return nil
+	}
+	return r.follow(current, config, handle)
+}
+
+// 需要读取的日志文件，从旧到新排列，以及第一个文件中开始读取的位置
+// tail 大于等于 0 时从最新的文件向前查找，直到找到 tail 条日志
+func (r *fileReader) start(tail int) ([]string, int64, error) {
+	files := rotatedFiles(r.path)
+	if tail < 0 {
+		return files, 0, nil
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		f, err := os.Open(files[i])
+		if err != nil {
+			return nil, 0, fmt.Errorf("打开日志文件 %s 失败 %v", files[i], err)
+		}
+		stat, err := f.Stat()
+		var offset int64
+		var found int
+		if err == nil {
+			offset, found, err = r.tail(f, stat.Size(), tail)
+		}
+		f.Close()
+		if err != nil {
+			return nil, 0, fmt.Errorf("读取日志文件 %s 失败 %v", files[i], err)
+		}
+		tail -= found
+		if tail <= 0 {
+			return files[i:], offset, nil
+		}
+	}
+	return files, 0, nil
+}
+
+// 等待正在写入的日志文件中新的日志，current 为空表示日志文件还没有创建
+// 文件被轮转时先读完轮转之前的文件，再从头读取新的文件
+func (r *fileReader) follow(current *logFile, config *ReadConfig, handle func(msg *Message) error) error {
+	defer func() {
+		if current != nil {
+			current.close()
+		}
+	}()
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+	for {
+		done := false
+		select {
+		case <-config.Done:
+			done = true
+		case <-ticker.C:
+		}
+		if !config.Until.IsZero() && time.Now().After(config.Until) {
+			done = true
+		}
+		if current != nil {
+			if err := current.readAll(handle); err != nil {
+				return err
+			}
+		}
+		stat, err := os.Stat(r.path)
+		if err == nil && (current == nil || !os.SameFile(stat, current.stat)) {
+			if current != nil {
+				// 轮转之前写入的日志，以及两次检查之间轮转多次时中间的文件
+				err := current.readAll(handle)
+				if err == nil {
+					err = r.readRotated(current.stat, handle)
+				}
+				current.close()
+				current = nil
+				if err != nil {
+					return err
+				}
+			}
+			if current, err = openLogFile(r.path, 0, r.decode); err == nil {
+				err = current.readAll(handle)
+			}
+			// 打开之前文件再次被轮转，下一次重新打开
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		} else if err == nil && stat.Size() < current.offset {
+			// 只保留一个文件时轮转会清空正在写入的文件
+			if err := current.seek(0); err != nil {
+				return err
+			}
+			if err := current.readAll(handle); err != nil {
+				return err
+			}
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// 读取比 previous 新的轮转后的文件，previous 已经被删除时读取所有轮转后的文件
+func (r *fileReader) readRotated(previous os.FileInfo, handle func(msg *Message) error) error {
+	files := rotatedFiles(r.path)
+	// 最后一个是正在写入的文件
+	if len(files) > 0 {
+		files = files[:len(files)-1]
+	}
+	for i, path := range files {
+		if stat, err := os.Stat(path); err == nil && os.SameFile(stat, previous) {
+			files = files[i+1:]
+			break
+		}
+	}
+	for _, path := range files {
+		f, err := openLogFile(path, 0, r.decode)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = f.readAll(handle)
+		f.close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 正在读取的日志文件，offset 是已经读取的完整日志的结尾
+type logFile struct {
+	file   *os.File
+	stat   os.FileInfo
+	reader *bufio.Reader
+	// 文件中已经读取到 reader 的位置
+	position int64
+	offset   int64
+	decode   func(r *bufio.Reader) (*Message, error)
+}
+
+func openLogFile(path string, offset int64, decode func(r *bufio.Reader) (*Message, error)) (*logFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("读取日志文件 %s 失败 %v", path, err)
+	}
+	f := &logFile{file: file, stat: stat, decode: decode}
+	f.reader = bufio.NewReader(f)
+	if err := f.seek(offset); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Read 记录读取到的位置，供 bufio.Reader 使用
+func (f *logFile) Read(p []byte) (int, error) {
+	n, err := f.file.Read(p)
+	f.position += int64(n)
+	return n, err
+}
+
+func (f *logFile) seek(offset int64) error {
+	if _, err := f.file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("读取日志文件 %s 失败 %v", f.file.Name(), err)
+	}
+	f.position, f.offset = offset, offset
+	f.reader.Reset(f)
+	return nil
+}
+
+// 读取文件中所有完整的日志，文件末尾不完整的日志可能正在写入，回到它的开始位置，留到下一次读取
+func (f *logFile) readAll(handle func(msg *Message) error) error {
+	for {
+		msg, err := f.decode(f.reader)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return f.seek(f.offset)
+		}
+		if err != nil {
+			return fmt.Errorf("读取日志文件 %s 失败 %v", f.file.Name(), err)
+		}
+		f.offset = f.position - int64(f.reader.Buffered())
+		if err := handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (f *logFile) close() {
+	f.file.Close()
+}
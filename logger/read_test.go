@@ -0,0 +1,79 @@
+package logger
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 两种驱动写入 10 条日志，每个文件只能保存几条日志，日志分布在多个轮转后的文件中
+func TestReadLogs(t *testing.T) {
+	base := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	at := func(i int) time.Time {
+		return base.Add(time.Duration(i) * time.Second)
+	}
+	lines := func(from, to int) []string {
+		result := []string{}
+		for i := from; i < to; i++ {
+			result = append(result, fmt.Sprintf("line%d\n", i))
+		}
+		return result
+	}
+	tests := []struct {
+		name   string
+		config *ReadConfig
+		want   []string
+	}{
+		{"所有日志", nil, lines(0, 10)},
+		{"tail 小于 0", &ReadConfig{Tail: -1}, lines(0, 10)},
+		{"tail 0", &ReadConfig{Tail: 0}, lines(0, 0)},
+		{"tail 在最新的文件中", &ReadConfig{Tail: 1}, lines(9, 10)},
+		{"tail 跨越多个文件", &ReadConfig{Tail: 7}, lines(3, 10)},
+		{"tail 超过日志数量", &ReadConfig{Tail: 100}, lines(0, 10)},
+		{"since", &ReadConfig{Tail: -1, Since: at(6)}, lines(6, 10)},
+		{"until", &ReadConfig{Tail: -1, Until: at(3)}, lines(0, 4)},
+		{"since 和 until", &ReadConfig{Tail: -1, Since: at(2), Until: at(5)}, lines(2, 6)},
+		// 先找到最后几条日志，再按照时间过滤
+		{"tail 和 since", &ReadConfig{Tail: 5, Since: at(7)}, lines(7, 10)},
+		{"tail 和 until", &ReadConfig{Tail: 5, Until: at(6)}, lines(5, 7)},
+	}
+	for name, file := range map[string]string{"json-file": JSONFileName, "local": LocalFileName} {
+		dir := t.TempDir()
+		options := map[string]string{"max-size": "100", "max-file": "10"}
+		driver := drivers[name]
+		l, err := driver.New(dir, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			if err := l.Log(&Message{Source: Stdout, Time: at(i), Line: []byte(fmt.Sprintf("line%d\n", i))}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		l.Close()
+		if files := rotatedFiles(filepath.Join(dir, file)); len(files) < 3 {
+			t.Fatalf("%s 日志文件没有轮转: %v", name, files)
+		}
+		reader, err := driver.NewReader(dir, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range tests {
+			t.Run(name+" "+tt.name, func(t *testing.T) {
+				got := []string{}
+				err := reader.ReadLogs(tt.config, func(msg *Message) error {
+					got = append(got, string(msg.Line))
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("日志为 %q, 期望 %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
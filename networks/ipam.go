@@ -123,6 +123,39 @@ func (ipam *IpAllocatorManager) Allocate(subnet *net.IPNet) (ip net.IP, err erro
 	return
 }
 
+// Reserve 将指定的ip标记为已分配，容器重新启动时使用之前分配的ip
+func (ipam *IpAllocatorManager) Reserve(subnet *net.IPNet, ipaddr net.IP) error {
+	ipam.Subnets = &map[string]string{}
+
+	_, subnet, _ = net.ParseCIDR(subnet.String())
+
+	err := ipam.load()
+	if err != nil {
+		log.Printf("加载ipam 失败%v\n", err)
+	}
+	one, size := subnet.Mask.Size()
+	if _, exist := (*ipam.Subnets)[subnet.String()]; !exist {
+		(*ipam.Subnets)[subnet.String()] = strings.Repeat("0", 1<<uint8(size-one))
+	}
+	ip := ipaddr.To4()
+	if ip == nil || !subnet.Contains(ip) {
+		return fmt.Errorf("ip %s 不在网段 %s 中", ipaddr, subnet)
+	}
+	// 和 Allocate 相同，序号为 c 的地址是 网络地址+c+1
+	c := 0
+	for t := uint(4); t > 0; t -= 1 {
+		c += int(ip[t-1]-subnet.IP[t-1]) << ((4 - t) * 8)
+	}
+	c -= 1
+	ipalloc := []byte((*ipam.Subnets)[subnet.String()])
+	if c < 0 || c >= len(ipalloc) {
+		return fmt.Errorf("ip %s 不能分配", ipaddr)
+	}
+	ipalloc[c] = '1'
+	(*ipam.Subnets)[subnet.String()] = string(ipalloc)
+	return ipam.dump()
+}
+
 // Release 释放地址
 func (ipam *IpAllocatorManager) Release(subnet *net.IPNet, ipaddr *net.IP) error {
 	ipam.Subnets = &map[string]string{}
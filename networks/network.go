@@ -2,7 +2,6 @@ package networks
 
 import (
 	"containers"
-	"encoding/json"
 	"fmt"
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netns"
@@ -14,9 +13,7 @@ import (
 	"portmapping"
 	"runtime"
 	"strings"
-	"sysv_mq"
 	"text/tabwriter"
-	"time"
 )
 
 var ipAllocatorManager = &IpAllocatorManager{
@@ -52,10 +49,67 @@ func Init() error {
 	})
 	return nil
 }
-func ListNetwork() {
+
+// GetNetworkList 获取所有的网络
+func GetNetworkList() []*Network {
+	var list []*Network
+	for _, nw := range networks {
+		list = append(list, nw)
+	}
+	return list
+}
+
+// NetworkInspect inspect 网络时输出的信息
+type NetworkInspect struct {
+	*Network
+	// 网络地址段
+	Subnet string `json:"subnet"`
+	// 网关，也就是网桥的地址
+	Gateway string `json:"gateway"`
+	// 连接到网络的容器
+	Containers []NetworkContainer `json:"containers"`
+}
+
+// NetworkContainer 连接到网络的容器
+type NetworkContainer struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	IpAddress string `json:"ipAddress"`
+	Status    string `json:"status"`
+}
+
+// InspectNetwork 获取网络的详细信息
+func InspectNetwork(name string) (*NetworkInspect, error) {
+	nw, ok := networks[name]
+	if !ok {
+		return nil, fmt.Errorf("网络 %s 不存在", name)
+	}
+	subnet := &net.IPNet{IP: nw.IpRange.IP.Mask(nw.IpRange.Mask), Mask: nw.IpRange.Mask}
+	result := &NetworkInspect{
+		Network:    nw,
+		Subnet:     subnet.String(),
+		Gateway:    nw.IpRange.IP.String(),
+		Containers: []NetworkContainer{},
+	}
+	for _, info := range containers.GetContainerInfoList() {
+		if info.Net != name {
+			continue
+		}
+		result.Containers = append(result.Containers, NetworkContainer{
+			Id:        info.Id,
+			Name:      info.Name,
+			IpAddress: info.IpAddress,
+			Status:    info.Status,
+		})
+	}
+	return result, nil
+}
+
+// ListNetwork 以表格的形式输出网络信息
+func ListNetwork(nws []*Network) {
 	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
 	fmt.Fprint(w, "NAME\tIpRange\tDriver\n")
-	for _, nw := range networks {
+	for _, nw := range nws {
 		fmt.Fprintf(w, "%s\t%s\t%s\n",
 			nw.Name,
 			nw.IpRange.String(),
@@ -73,8 +127,17 @@ func CreateNetwork(driver, subnet, name string) error {
 	if driver == "" {
 		driver = DefaultDriver
 	}
+	if _, ok := drivers[driver]; !ok {
+		return fmt.Errorf("不支持的网络驱动: %s", driver)
+	}
+	if _, ok := networks[name]; ok {
+		return fmt.Errorf("网络已经存在: %s", name)
+	}
 	// 解析cidr网络  127.0.0.1/8
-	_, cidr, _ := net.ParseCIDR(subnet)
+	_, cidr, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return fmt.Errorf("子网格式错误: %s", subnet)
+	}
 	// 分配ip
 	ip, err := ipAllocatorManager.Allocate(cidr)
 	if err != nil {
@@ -86,19 +149,23 @@ func CreateNetwork(driver, subnet, name string) error {
 	if err != nil {
 		return err
 	}
+	networks[name] = nw
 	// 存储网络
-	return nw.dump(DefaultNetworkPath)
+	if err := nw.dump(DefaultNetworkPath); err != nil {
+		return err
+	}
+	containers.LogEvent(containers.NetworkEvent, "create", name, map[string]string{"driver": driver, "subnet": subnet})
+	return nil
 }
 
-// Connect 容器连接到网络
+// Connect 容器连接到网络, 重新启动的容器优先使用之前分配的ip
 func Connect(networkName string, cinfo *containers.ContainerInfo) error {
 	network, ok := networks[networkName]
 	if !ok {
-		log.Printf("网络不存在: %s\n", networkName)
-		return nil
+		return fmt.Errorf("网络不存在: %s", networkName)
 	}
 	// 分配容器IP地址
-	ip, err := ipAllocatorManager.Allocate(network.IpRange)
+	ip, err := allocateIp(network, cinfo)
 	if err != nil {
 		return err
 	}
@@ -117,15 +184,56 @@ func Connect(networkName string, cinfo *containers.ContainerInfo) error {
 	if err = configEndpointIpAddressAndRoute(ep, cinfo); err != nil {
 		return err
 	}
+	cinfo.IpAddress = ip.String()
+	containers.LogEvent(containers.NetworkEvent, "connect", networkName, map[string]string{"container": cinfo.Id, "ipAddress": cinfo.IpAddress})
 	// 配置容器到网络中的端口映射
 	return configPortMapping(ep)
 }
 
+// Disconnect 容器删除时调用，释放容器在网络中的ip以及端口映射
+// 容器停止后仍然保留分配的ip，重新启动时继续使用
+func Disconnect(cinfo *containers.ContainerInfo) error {
+	network, ok := networks[cinfo.Net]
+	if !ok || cinfo.IpAddress == "" {
+		return nil
+	}
+	ApplyPortMapping([]string{}, containerPortMapping(cinfo))
+	containers.LogEvent(containers.NetworkEvent, "disconnect", cinfo.Net, map[string]string{"container": cinfo.Id, "ipAddress": cinfo.IpAddress})
+	ip := net.ParseIP(cinfo.IpAddress)
+	if ip == nil || !network.IpRange.Contains(ip) || ipUsedByOthers(cinfo) {
+		return nil
+	}
+	return ipAllocatorManager.Release(network.IpRange, &ip)
+}
+
+// 分配容器的ip，容器之前分配的ip没有被其他容器使用时，继续使用之前的ip
+func allocateIp(network *Network, cinfo *containers.ContainerInfo) (net.IP, error) {
+	if cinfo.IpAddress != "" {
+		ip := net.ParseIP(cinfo.IpAddress).To4()
+		if ip != nil && network.IpRange.Contains(ip) && !ipUsedByOthers(cinfo) {
+			if err := ipAllocatorManager.Reserve(network.IpRange, ip); err == nil {
+				return ip, nil
+			}
+		}
+		log.Printf("容器 %s 之前的ip %s 已经被占用，重新分配ip\n", cinfo.Id, cinfo.IpAddress)
+	}
+	return ipAllocatorManager.Allocate(network.IpRange)
+}
+
+// 同一个网络中的其他容器是否使用了容器记录的ip
+func ipUsedByOthers(cinfo *containers.ContainerInfo) bool {
+	for _, info := range containers.GetContainerInfoList() {
+		if info.Id != cinfo.Id && info.Net == cinfo.Net && info.IpAddress == cinfo.IpAddress {
+			return true
+		}
+	}
+	return false
+}
+
 func DeleteNetwork(networkName string) error {
 	nw, ok := networks[networkName]
 	if !ok {
-		log.Printf("网络不存在: %s\n", networks)
-		return nil
+		return fmt.Errorf("网络不存在: %s", networkName)
 	}
 	// 删除网络
 	if err := ipAllocatorManager.Release(nw.IpRange, &nw.IpRange.IP); err != nil {
@@ -135,7 +243,12 @@ func DeleteNetwork(networkName string) error {
 	if err := drivers[nw.Driver].Delete(*nw); err != nil {
 		return fmt.Errorf("驱动删除网络失败 %s", err)
 	}
-	return nw.remove(DefaultNetworkPath)
+	delete(networks, networkName)
+	if err := nw.remove(DefaultNetworkPath); err != nil {
+		return err
+	}
+	containers.LogEvent(containers.NetworkEvent, "destroy", networkName, map[string]string{"driver": nw.Driver})
+	return nil
 }
 
 func configEndpointIpAddressAndRoute(ep *EndPoint, cinfo *containers.ContainerInfo) error {
@@ -191,8 +304,8 @@ func configPortMapping(ep *EndPoint) error {
 		toAddr := addr + ":" + splits[1]
 		portMapping = append(portMapping, splits[0]+":"+toAddr)
 	}
-	// 发送端口映射
-	SendPortMapping(portMapping, []string{})
+	// 配置端口映射
+	ApplyPortMapping(portMapping, []string{})
 	return nil
 }
 
@@ -231,6 +344,7 @@ func enterContainerNetns(enLink *netlink.Link, cinfo *containers.ContainerInfo)
 	}
 }
 
+// PortMappingStruct 端口映射的配置
 type PortMappingStruct struct {
 	// 端口映射
 	PortMapping []string `json:"PortMapping"`
@@ -238,52 +352,64 @@ type PortMappingStruct struct {
 	PortUnMapping []string `json:"PortUnMapping"`
 }
 
-func StartPortMapping() {
-	mq, err := sysv_mq.NewMessageQueue(&sysv_mq.QueueConfig{
-		Key:     0xDEADBEEF,
-		MaxSize: 1024,
-		Mode:    sysv_mq.IPC_CREAT | 0600,
-	})
-	if err != nil {
-		log.Printf("启动失败:%v\n", err)
-		return
+// ApplyPortMapping 在当前进程中配置端口映射, 格式为 宿主机端口:目标地址:目标端口
+// 端口转发的监听由 mydocker daemon 持有, daemon 退出后端口映射也会失效
+func ApplyPortMapping(p []string, removeP []string) {
+	log.Printf("端口配置 映射:%s 取消映射:%s\n", p, removeP)
+	for _, i := range p {
+		splits := strings.SplitN(i, ":", 2)
+		if len(splits) != 2 {
+			log.Printf("端口映射格式错误: %s\n", i)
+			continue
+		}
+		portmapping.AddPortMapping(splits[0], splits[1])
+	}
+	for _, i := range removeP {
+		splits := strings.SplitN(i, ":", 2)
+		if len(splits) != 2 {
+			log.Printf("端口映射格式错误: %s\n", i)
+			continue
+		}
+		portmapping.RemovePortMapping(splits[0], splits[1])
 	}
-	for {
-		response, _, err := mq.ReceiveBytes(0, sysv_mq.IPC_NOWAIT)
-		var p = PortMappingStruct{}
+}
 
-		err = json.Unmarshal(response, &p)
-		if err == nil {
-			log.Printf("端口配置%s\n", p)
-			// 读取成功，立刻再去读取
-			for _, i := range p.PortMapping {
-				splits := strings.SplitN(i, ":", 2)
-				portmapping.AddPortMapping(splits[0], splits[1])
-			}
-			for _, i := range p.PortUnMapping {
-				splits := strings.SplitN(i, ":", 2)
-				portmapping.RemovePortMapping(splits[0], splits[1])
-			}
+// RestorePortMapping 恢复运行中容器的端口映射, daemon 启动时调用，健康检查失败的容器不恢复
+func RestorePortMapping(infos []*containers.ContainerInfo) {
+	for _, info := range infos {
+		if !info.IsRunning() || info.IpAddress == "" || info.IsUnhealthy() {
 			continue
 		}
-		time.Sleep(time.Millisecond * 1000)
+		ApplyPortMapping(containerPortMapping(info), []string{})
 	}
 }
 
-func SendPortMapping(p []string, removeP []string) {
-	var s = PortMappingStruct{
-		PortMapping:   p,
-		PortUnMapping: removeP,
-	}
-	mq, err := sysv_mq.NewMessageQueue(&sysv_mq.QueueConfig{
-		Key:     0xDEADBEEF,
-		MaxSize: 1024,
-		Mode:    sysv_mq.IPC_CREAT | 0600,
-	})
-	content, _ := json.Marshal(s)
-	err = mq.SendBytes(content, 1, sysv_mq.IPC_NOWAIT)
-	if err != nil {
-		log.Printf("执行失败:%v\n", err)
+// EnablePortMapping 容器恢复健康后重新添加容器的端口映射
+func EnablePortMapping(info *containers.ContainerInfo) {
+	if info.IpAddress == "" {
 		return
 	}
+	ApplyPortMapping(containerPortMapping(info), []string{})
+}
+
+// DisablePortMapping 容器健康检查失败时移除容器的端口映射，新的连接不再转发到这个容器
+// 同一个端口映射到多个容器时，连接转发到其他健康的容器
+func DisablePortMapping(info *containers.ContainerInfo) {
+	if info.IpAddress == "" {
+		return
+	}
+	ApplyPortMapping([]string{}, containerPortMapping(info))
+}
+
+// 容器的端口映射, 格式为 宿主机端口:容器ip:容器端口
+func containerPortMapping(info *containers.ContainerInfo) []string {
+	var portMapping []string
+	for _, p := range info.PortMapping {
+		splits := strings.Split(p, ":")
+		if len(splits) != 2 {
+			continue
+		}
+		portMapping = append(portMapping, splits[0]+":"+info.IpAddress+":"+splits[1])
+	}
+	return portMapping
 }
@@ -9,6 +9,8 @@ package nsenter
 #include <stdlib.h>
 #include <string.h>
 #include <fcntl.h>
+#include <sys/ioctl.h>
+#include <sys/wait.h>
 __attribute__((constructor)) static void Enter_namespace(void) {
 	char *mydocker_pid;
 	mydocker_pid = getenv("mydocker_pid");
@@ -41,8 +43,33 @@ __attribute__((constructor)) static void Enter_namespace(void) {
 		}
 		close(fd);
 	}
-	int res = system(mydocker_cmd);
-	exit(0);
+	int res;
+	if (getenv("mydocker_tty")) {
+		// 标准输入是伪终端的从设备，命令需要在容器的 pid namespace 中创建新的会话并把它设置为控制终端，
+		// 否则 shell 的作业控制找不到会话所在的进程组
+		pid_t child = fork();
+		if (child == 0) {
+			setsid();
+			ioctl(0, TIOCSCTTY, 0);
+			execl("/bin/sh", "sh", "-c", mydocker_cmd, (char *) NULL);
+			_exit(127);
+		}
+		res = -1;
+		if (child > 0) {
+			while (waitpid(child, &res, 0) == -1 && errno == EINTR) {
+			}
+		}
+	} else {
+		res = system(mydocker_cmd);
+	}
+	// 返回命令的退出码，例如健康检查根据退出码判断容器是否健康
+	if (res == -1) {
+		exit(127);
+	}
+	if (WIFSIGNALED(res)) {
+		exit(128 + WTERMSIG(res));
+	}
+	exit(WEXITSTATUS(res));
 	return;
 }
 */
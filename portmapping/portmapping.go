@@ -29,6 +29,14 @@ func (p *PortMapping) addPortMapping(port int, addr string) {
 	log.Printf("添加端口映射: %d:%v\n", port, addr)
 	status := p.MappingStatus[port]
 	lock.Lock()
+	// 已经存在的映射不重复添加，例如容器重新启动时
+	for _, v := range p.TargetWithPort[port] {
+		if v == addr {
+			p.MappingStatus[port] = true
+			lock.Unlock()
+			return
+		}
+	}
 	p.TargetWithPort[port] = append(p.TargetWithPort[port], addr)
 	p.MappingStatus[port] = true
 	lock.Unlock()
@@ -134,6 +142,23 @@ func RemovePort(strPort string) {
 	portMapping.removePort(port)
 }
 
+// ListPortMapping 返回当前生效的端口映射，key是宿主机端口，value是映射的目标地址
+func ListPortMapping() map[int][]string {
+	result := make(map[int][]string)
+	if portMapping == nil {
+		return result
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	for port, targets := range portMapping.TargetWithPort {
+		if !portMapping.MappingStatus[port] {
+			continue
+		}
+		result[port] = append([]string{}, targets...)
+	}
+	return result
+}
+
 func Main() {
 	ch := make(chan int)
 	fmt.Println(<-ch)
@@ -0,0 +1,165 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// docker hub 在凭据文件中的地址
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+// Credential 仓库的用户名和密码
+type Credential struct {
+	Username string
+	Password string
+}
+
+// 凭据文件，和 docker login 生成的 ~/.docker/config.json 格式相同
+type credentialsFile struct {
+	Auths map[string]struct {
+		// base64 编码的 用户名:密码
+		Auth     string `json:"auth"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"auths"`
+}
+
+// DefaultAuthFile 默认的凭据文件 ~/.docker/config.json，可以直接使用 docker login 保存的凭据
+func DefaultAuthFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "/root"
+	}
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// LoadCredential 从凭据文件中读取仓库的凭据，文件不存在或者没有这个仓库的凭据时返回 nil
+func LoadCredential(file string, domain string) (*Credential, error) {
+	content, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取凭据文件 %s 失败 %v", file, err)
+	}
+	var config credentialsFile
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("解析凭据文件 %s 失败 %v", file, err)
+	}
+	for key, auth := range config.Auths {
+		if credentialDomain(key) != domain {
+			continue
+		}
+		if auth.Auth == "" {
+			return &Credential{Username: auth.Username, Password: auth.Password}, nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("凭据文件中 %s 的 auth 格式错误 %v", key, err)
+		}
+		username, password, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return nil, fmt.Errorf("凭据文件中 %s 的 auth 格式错误", key)
+		}
+		return &Credential{Username: username, Password: password}, nil
+	}
+	return nil, nil
+}
+
+// 凭据文件中的地址可能带有协议和路径
+func credentialDomain(key string) string {
+	if key == dockerHubAuthKey {
+		return DefaultDomain
+	}
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	key, _, _ = strings.Cut(key, "/")
+	return key
+}
+
+// 401 响应中 WWW-Authenticate 的认证要求，例如 Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+type challenge struct {
+	scheme string
+	params map[string]string
+}
+
+func parseChallenge(header string) (*challenge, error) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	c := &challenge{scheme: strings.ToLower(scheme), params: map[string]string{}}
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				return nil, fmt.Errorf("WWW-Authenticate 格式错误: %s", header)
+			}
+			c.params[key] = value[1 : end+1]
+			rest = strings.TrimPrefix(strings.TrimSpace(value[end+2:]), ",")
+		} else {
+			value, rest, _ = strings.Cut(value, ",")
+			c.params[key] = strings.TrimSpace(value)
+		}
+	}
+	if c.scheme != "bearer" && c.scheme != "basic" {
+		return nil, fmt.Errorf("不支持的认证方式: %s", scheme)
+	}
+	return c, nil
+}
+
+// 向认证服务申请 token，有凭据时使用 basic 认证
+func (c *Client) fetchToken(ch *challenge, scope string) (string, error) {
+	realm := ch.params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("WWW-Authenticate 中没有 realm")
+	}
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", fmt.Errorf("认证地址格式错误: %s", realm)
+	}
+	query := u.Query()
+	if service := ch.params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	if scope != "" {
+		query.Set("scope", scope)
+	}
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.credential != nil {
+		req.SetBasicAuth(c.credential.Username, c.credential.Password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("获取 token 失败 %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("获取 token 失败: %v", responseError(resp))
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("解析 token 失败 %v", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", fmt.Errorf("认证服务没有返回 token")
+	}
+	return token.Token, nil
+}
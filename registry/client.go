@@ -0,0 +1,414 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// manifest 的 media type，拉取时按顺序协商
+const (
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// DefaultChunkSize 上传 blob 时每个分块的大小
+const DefaultChunkSize = 5 << 20
+
+// 分块上传失败后，从断点继续上传的最大次数
+const maxUploadRetries = 3
+
+// manifest 的最大长度，和 distribution 相同
+const maxManifestSize = 4 << 20
+
+// Options 连接仓库的参数
+type Options struct {
+	// 使用 http 访问仓库，用于没有配置证书的局域网仓库
+	Insecure bool
+	// 凭据文件，为空时使用 DefaultAuthFile
+	AuthFile string
+	// 上传 blob 时每个分块的大小，小于等于 0 时使用 DefaultChunkSize
+	ChunkSize int64
+	// 为空时使用 http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// Client 访问 OCI distribution (Docker Registry HTTP API v2) 的客户端，一个 Client 对应一个仓库地址
+type Client struct {
+	base       *url.URL
+	http       *http.Client
+	credential *Credential
+	chunkSize  int64
+
+	lock sync.Mutex
+	// basic 认证的仓库直接使用凭据，bearer 认证的仓库按 scope 缓存 token
+	basic  bool
+	tokens map[string]string
+}
+
+// NewClient 创建访问仓库的客户端，domain 是 Reference.Domain
+func NewClient(domain string, options *Options) (*Client, error) {
+	if options == nil {
+		options = &Options{}
+	}
+	scheme, host := "https", domain
+	if options.Insecure {
+		scheme = "http"
+	}
+	if domain == DefaultDomain {
+		host = dockerHubHost
+	}
+	authFile := options.AuthFile
+	if authFile == "" {
+		authFile = DefaultAuthFile()
+	}
+	credential, err := LoadCredential(authFile, domain)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		base:       &url.URL{Scheme: scheme, Host: host},
+		http:       options.HTTPClient,
+		credential: credential,
+		chunkSize:  options.ChunkSize,
+		tokens:     map[string]string{},
+	}
+	if c.http == nil {
+		c.http = http.DefaultClient
+	}
+	if c.chunkSize <= 0 {
+		c.chunkSize = DefaultChunkSize
+	}
+	return c, nil
+}
+
+// 发送请求，返回 401 时按照 WWW-Authenticate 认证后重试一次
+// newRequest 每次创建新的请求，请求体可以重新读取
+func (c *Client) do(scope string, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for retried := false; ; retried = true {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		c.authorize(req, scope)
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || retried {
+			return resp, nil
+		}
+		header := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := c.authenticate(header, scope); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) authorize(req *http.Request, scope string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.basic && c.credential != nil {
+		req.SetBasicAuth(c.credential.Username, c.credential.Password)
+	} else if token := c.tokens[scope]; token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+func (c *Client) authenticate(header string, scope string) error {
+	if header == "" {
+		return fmt.Errorf("仓库要求认证，但是没有返回 WWW-Authenticate")
+	}
+	ch, err := parseChallenge(header)
+	if err != nil {
+		return err
+	}
+	if ch.scheme == "basic" {
+		if c.credential == nil {
+			return fmt.Errorf("仓库 %s 要求认证，凭据文件中没有它的凭据", c.base.Host)
+		}
+		c.lock.Lock()
+		c.basic = true
+		c.lock.Unlock()
+		return nil
+	}
+	token, err := c.fetchToken(ch, scope)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	c.tokens[scope] = token
+	c.lock.Unlock()
+	return nil
+}
+
+// 仓库 API 的地址，location 可以是上传接口返回的相对地址
+func (c *Client) url(location string) (*url.URL, error) {
+	u, err := c.base.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("地址格式错误: %s", location)
+	}
+	return u, nil
+}
+
+func (c *Client) request(scope string, method string, location string, body []byte, header http.Header) (*http.Response, error) {
+	u, err := c.url(location)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(scope, func() (*http.Request, error) {
+		req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		return req, nil
+	})
+}
+
+// GetManifest 获取 manifest，返回内容，media type 以及内容的摘要
+// ref 是摘要时校验内容
+func (c *Client) GetManifest(ref *Reference) ([]byte, string, string, error) {
+	header := http.Header{}
+	header.Set("Accept", strings.Join([]string{MediaTypeOCIIndex, MediaTypeOCIManifest, MediaTypeDockerManifestList, MediaTypeDockerManifest}, ", "))
+	resp, err := c.request(ref.Scope("pull"), http.MethodGet, "/v2/"+ref.Path+"/manifests/"+ref.Ref(), nil, header)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("获取 %s 的 manifest 失败 %v", ref, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", "", fmt.Errorf("获取 %s 的 manifest 失败: %v", ref, responseError(resp))
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, "", "", fmt.Errorf("读取 %s 的 manifest 失败 %v", ref, err)
+	}
+	if len(content) > maxManifestSize {
+		return nil, "", "", fmt.Errorf("%s 的 manifest 超过 %d 字节", ref, maxManifestSize)
+	}
+	digest := Digest(content)
+	if ref.Digest != "" && digest != ref.Digest {
+		return nil, "", "", fmt.Errorf("%s 的 manifest 的摘要为 %s", ref, digest)
+	}
+	mediaType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	if mediaType == "" || mediaType == "application/json" {
+		// 没有 Content-Type 时使用 manifest 中的 mediaType
+		var m struct {
+			MediaType string `json:"mediaType"`
+		}
+		_ = json.Unmarshal(content, &m)
+		mediaType = m.MediaType
+	}
+	return content, strings.TrimSpace(mediaType), digest, nil
+}
+
+// PutManifest 上传 manifest，ref.Ref() 是版本或者摘要，返回 manifest 的摘要
+func (c *Client) PutManifest(ref *Reference, mediaType string, content []byte) (string, error) {
+	header := http.Header{}
+	header.Set("Content-Type", mediaType)
+	resp, err := c.request(ref.Scope("pull,push"), http.MethodPut, "/v2/"+ref.Path+"/manifests/"+ref.Ref(), content, header)
+	if err != nil {
+		return "", fmt.Errorf("上传 %s 的 manifest 失败 %v", ref, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("上传 %s 的 manifest 失败: %v", ref, responseError(resp))
+	}
+	return Digest(content), nil
+}
+
+// BlobExists 仓库中是否已经有这个 blob
+func (c *Client) BlobExists(ref *Reference, digest string) (bool, error) {
+	resp, err := c.request(ref.Scope("pull"), http.MethodHead, "/v2/"+ref.Path+"/blobs/"+digest, nil, nil)
+	if err != nil {
+		return false, fmt.Errorf("查询 blob %s 失败 %v", digest, err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("查询 blob %s 失败: %s", digest, resp.Status)
+	}
+}
+
+// GetBlob 下载 blob，读取到末尾时校验摘要，摘要不一致时 Read 返回错误
+func (c *Client) GetBlob(ref *Reference, digest string) (io.ReadCloser, error) {
+	resp, err := c.request(ref.Scope("pull"), http.MethodGet, "/v2/"+ref.Path+"/blobs/"+digest, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("下载 blob %s 失败 %v", digest, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("下载 blob %s 失败: %v", digest, responseError(resp))
+	}
+	return &verifyReader{body: resp.Body, hash: sha256.New(), digest: digest}, nil
+}
+
+// 读取时计算摘要，读到末尾时和期望的摘要比较
+type verifyReader struct {
+	body   io.ReadCloser
+	hash   hash.Hash
+	digest string
+}
+
+func (r *verifyReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF {
+		if actual := "sha256:" + hex.EncodeToString(r.hash.Sum(nil)); actual != r.digest {
+			return n, fmt.Errorf("blob 的摘要为 %s, 期望 %s", actual, r.digest)
+		}
+	}
+	return n, err
+}
+
+func (r *verifyReader) Close() error {
+	return r.body.Close()
+}
+
+// UploadBlob 分块上传 blob，仓库中已经存在时跳过
+// 分块上传失败时查询仓库已经收到的长度，从断点继续上传
+func (c *Client) UploadBlob(ref *Reference, digest string, size int64, content io.ReaderAt) error {
+	exists, err := c.BlobExists(ref, digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	scope := ref.Scope("pull,push")
+	resp, err := c.request(scope, http.MethodPost, "/v2/"+ref.Path+"/blobs/uploads/", nil, nil)
+	if err != nil {
+		return fmt.Errorf("开始上传 blob %s 失败 %v", digest, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("开始上传 blob %s 失败: %s", digest, resp.Status)
+	}
+	location := resp.Header.Get("Location")
+	var offset int64
+	for retries := 0; offset < size; {
+		end := offset + c.chunkSize
+		if end > size {
+			end = size
+		}
+		next, err := c.uploadChunk(scope, location, io.NewSectionReader(content, offset, end-offset), offset, end)
+		if err == nil {
+			offset, location = end, next
+			retries = 0
+			continue
+		}
+		if retries++; retries > maxUploadRetries {
+			return fmt.Errorf("上传 blob %s 失败 %v", digest, err)
+		}
+		if offset, location, err = c.uploadStatus(scope, location); err != nil {
+			return fmt.Errorf("上传 blob %s 失败，查询上传进度失败 %v", digest, err)
+		}
+	}
+	u, err := c.url(location)
+	if err != nil {
+		return err
+	}
+	query := u.Query()
+	query.Set("digest", digest)
+	u.RawQuery = query.Encode()
+	resp, err = c.request(scope, http.MethodPut, u.String(), nil, nil)
+	if err != nil {
+		return fmt.Errorf("完成上传 blob %s 失败 %v", digest, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("完成上传 blob %s 失败: %v", digest, responseError(resp))
+	}
+	return nil
+}
+
+// 上传 [start, end) 的内容，返回下一个分块的上传地址
+func (c *Client) uploadChunk(scope string, location string, chunk io.Reader, start int64, end int64) (string, error) {
+	content, err := io.ReadAll(chunk)
+	if err != nil {
+		return "", err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("Content-Range", fmt.Sprintf("%d-%d", start, end-1))
+	resp, err := c.request(scope, http.MethodPatch, location, content, header)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return "", responseError(resp)
+	}
+	if next := resp.Header.Get("Location"); next != "" {
+		return next, nil
+	}
+	return location, nil
+}
+
+// 查询上传进度，返回仓库已经收到的长度和继续上传的地址
+func (c *Client) uploadStatus(scope string, location string) (int64, string, error) {
+	resp, err := c.request(scope, http.MethodGet, location, nil, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return 0, "", responseError(resp)
+	}
+	if next := resp.Header.Get("Location"); next != "" {
+		location = next
+	}
+	// Range 为 0-最后一个字节的位置，没有收到内容时可能是 0--1 或者没有 Range
+	_, last, ok := strings.Cut(resp.Header.Get("Range"), "-")
+	if !ok {
+		return 0, location, nil
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("上传进度格式错误: %s", resp.Header.Get("Range"))
+	}
+	return end + 1, location, nil
+}
+
+// 仓库返回的错误，格式为 {"errors": [{"code": "...", "message": "..."}]}
+func responseError(resp *http.Response) error {
+	var body struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(content, &body) == nil && len(body.Errors) > 0 {
+		var messages []string
+		for _, e := range body.Errors {
+			messages = append(messages, e.Code+": "+e.Message)
+		}
+		return fmt.Errorf("%s %s", resp.Status, strings.Join(messages, "; "))
+	}
+	return fmt.Errorf("%s", resp.Status)
+}
+
+// Digest 内容的 sha256 摘要
+func Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,94 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 没有指定仓库地址时使用 docker hub
+const (
+	DefaultDomain = "docker.io"
+	// docker hub 的 API 地址
+	dockerHubHost = "registry-1.docker.io"
+	// docker hub 的官方镜像在 library 下
+	officialRepoPrefix = "library/"
+	DefaultTag         = "latest"
+)
+
+var (
+	pathPattern   = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagPattern    = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+// Reference 镜像在仓库中的位置，例如 192.168.1.10:5000/app:1.0 或者 busybox@sha256:...
+type Reference struct {
+	// 仓库地址，host 或者 host:port
+	Domain string
+	// 仓库中的名称，docker hub 的官方镜像加上 library/
+	Path string
+	Tag  string
+	// 指定摘要时按摘要拉取，忽略 Tag
+	Digest string
+}
+
+// ParseReference 解析镜像名称，第一段包含 . 或者 : 或者是 localhost 时作为仓库地址，否则使用 docker hub，没有版本时使用 latest
+func ParseReference(s string) (*Reference, error) {
+	ref := &Reference{Domain: DefaultDomain}
+	rest := s
+	if i := strings.Index(rest, "@"); i >= 0 {
+		ref.Digest = rest[i+1:]
+		rest = rest[:i]
+		if !digestPattern.MatchString(ref.Digest) {
+			return nil, fmt.Errorf("镜像名称 %s 中的摘要格式错误", s)
+		}
+	}
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		ref.Tag = rest[i+1:]
+		rest = rest[:i]
+		if !tagPattern.MatchString(ref.Tag) {
+			return nil, fmt.Errorf("镜像名称 %s 中的版本格式错误", s)
+		}
+	}
+	if first, remain, ok := strings.Cut(rest, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		ref.Domain = first
+		rest = remain
+	}
+	if ref.Domain == DefaultDomain && !strings.Contains(rest, "/") {
+		rest = officialRepoPrefix + rest
+	}
+	if !pathPattern.MatchString(rest) {
+		return nil, fmt.Errorf("镜像名称格式错误: %s", s)
+	}
+	ref.Path = rest
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = DefaultTag
+	}
+	return ref, nil
+}
+
+// Name 完整的镜像名称，不包括版本和摘要
+func (r *Reference) Name() string {
+	return r.Domain + "/" + r.Path
+}
+
+// Ref manifest 接口中使用的版本或者摘要
+func (r *Reference) Ref() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+func (r *Reference) String() string {
+	if r.Digest != "" {
+		return r.Name() + "@" + r.Digest
+	}
+	return r.Name() + ":" + r.Tag
+}
+
+// Scope 访问镜像需要的 token 权限，actions 为 pull 或者 pull,push
+func (r *Reference) Scope(actions string) string {
+	return "repository:" + r.Path + ":" + actions
+}
@@ -0,0 +1,371 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 测试使用的仓库，实现 distribution API 中拉取和推送需要的接口，使用 bearer token 认证
+type fakeRegistry struct {
+	server *httptest.Server
+
+	lock      sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string]fakeManifest
+	uploads   map[string]*bytes.Buffer
+	nextId    int
+	// 接下来的 PATCH 只保存一半的内容并返回 500，模拟上传中断
+	failPatches int
+	patches     int
+	// 需要认证时的用户名和密码，为空时不需要认证
+	username string
+	password string
+	// 发出的 token 对应的 scope
+	tokens map[string]string
+}
+
+type fakeManifest struct {
+	mediaType string
+	content   []byte
+}
+
+func newFakeRegistry(t *testing.T, username string, password string) *fakeRegistry {
+	r := &fakeRegistry{
+		blobs:     map[string][]byte{},
+		manifests: map[string]fakeManifest{},
+		uploads:   map[string]*bytes.Buffer{},
+		username:  username,
+		password:  password,
+		tokens:    map[string]string{},
+	}
+	r.server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+// 仓库地址，作为 Reference 的 Domain
+func (r *fakeRegistry) domain() string {
+	return strings.TrimPrefix(r.server.URL, "http://")
+}
+
+func (r *fakeRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if req.URL.Path == "/token" {
+		r.serveToken(w, req)
+		return
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	if r.username != "" && !r.authorized(req, path) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, r.server.URL))
+		writeRegistryError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+	switch {
+	case strings.Contains(path, "/manifests/"):
+		repo, ref, _ := strings.Cut(path, "/manifests/")
+		r.serveManifest(w, req, repo, ref)
+	case strings.Contains(path, "/blobs/uploads/"):
+		repo, id, _ := strings.Cut(path, "/blobs/uploads/")
+		r.serveUpload(w, req, repo, id)
+	case strings.Contains(path, "/blobs/"):
+		_, digest, _ := strings.Cut(path, "/blobs/")
+		content, ok := r.blobs[digest]
+		if !ok {
+			writeRegistryError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		if req.Method == http.MethodGet {
+			w.Write(content)
+		}
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (r *fakeRegistry) serveToken(w http.ResponseWriter, req *http.Request) {
+	username, password, ok := req.BasicAuth()
+	if !ok || username != r.username || password != r.password {
+		writeRegistryError(w, http.StatusUnauthorized, "UNAUTHORIZED", "bad credentials")
+		return
+	}
+	token := fmt.Sprintf("token-%d", len(r.tokens))
+	r.tokens[token] = req.URL.Query().Get("scope")
+	json.NewEncoder(w).Encode(map[string]string{"token": token})
+}
+
+// token 的 scope 需要包含请求的仓库，推送需要 push 权限
+func (r *fakeRegistry) authorized(req *http.Request, path string) bool {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	scope, ok := r.tokens[token]
+	if !ok {
+		return false
+	}
+	repo, _, _ := strings.Cut(path, "/manifests/")
+	repo, _, _ = strings.Cut(repo, "/blobs/")
+	if !strings.HasPrefix(scope, "repository:"+repo+":") {
+		return false
+	}
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return true
+	}
+	return strings.Contains(scope, "push")
+}
+
+func (r *fakeRegistry) serveManifest(w http.ResponseWriter, req *http.Request, repo string, ref string) {
+	switch req.Method {
+	case http.MethodPut:
+		content, _ := io.ReadAll(req.Body)
+		m := fakeManifest{mediaType: req.Header.Get("Content-Type"), content: content}
+		r.manifests[repo+"@"+Digest(content)] = m
+		r.manifests[repo+":"+ref] = m
+		w.Header().Set("Docker-Content-Digest", Digest(content))
+		w.WriteHeader(http.StatusCreated)
+	default:
+		key := repo + ":" + ref
+		if strings.HasPrefix(ref, "sha256:") {
+			key = repo + "@" + ref
+		}
+		m, ok := r.manifests[key]
+		if !ok {
+			writeRegistryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+		if !strings.Contains(req.Header.Get("Accept"), m.mediaType) {
+			writeRegistryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "no acceptable media type")
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Write(m.content)
+	}
+}
+
+func (r *fakeRegistry) serveUpload(w http.ResponseWriter, req *http.Request, repo string, id string) {
+	if req.Method == http.MethodPost {
+		r.nextId++
+		id = strconv.Itoa(r.nextId)
+		r.uploads[id] = &bytes.Buffer{}
+		w.Header().Set("Location", "/v2/"+repo+"/blobs/uploads/"+id)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	upload, ok := r.uploads[id]
+	if !ok {
+		writeRegistryError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "upload unknown")
+		return
+	}
+	location := "/v2/" + repo + "/blobs/uploads/" + id
+	switch req.Method {
+	case http.MethodPatch:
+		r.patches++
+		content, _ := io.ReadAll(req.Body)
+		start, _, _ := strings.Cut(req.Header.Get("Content-Range"), "-")
+		if offset, _ := strconv.Atoi(start); offset != upload.Len() {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if r.failPatches > 0 {
+			r.failPatches--
+			upload.Write(content[:len(content)/2])
+			writeRegistryError(w, http.StatusInternalServerError, "UNKNOWN", "connection lost")
+			return
+		}
+		upload.Write(content)
+		w.Header().Set("Location", location)
+		w.Header().Set("Range", fmt.Sprintf("0-%d", upload.Len()-1))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodGet:
+		w.Header().Set("Location", location)
+		w.Header().Set("Range", fmt.Sprintf("0-%d", upload.Len()-1))
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPut:
+		digest := req.URL.Query().Get("digest")
+		if Digest(upload.Bytes()) != digest {
+			writeRegistryError(w, http.StatusBadRequest, "DIGEST_INVALID", "digest mismatch")
+			return
+		}
+		r.blobs[digest] = upload.Bytes()
+		delete(r.uploads, id)
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func writeRegistryError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"errors":[{"code":%q,"message":%q}]}`, code, message)
+}
+
+// 写入凭据文件，返回文件路径
+func writeAuthFile(t *testing.T, domain string, username string, password string) string {
+	file := filepath.Join(t.TempDir(), "config.json")
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	content := fmt.Sprintf(`{"auths":{"http://%s":{"auth":%q}}}`, domain, auth)
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestParseReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	cases := []struct {
+		input  string
+		domain string
+		path   string
+		ref    string
+		err    bool
+	}{
+		{input: "busybox", domain: "docker.io", path: "library/busybox", ref: "latest"},
+		{input: "user/app:1.0", domain: "docker.io", path: "user/app", ref: "1.0"},
+		{input: "192.168.1.10:5000/app", domain: "192.168.1.10:5000", path: "app", ref: "latest"},
+		{input: "localhost/team/app:v2", domain: "localhost", path: "team/app", ref: "v2"},
+		{input: "registry.lan/app@" + digest, domain: "registry.lan", path: "app", ref: digest},
+		{input: "App:1", err: true},
+		{input: "app@sha256:123", err: true},
+	}
+	for _, c := range cases {
+		ref, err := ParseReference(c.input)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: 期望解析失败", c.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.input, err)
+			continue
+		}
+		if ref.Domain != c.domain || ref.Path != c.path || ref.Ref() != c.ref {
+			t.Errorf("%s: 解析为 %s %s %s", c.input, ref.Domain, ref.Path, ref.Ref())
+		}
+	}
+}
+
+func TestUploadBlobResume(t *testing.T) {
+	r := newFakeRegistry(t, "user", "secret")
+	client, err := NewClient(r.domain(), &Options{
+		Insecure:  true,
+		AuthFile:  writeAuthFile(t, r.domain(), "user", "secret"),
+		ChunkSize: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, _ := ParseReference(r.domain() + "/team/app:1")
+	content := []byte(strings.Repeat("0123456789abcdef", 7))
+	digest := Digest(content)
+	r.failPatches = 2
+	if err := client.UploadBlob(ref, digest, int64(len(content)), bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r.blobs[digest], content) {
+		t.Fatalf("仓库中的 blob 和上传的内容不一致")
+	}
+	// 两次失败各保存了 5 字节，从第 10 个字节继续上传剩下的 11 个分块
+	if r.patches != 13 {
+		t.Errorf("PATCH 请求 %d 次, 期望 13 次", r.patches)
+	}
+	// 已经存在的 blob 不再上传
+	r.patches = 0
+	if err := client.UploadBlob(ref, digest, int64(len(content)), bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if r.patches != 0 {
+		t.Errorf("已经存在的 blob 又上传了 %d 次", r.patches)
+	}
+	blob, err := client.GetBlob(ref, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := io.ReadAll(blob)
+	blob.Close()
+	if err != nil || !bytes.Equal(downloaded, content) {
+		t.Fatalf("下载的 blob 不一致 %v", err)
+	}
+}
+
+func TestGetBlobVerifyDigest(t *testing.T) {
+	r := newFakeRegistry(t, "", "")
+	client, _ := NewClient(r.domain(), &Options{Insecure: true, AuthFile: filepath.Join(t.TempDir(), "none.json")})
+	ref, _ := ParseReference(r.domain() + "/app")
+	digest := Digest([]byte("expected"))
+	r.blobs[digest] = []byte("tampered")
+	blob, err := client.GetBlob(ref, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blob.Close()
+	if _, err := io.ReadAll(blob); err == nil {
+		t.Fatal("内容和摘要不一致时应该返回错误")
+	}
+}
+
+func TestManifestNegotiation(t *testing.T) {
+	r := newFakeRegistry(t, "user", "secret")
+	client, _ := NewClient(r.domain(), &Options{Insecure: true, AuthFile: writeAuthFile(t, r.domain(), "user", "secret")})
+	ref, _ := ParseReference(r.domain() + "/app:1")
+	content := []byte(`{"schemaVersion":2,"mediaType":"` + MediaTypeDockerManifestList + `","manifests":[]}`)
+	digest, err := client.PutManifest(ref, MediaTypeDockerManifestList, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, mediaType, gotDigest, err := client.GetManifest(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != MediaTypeDockerManifestList || gotDigest != digest || !bytes.Equal(got, content) {
+		t.Fatalf("获取的 manifest 不一致: %s %s", mediaType, gotDigest)
+	}
+	byDigest, _ := ParseReference(r.domain() + "/app@" + digest)
+	if _, _, _, err := client.GetManifest(byDigest); err != nil {
+		t.Fatal(err)
+	}
+	missing, _ := ParseReference(r.domain() + "/app:2")
+	if _, _, _, err := client.GetManifest(missing); err == nil || !strings.Contains(err.Error(), "MANIFEST_UNKNOWN") {
+		t.Fatalf("不存在的 manifest 应该返回仓库的错误, %v", err)
+	}
+}
+
+func TestAuthRequired(t *testing.T) {
+	r := newFakeRegistry(t, "user", "secret")
+	ref, _ := ParseReference(r.domain() + "/app:1")
+	for _, authFile := range []string{
+		filepath.Join(t.TempDir(), "none.json"),
+		writeAuthFile(t, r.domain(), "user", "wrong"),
+	} {
+		client, err := NewClient(r.domain(), &Options{Insecure: true, AuthFile: authFile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, _, err := client.GetManifest(ref); err == nil {
+			t.Fatal("没有正确的凭据时应该认证失败")
+		}
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	c, err := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/busybox:pull"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.scheme != "bearer" || c.params["realm"] != "https://auth.docker.io/token" ||
+		c.params["service"] != "registry.docker.io" || c.params["scope"] != "repository:library/busybox:pull" {
+		t.Fatalf("解析结果错误: %+v", c)
+	}
+	if c, err := parseChallenge(`Basic realm=registry`); err != nil || c.scheme != "basic" || c.params["realm"] != "registry" {
+		t.Fatalf("解析结果错误: %+v %v", c, err)
+	}
+}
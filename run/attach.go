@@ -0,0 +1,334 @@
+package run
+
+import (
+	"bufio"
+	"containers"
+	"encoding/json"
+	"fmt"
+	"log"
+	"logger"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// 容器退出后等待标准输出和标准错误读取完毕的最长时间
+const drainTimeout = time.Second
+
+// 容器的标准输入输出，由 shim 进程持有
+// 标准输出和标准错误按行交给容器的日志驱动，同时发送给 attach 的客户端，
+// 容器使用 -i 启动时保持标准输入打开，attach 的客户端写入容器的标准输入
+// 容器使用 -t 启动时分配伪终端，从设备是 init 进程的标准输入输出以及控制终端，标准输出和标准错误都从主设备读取
+type containerIO struct {
+	info *containers.ContainerInfo
+	// 交给 init 进程的标准输入，标准输出，标准错误，启动 init 进程后关闭
+	files []*os.File
+	// 伪终端的主设备，没有使用 -t 启动时为空
+	tty *os.File
+	// 容器标准输入的写端，没有使用 -i 启动时为空，使用终端时是主设备
+	stdin  *os.File
+	stdout *os.File
+	// 使用终端时为空
+	stderr *os.File
+	// 容器的日志驱动
+	logger logger.Logger
+	// 监听 attach socket
+	listener net.Listener
+	// 标准输出和标准错误都读取完毕时关闭
+	drained chan struct{}
+
+	lock    sync.Mutex
+	clients map[net.Conn]bool
+	// 容器已经退出，不再接受新的 attach
+	exited   bool
+	exitCode int
+}
+
+// 创建容器的标准输入输出，并监听 attach socket
+func newContainerIO(info *containers.ContainerInfo) (*containerIO, error) {
+	c := &containerIO{info: info, clients: map[net.Conn]bool{}, drained: make(chan struct{})}
+	if err := c.open(); err != nil {
+		c.closeFiles()
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *containerIO) open() error {
+	if err := os.MkdirAll(c.info.BaseUrl, 0622); err != nil {
+		return fmt.Errorf("创建目录 %s 失败 %v", c.info.BaseUrl, err)
+	}
+	var err error
+	if c.logger, err = logger.New(c.info.LogConfig, c.info.BaseUrl); err != nil {
+		return fmt.Errorf("创建容器的日志驱动失败 %v", err)
+	}
+	openStdin := c.info.Config != nil && c.info.Config.OpenStdin
+	if c.info.Config != nil && c.info.Config.Tty {
+		master, slave, err := containers.OpenPty()
+		if err != nil {
+			return err
+		}
+		c.tty, c.stdout = master, master
+		if openStdin {
+			c.stdin = master
+		}
+		c.files = []*os.File{slave, slave, slave}
+	} else {
+		var stdin *os.File
+		if openStdin {
+			if stdin, c.stdin, err = os.Pipe(); err != nil {
+				return fmt.Errorf("创建管道失败 %v", err)
+			}
+		}
+		// 没有打开标准输入时 init 进程使用 /dev/null
+		c.files = []*os.File{stdin, nil, nil}
+		if c.stdout, c.files[1], err = os.Pipe(); err != nil {
+			return fmt.Errorf("创建管道失败 %v", err)
+		}
+		if c.stderr, c.files[2], err = os.Pipe(); err != nil {
+			return fmt.Errorf("创建管道失败 %v", err)
+		}
+	}
+	socket := containers.AttachSocket(c.info.Id)
+	// 删除上一次运行遗留的 socket
+	_ = os.Remove(socket)
+	if c.listener, err = net.Listen("unix", socket); err != nil {
+		return fmt.Errorf("监听 %s 失败 %v", socket, err)
+	}
+	return nil
+}
+
+// 使用终端时 init 进程创建新的会话，并把伪终端的从设备设置为控制终端
+func (c *containerIO) setTerminal(cmd *exec.Cmd) {
+	if c.tty == nil {
+		return
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	// 子进程中的文件描述符 0，也就是从设备
+	cmd.SysProcAttr.Ctty = 0
+}
+
+// 关闭交给 init 进程的文件，init 进程启动之后调用
+func (c *containerIO) closeFiles() {
+	for _, f := range c.files {
+		if f != nil {
+			f.Close()
+		}
+	}
+	c.files = nil
+}
+
+// 开始读取容器的输出并接受 attach 连接
+func (c *containerIO) start() {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go c.copyOutput(&wg, c.stdout, containers.AttachStdout, logger.Stdout)
+	if c.stderr != nil {
+		wg.Add(1)
+		go c.copyOutput(&wg, c.stderr, containers.AttachStderr, logger.Stderr)
+	}
+	go func() {
+		wg.Wait()
+		close(c.drained)
+	}()
+	go c.serve()
+}
+
+// 读取容器的输出，按行写入日志驱动并发送给所有 attach 的客户端，source 是日志中记录的输出来源
+func (c *containerIO) copyOutput(wg *sync.WaitGroup, r *os.File, stream byte, source string) {
+	defer wg.Done()
+	copier := logger.NewCopier(c.logger, source)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, err := copier.Write(buf[:n]); err != nil {
+				log.Printf("写入容器 %s 的日志失败: %v\n", c.info.Id, err)
+			}
+			c.broadcast(stream, buf[:n])
+		}
+		// 使用终端时所有从设备关闭后读取主设备返回 EIO
+		if err != nil {
+			if err := copier.Flush(); err != nil {
+				log.Printf("写入容器 %s 的日志失败: %v\n", c.info.Id, err)
+			}
+			return
+		}
+	}
+}
+
+func (c *containerIO) broadcast(stream byte, data []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for conn := range c.clients {
+		// 客户端已经断开
+		if err := containers.WriteFrame(conn, stream, data); err != nil {
+			conn.Close()
+			delete(c.clients, conn)
+		}
+	}
+}
+
+func (c *containerIO) serve() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+		go c.attach(conn)
+	}
+}
+
+// 处理一个 attach 连接，第一行是 json 格式的 AttachRequest，之后是客户端发送的标准输入和窗口大小
+func (c *containerIO) attach(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	var request containers.AttachRequest
+	line, err := reader.ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &request)
+	}
+	var keys []byte
+	if err == nil {
+		keys, err = containers.ParseDetachKeys(request.DetachKeys)
+	}
+	if err != nil {
+		endAttach(conn, &containers.AttachResult{Id: c.info.Id, Message: fmt.Sprintf("attach 请求错误: %v", err)})
+		return
+	}
+	c.lock.Lock()
+	if c.exited {
+		c.lock.Unlock()
+		endAttach(conn, &containers.AttachResult{Id: c.info.Id, ExitCode: c.exitCode})
+		return
+	}
+	c.clients[conn] = true
+	stdin := c.stdin
+	c.lock.Unlock()
+	if !request.Stdin {
+		stdin = nil
+	}
+	matcher := containers.NewDetachKeysMatcher(keys)
+	for {
+		stream, data, err := containers.ReadFrame(reader)
+		if err != nil {
+			break
+		}
+		switch stream {
+		case containers.AttachStdin:
+			if stdin == nil {
+				continue
+			}
+			out, detached := matcher.Feed(data)
+			if len(out) > 0 {
+				_, _ = stdin.Write(out)
+			}
+			if detached {
+				c.detach(conn)
+				return
+			}
+		case containers.AttachResize:
+			c.resize(data)
+		}
+	}
+	// 前台启动的容器在客户端的标准输入结束时关闭标准输入，例如 echo hello | mydocker run -i --image base cat
+	if stdin != nil && !c.info.Config.Detach {
+		c.closeStdin()
+	}
+}
+
+// 调整伪终端的大小，容器没有使用终端时忽略
+func (c *containerIO) resize(data []byte) {
+	if c.tty == nil {
+		return
+	}
+	var size containers.WindowSize
+	if err := json.Unmarshal(data, &size); err != nil {
+		log.Printf("解析终端窗口大小失败: %v\n", err)
+		return
+	}
+	if err := containers.SetWindowSize(c.tty, &size); err != nil {
+		log.Printf("调整容器 %s 的终端大小失败: %v\n", c.info.Id, err)
+	}
+}
+
+// 客户端按下了分离按键，断开连接，容器继续运行
+func (c *containerIO) detach(conn net.Conn) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.clients[conn] {
+		return
+	}
+	delete(c.clients, conn)
+	endAttach(conn, &containers.AttachResult{Id: c.info.Id, Detached: true})
+}
+
+func (c *containerIO) closeStdin() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.stdin == nil {
+		return
+	}
+	if c.stdin == c.tty {
+		// 终端没有单独的写端，发送 EOF 字符，读取标准输入的进程读到 EOF
+		_, _ = c.stdin.Write([]byte{4})
+	} else {
+		c.stdin.Close()
+	}
+	c.stdin = nil
+}
+
+// 容器已经退出，等待输出读取完毕后通知所有 attach 的客户端并关闭文件
+func (c *containerIO) finish(exitCode int) {
+	select {
+	case <-c.drained:
+	case <-time.After(drainTimeout):
+		log.Printf("容器 %s 退出后输出没有结束\n", c.info.Id)
+	}
+	c.lock.Lock()
+	c.exited = true
+	c.exitCode = exitCode
+	for conn := range c.clients {
+		endAttach(conn, &containers.AttachResult{Id: c.info.Id, ExitCode: exitCode})
+	}
+	c.clients = map[net.Conn]bool{}
+	c.lock.Unlock()
+	c.close()
+}
+
+func (c *containerIO) close() {
+	if c.listener != nil {
+		c.listener.Close()
+	}
+	c.lock.Lock()
+	if c.stdin != nil && c.stdin != c.tty {
+		c.stdin.Close()
+	}
+	c.stdin = nil
+	c.lock.Unlock()
+	for _, f := range []*os.File{c.stdout, c.stderr} {
+		if f != nil {
+			f.Close()
+		}
+	}
+	if c.logger != nil {
+		if err := c.logger.Close(); err != nil {
+			log.Printf("关闭容器 %s 的日志失败: %v\n", c.info.Id, err)
+		}
+	}
+}
+
+// 发送 attach 的结果并关闭连接
+func endAttach(conn net.Conn, result *containers.AttachResult) {
+	content, err := json.Marshal(result)
+	if err == nil {
+		err = containers.WriteFrame(conn, containers.AttachEnd, content)
+	}
+	if err != nil {
+		log.Printf("返回 attach 结果失败: %v\n", err)
+	}
+	conn.Close()
+}
@@ -4,8 +4,8 @@ import (
 	"cgroups"
 	"containers"
 	"fmt"
-	"io"
 	"log"
+	"logger"
 	"networks"
 	"os"
 	"os/exec"
@@ -13,63 +13,209 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
-func Run(config containers.RunContainerConfig) {
-	imageId := containers.ResolveImageId(config.Image, false)
+// Run 创建并启动容器，返回容器信息以及容器的 shim 进程
+// attach 不为空时在容器的命令开始执行之前调用，见 Start
+func Run(config containers.RunContainerConfig, attach func(info *containers.ContainerInfo) error) (*containers.ContainerInfo, *exec.Cmd, error) {
+	info, err := Create(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	parent, err := Start(info, attach)
+	if err != nil {
+		containers.DeleteContainerInfo(info)
+		return nil, nil, err
+	}
+	return info, parent, nil
+}
+
+// Create 创建容器，只记录容器的配置，不启动容器进程
+func Create(config containers.RunContainerConfig) (*containers.ContainerInfo, error) {
+	imageId, err := containers.FindImageId(config.Image)
+	if err != nil {
+		return nil, err
+	}
+	restartPolicy, err := containers.ParseRestartPolicy(config.Restart)
+	if err != nil {
+		return nil, err
+	}
+	stopSignal, err := resolveStopSignal(config.StopSignal, imageId)
+	if err != nil {
+		return nil, err
+	}
+	// 前台交互式启动的容器退出后会被删除，不能重新启动
+	if config.Interactive() && restartPolicy.Name != containers.RestartNo {
+		return nil, fmt.Errorf("前台交互式启动的容器不支持重启策略, 请使用 -d")
+	}
+	logConfig, err := logger.ParseConfig(config.LogDriver, config.LogOpts)
+	if err != nil {
+		return nil, err
+	}
+	// 通过接口创建时可能没有设置资源限制
+	if config.Res == nil {
+		config.Res = &cgroups.ResourceConfig{}
+	}
 	command := containers.ResolveCmd(config.CmdArray, imageId, config.Tty)
 	// 提前获取容器id
 	containerInfo := &containers.ContainerInfo{
-		Id:          containers.ContainerId(),
-		Command:     strings.Join(command.Cmds, " "),
-		Status:      containers.Running,
-		SetCgroup:   true,
-		PortMapping: config.PortMapping,
+		Id:            containers.ContainerId(),
+		Command:       strings.Join(command.Cmds, " "),
+		Status:        containers.Created,
+		Image:         imageId,
+		PortMapping:   config.PortMapping,
+		Net:           config.Net,
+		Config:        &config,
+		CommandArray:  command,
+		RestartPolicy: restartPolicy,
+		StopSignal:    stopSignal,
+		Labels:        containerLabels(imageId, config.Labels),
+		HealthCheck:   resolveHealthCheck(config.HealthCheck, imageId),
+		LogConfig:     logConfig,
 	}
 	if config.ContainerName != "" {
 		if containers.ResolveContainerId(config.ContainerName, true) != "" {
-			fmt.Printf("容器名称重复 %s\n", config.ContainerName)
-			return
+			return nil, fmt.Errorf("容器名称重复 %s", config.ContainerName)
 		}
 		containerInfo.Name = config.ContainerName
 	}
 	// 获取容器基础目录
 	containerInfo.BaseUrl = fmt.Sprintf(containers.ContainerInfoLocation, containerInfo.Id)
-	parent, writePipe := containers.NewParentProcess(containerInfo, config.Tty, config.Volumes, config.Env, imageId)
-	if parent == nil {
-		log.Println("创建父进程失败")
-		return
+	containers.RecordContainerInfo(containerInfo, 0)
+	containers.LogContainerEvent(containerInfo, "create", nil)
+	return containerInfo, nil
+}
+
+// 容器的标签，镜像的标签加上创建时指定的标签
+func containerLabels(imageId string, labels []string) []string {
+	var result []string
+	if image, err := containers.GetImageInfo(imageId); err == nil {
+		result = append(result, image.Label...)
+	}
+	return append(result, labels...)
+}
+
+// 停止容器使用的信号，优先使用 --stop-signal，其次是镜像的 STOPSIGNAL
+func resolveStopSignal(stopSignal string, imageId string) (string, error) {
+	if stopSignal == "" {
+		if image, err := containers.GetImageInfo(imageId); err == nil {
+			stopSignal = image.StopSignal
+		}
+	}
+	if stopSignal == "" {
+		return containers.DefaultStopSignal, nil
+	}
+	if _, err := containers.ParseSignal(stopSignal); err != nil {
+		return "", err
+	}
+	return stopSignal, nil
+}
+
+// 健康检查的配置，run 的 --health-* 参数覆盖镜像的 HEALTHCHECK，没有配置或者被禁用时返回空
+func resolveHealthCheck(override *containers.HealthConfig, imageId string) *containers.HealthConfig {
+	var healthCheck *containers.HealthConfig
+	if image, err := containers.GetImageInfo(imageId); err == nil {
+		healthCheck = image.HealthCheck
+	}
+	result := healthCheck.Merge(override)
+	if !result.Enabled() {
+		return nil
+	}
+	return result
+}
+
+// Start 启动新创建的或者已经停止的容器，返回容器的 shim 进程，shim 进程退出说明容器已经退出
+// 已经停止的容器重新挂载 overlay 文件系统以及记录的卷，保留容器的可写层
+// 容器的输出由 shim 进程写到日志文件，attach 不为空时在 shim 启动之后，容器的命令开始执行之前调用，
+// 用于连接容器的标准输入输出，不会丢失容器最开始的输出，attach 失败时容器不会运行
+func Start(info *containers.ContainerInfo, attach func(info *containers.ContainerInfo) error) (*exec.Cmd, error) {
+	if info.IsRunning() {
+		return nil, fmt.Errorf("容器 %s 正在运行", info.Id)
 	}
+	if ShimRunning(info) {
+		return nil, fmt.Errorf("容器 %s 正在停止，还没有退出", info.Id)
+	}
+	config := info.Config
+	if config == nil || info.CommandArray == nil {
+		return nil, fmt.Errorf("容器 %s 没有记录创建时的配置", info.Id)
+	}
+	// 每次启动都使用创建时解析的命令，网络相关的设置在启动时重新计算
+	command := &containers.CommandArray{
+		Cmds:    info.CommandArray.Cmds,
+		WorkDir: info.CommandArray.WorkDir,
+	}
+	// 容器退出后可能还保留着之前的挂载，先取消再重新挂载容器的工作空间
+	containers.DeleteWorkSpace(info)
+	rootDir := containers.NewWorkSpace(info, config.Volumes, info.Image)
 	//处理域名解析
-	processResolv(parent.Dir, config)
-	if err := parent.Start(); err != nil {
-		fmt.Printf("启动父进程失败:%v\n", err)
+	processResolv(rootDir, *config)
+	shim, pid, writePipe, err := startShim(info)
+	if err != nil {
+		containers.DeleteWorkSpace(info)
+		return nil, err
 	}
-	fmt.Printf("容器进程 pid: %d \n", parent.Process.Pid)
+	if attach != nil {
+		if err := attach(info); err != nil {
+			// init 进程读取不到命令后退出，shim 清理容器
+			writePipe.Close()
+			_ = shim.Wait()
+			containers.DeleteWorkSpace(info)
+			return nil, err
+		}
+	}
+	log.Printf("容器进程 pid: %d, shim 进程 pid: %d \n", pid, shim.Process.Pid)
 	// 记录容器信息
-	containers.RecordContainerInfo(containerInfo, parent.Process.Pid)
-	cgroups.ProcessCgroup(containerInfo.Id, parent.Process.Pid, config.Res)
+	info.Status = containers.Running
+	info.ShimPid = strconv.Itoa(shim.Process.Pid)
+	info.ShimStartTime = containers.ProcessStartTime(shim.Process.Pid)
+	info.PidStartTime = containers.ProcessStartTime(pid)
+	info.PidNamespace = containers.PidNamespace(pid)
+	// 清除上一次运行的退出信息
+	info.ManuallyStopped = false
+	info.ExitCode = 0
+	info.FinishedAt = ""
+	info.OOMKilled = false
+	info.Health = nil
+	if info.HealthCheck.Enabled() {
+		info.Health = &containers.Health{Status: containers.HealthStarting}
+	}
+	info.SetCgroup = true
+	containers.RecordContainerInfo(info, pid)
+	cgroups.ProcessCgroup(info.Id, pid, config.Res)
 
 	if config.Net != "" {
-		networks.Init()
-		processNetWork(config.Net, command, containerInfo)
+		processNetWork(config.Net, command, info)
+		// 记录分配的网络信息
+		containers.RecordContainerInfo(info, pid)
 	}
-	// 将命令写到管道里面
+	// 将命令写到管道里面，init 进程读取到命令后才开始执行
 	containers.SendInitCommand(command, writePipe)
-	if config.Tty {
-		// 等待parent进程执行完毕
-		err := parent.Wait()
-		if err != nil {
-			fmt.Printf("等待父进程执行失败： %v\n", err)
-			return
-		}
-		// 删除工作空间，卷的挂载点
-		containers.DeleteWorkSpace(containerInfo)
-		// 删除记录的容器信息
-		containers.DeleteContainerInfo(containerInfo)
+	containers.LogContainerEvent(info, "start", nil)
+	return shim, nil
+}
+
+// ExitCode 根据进程的退出状态计算容器的退出码，被信号杀死时为 128+信号
+func ExitCode(state *os.ProcessState) int {
+	if state == nil {
+		return -1
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
 	}
-	os.Exit(-1)
+	return state.ExitCode()
 }
+
+// Clean 删除容器的工作空间，卷的挂载点以及记录的容器信息，交互式容器退出后调用
+func Clean(info *containers.ContainerInfo) {
+	// shim 退出时已经清理了 cgroup，使用最新记录的容器信息
+	if latest, err := containers.GetContainerInfo(info.Id); err == nil {
+		info = latest
+	}
+	containers.DeleteWorkSpace(info)
+	containers.DeleteContainerInfo(info)
+}
+
 func processResolv(containerDir string, config containers.RunContainerConfig) {
 	//处理 域名解析
 	resolv := containers.ResolveFile
@@ -95,7 +241,7 @@ func processNetWork(net string, cmd *containers.CommandArray, info *containers.C
 		return
 	}
 	if err := networks.Connect(net, info); err != nil {
-		fmt.Printf("连接网络失败%v\n", err)
+		log.Printf("连接网络失败%v\n", err)
 		return
 	}
 
@@ -141,59 +287,206 @@ func setContainerNetNs(cmd containers.CommandArray) {
 	}
 }
 
-// Ps 列出所有进程
-func Ps() {
-	containers.ListContainerInfo()
+// LogReader 按照容器创建时的日志驱动读取容器的日志
+func LogReader(idOrName string) (logger.Reader, error) {
+	containerId := containers.ResolveContainerId(idOrName, false)
+	if containerId == "" {
+		return nil, fmt.Errorf("无法根据提供的容器标识定位到容器")
+	}
+	info, err := containers.GetContainerInfo(containerId)
+	if err != nil {
+		return nil, err
+	}
+	return logger.NewReader(info.LogConfig, info.BaseUrl)
 }
 
-// Log 显示container的日志，先按照容器id打开
-func Log(idOrName string) {
+// Exec 进入容器, stdio 依次为标准输入，标准输出，标准错误
+func Exec(idOrName string, cmdArray []string, stdio []*os.File) error {
 	containerId := containers.ResolveContainerId(idOrName, false)
 	if containerId == "" {
-		fmt.Printf("无法根据提供的容器标识定位到容器\n")
-		return
+		return fmt.Errorf("无法根据提供的容器标识定位到容器")
+	}
+	return containers.ExecContainer(containerId, cmdArray, stdio)
+}
+
+// Stop 停止容器，先发送容器的停止信号，超过 timeout 后容器还没有退出时发送 SIGKILL
+// 阻塞到容器退出，shim 记录退出信息，清理 cgroup 和挂载点之后返回
+func Stop(idOrName string, timeout time.Duration) error {
+	containerId := containers.ResolveContainerId(idOrName, false)
+	if containerId == "" {
+		return fmt.Errorf("无法根据提供的容器标识定位到容器")
 	}
-	dirURL := fmt.Sprintf(containers.ContainerInfoLocation, containerId)
-	logFileLocation := dirURL + containers.ContainerLogName
-	file, err := os.Open(logFileLocation)
-	defer file.Close()
+	info, err := containers.StopContainer(containerId)
 	if err != nil {
-		return
+		return err
+	}
+	if !info.IsRunning() {
+		return nil
+	}
+	if info.Status == containers.Paused {
+		if err := unpause(info); err != nil {
+			return err
+		}
 	}
-	content, err := io.ReadAll(file)
+	if !WaitExit(containerId, timeout) {
+		log.Printf("容器 %s 在 %v 内没有退出, 发送 SIGKILL\n", containerId, timeout)
+		if pid, _ := strconv.Atoi(info.Pid); pid > 0 {
+			_ = syscall.Kill(pid, syscall.SIGKILL)
+		}
+		if !WaitExit(containerId, DefaultStopTimeout) {
+			return fmt.Errorf("容器 %s 没有退出", containerId)
+		}
+	}
+	// shim 进程不存在时没有人记录退出信息
+	if latest, err := containers.GetContainerInfo(containerId); err == nil && latest.IsRunning() {
+		MarkExited(containerId)
+	}
+	containers.LogContainerEvent(info, "stop", nil)
+	return nil
+}
+
+// Kill 向运行中或者暂停的容器发送信号，all 为 true 时发送给容器 cgroup 中的所有进程，否则只发送给容器的 init 进程
+func Kill(idOrName string, signal string, all bool) error {
+	containerId := containers.ResolveContainerId(idOrName, false)
+	if containerId == "" {
+		return fmt.Errorf("无法根据提供的容器标识定位到容器")
+	}
+	sig, err := containers.ParseSignal(signal)
 	if err != nil {
-		fmt.Printf("读取日志文件: %s 失败  %v", logFileLocation, err)
-		return
+		return err
+	}
+	info, err := containers.GetContainerInfo(containerId)
+	if err != nil {
+		return err
+	}
+	if !info.IsRunning() {
+		return fmt.Errorf("容器 %s 没有运行", containerId)
 	}
-	fmt.Fprint(os.Stdout, string(content))
+	var pids []int
+	if all {
+		pids, err = cgroups.NewCgroupManager(cgroups.RooutCgroupPath + containerId).Pids()
+		if err != nil {
+			return fmt.Errorf("获取容器 %s 的进程失败: %v", containerId, err)
+		}
+	} else if pid, _ := strconv.Atoi(info.Pid); pid > 0 {
+		pids = append(pids, pid)
+	}
+	if len(pids) == 0 {
+		return fmt.Errorf("容器 %s 没有运行中的进程", containerId)
+	}
+	for _, pid := range pids {
+		// 进程可能已经退出，忽略不存在的进程
+		if err := syscall.Kill(pid, sig); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("向进程 %d 发送信号 %s 失败: %v", pid, signal, err)
+		}
+	}
+	containers.LogContainerEvent(info, "kill", map[string]string{"signal": signal})
+	// 暂停的容器中的进程被冻结，恢复之后才能处理信号，和 stop 相同
+	if info.Status == containers.Paused {
+		return unpause(info)
+	}
+	return nil
 }
 
-// Exec 进入容器
-func Exec(idOrName string, cmdArray []string) {
+// Pause 冻结容器中的所有进程，容器的状态变为 paused
+func Pause(idOrName string) error {
 	containerId := containers.ResolveContainerId(idOrName, false)
 	if containerId == "" {
-		fmt.Printf("无法根据提供的容器标识定位到容器\n")
-		return
+		return fmt.Errorf("无法根据提供的容器标识定位到容器")
+	}
+	info, err := containers.GetContainerInfo(containerId)
+	if err != nil {
+		return err
 	}
-	containers.ExecContainer(containerId, cmdArray)
+	if info.Status == containers.Paused {
+		return fmt.Errorf("容器 %s 已经暂停", containerId)
+	}
+	if info.Status != containers.Running {
+		return fmt.Errorf("容器 %s 没有运行", containerId)
+	}
+	cgroupManager := cgroups.NewCgroupManager(cgroups.RooutCgroupPath + containerId)
+	if err := cgroupManager.Freeze(); err != nil {
+		// 部分进程可能已经被冻结
+		_ = cgroupManager.Thaw()
+		return fmt.Errorf("暂停容器 %s 失败: %v", containerId, err)
+	}
+	info, err = containers.UpdateContainerInfo(containerId, func(info *containers.ContainerInfo) {
+		if info.Status == containers.Running {
+			info.Status = containers.Paused
+		}
+	})
+	if err != nil {
+		return err
+	}
+	containers.LogContainerEvent(info, "pause", nil)
+	return nil
 }
 
-// Stop 停止容器
-func Stop(idOrName string) {
+// Unpause 恢复暂停的容器中被冻结的进程
+func Unpause(idOrName string) error {
 	containerId := containers.ResolveContainerId(idOrName, false)
 	if containerId == "" {
-		fmt.Printf("无法根据提供的容器标识定位到容器\n")
-		return
+		return fmt.Errorf("无法根据提供的容器标识定位到容器")
+	}
+	info, err := containers.GetContainerInfo(containerId)
+	if err != nil {
+		return err
 	}
-	containers.StopContainer(containerId)
+	if info.Status != containers.Paused {
+		return fmt.Errorf("容器 %s 没有暂停", containerId)
+	}
+	return unpause(info)
 }
 
-// Remove 删除容器
-func Remove(idOrName string) {
+func unpause(info *containers.ContainerInfo) error {
+	if err := cgroups.NewCgroupManager(cgroups.RooutCgroupPath + info.Id).Thaw(); err != nil {
+		return fmt.Errorf("恢复容器 %s 失败: %v", info.Id, err)
+	}
+	info, err := containers.UpdateContainerInfo(info.Id, func(info *containers.ContainerInfo) {
+		if info.Status == containers.Paused {
+			info.Status = containers.Running
+		}
+	})
+	if err != nil {
+		return err
+	}
+	containers.LogContainerEvent(info, "unpause", nil)
+	return nil
+}
+
+// Remove 删除容器，并释放容器在网络中的ip
+func Remove(idOrName string) error {
 	containerId := containers.ResolveContainerId(idOrName, false)
 	if containerId == "" {
-		fmt.Printf("无法根据提供的容器标识定位到容器\n")
-		return
+		return fmt.Errorf("无法根据提供的容器标识定位到容器")
+	}
+	info, err := containers.GetContainerInfo(containerId)
+	if err != nil {
+		return err
+	}
+	if err := containers.RemoveContainer(containerId); err != nil {
+		return err
+	}
+	if err := networks.Disconnect(info); err != nil {
+		log.Printf("释放容器 %s 的网络失败 %v\n", containerId, err)
+	}
+	return nil
+}
+
+// DefaultStopTimeout 停止容器时等待容器退出的默认时间
+const DefaultStopTimeout = 10 * time.Second
+
+// WaitExit 等待容器的 shim 进程记录容器的退出信息，shim 进程不存在时直接返回，超时返回 false
+func WaitExit(containerId string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		info, err := containers.GetContainerInfo(containerId)
+		if err != nil || !ShimRunning(info) {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
 	}
-	containers.RemoveContainer(containerId)
 }
@@ -0,0 +1,92 @@
+package run
+
+import (
+	"cgroups"
+	"containers"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// 容器信息，事件日志和 cgroup 使用临时的路径，测试结束后恢复
+func useTempContainerStore(t *testing.T) {
+	t.Helper()
+	root := t.TempDir()
+	location, all := containers.ContainerInfoLocation, containers.AllContainerLocation
+	events, rotated := containers.EventsLocation, containers.EventsRotatedLocation
+	cgroupRoot := cgroups.RooutCgroupPath
+	containers.AllContainerLocation = root + "/containers/"
+	containers.ContainerInfoLocation = containers.AllContainerLocation + "%s/"
+	containers.EventsLocation = root + "/events.log"
+	containers.EventsRotatedLocation = root + "/events.log.1"
+	cgroups.RooutCgroupPath = fmt.Sprintf("mydocker-test-%d/", os.Getpid())
+	t.Cleanup(func() {
+		containers.ContainerInfoLocation, containers.AllContainerLocation = location, all
+		containers.EventsLocation, containers.EventsRotatedLocation = events, rotated
+		cgroups.RooutCgroupPath = cgroupRoot
+	})
+}
+
+func TestKill(t *testing.T) {
+	useTempContainerStore(t)
+	root := cgroups.RooutCgroupPath
+	t.Cleanup(func() {
+		_ = (&cgroups.FreezerSubSystem{}).Remove(root)
+	})
+	for _, status := range []string{containers.Running, containers.Paused} {
+		t.Run(status, func(t *testing.T) {
+			id := "kill" + status
+			cgroupPath := cgroups.RooutCgroupPath + id
+			freezer := &cgroups.FreezerSubSystem{}
+			if err := freezer.Set(cgroupPath, nil); err != nil {
+				t.Skipf("没有可用的 freezer: %v", err)
+			}
+			t.Cleanup(func() {
+				_ = freezer.Thaw(cgroupPath)
+				_ = freezer.Remove(cgroupPath)
+			})
+			cmd := exec.Command("sleep", "100")
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			done := make(chan error, 1)
+			go func() {
+				done <- cmd.Wait()
+			}()
+			t.Cleanup(func() {
+				_ = cmd.Process.Kill()
+			})
+			if err := freezer.Apply(cgroupPath, cmd.Process.Pid); err != nil {
+				t.Skipf("没有可用的 freezer: %v", err)
+			}
+			if status == containers.Paused {
+				if err := freezer.Freeze(cgroupPath); err != nil {
+					t.Skipf("冻结进程失败: %v", err)
+				}
+			}
+			if err := os.MkdirAll(fmt.Sprintf(containers.ContainerInfoLocation, id), 0755); err != nil {
+				t.Fatal(err)
+			}
+			containers.RecordContainerInfo(&containers.ContainerInfo{Id: id, Name: id, Status: status}, cmd.Process.Pid)
+
+			if err := Kill(id, "SIGTERM", false); err != nil {
+				t.Fatalf("kill 失败: %v", err)
+			}
+			// 暂停的容器在发送信号之后恢复，进程才能处理信号
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("kill 之后进程没有退出")
+			}
+			info, err := containers.GetContainerInfo(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Status == containers.Paused || freezer.Frozen(cgroupPath) {
+				t.Errorf("kill 之后容器应该恢复, 状态为 %s", info.Status)
+			}
+		})
+	}
+}
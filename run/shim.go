@@ -0,0 +1,122 @@
+package run
+
+import (
+	"containers"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// 启动容器的 shim 进程，等待 shim 返回 init 进程的 pid
+// 返回 init 进程读取命令的管道，写入命令后容器才会真正运行
+func startShim(info *containers.ContainerInfo) (*exec.Cmd, int, *os.File, error) {
+	readPipe, writePipe, err := containers.NewPipe()
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("创建管道失败 %v", err)
+	}
+	syncRead, syncWrite, err := containers.NewPipe()
+	if err != nil {
+		readPipe.Close()
+		writePipe.Close()
+		return nil, 0, nil, fmt.Errorf("创建管道失败 %v", err)
+	}
+	defer syncRead.Close()
+	shim := containers.NewShimProcess(info, readPipe, syncWrite)
+	err = shim.Start()
+	// 管道的另一端已经交给 shim 进程
+	readPipe.Close()
+	syncWrite.Close()
+	if err != nil {
+		writePipe.Close()
+		return nil, 0, nil, fmt.Errorf("启动 shim 进程失败:%v", err)
+	}
+	var result containers.ShimResult
+	if err := json.NewDecoder(syncRead).Decode(&result); err != nil {
+		result.Message = fmt.Sprintf("读取 shim 进程启动结果失败: %v", err)
+	}
+	if result.Message != "" || result.Pid <= 0 {
+		writePipe.Close()
+		_ = shim.Wait()
+		return nil, 0, nil, fmt.Errorf("启动容器进程失败:%s", result.Message)
+	}
+	return shim, result.Pid, writePipe, nil
+}
+
+// Shim 容器的监控进程，由 daemon 启动，daemon 退出后继续运行
+// 持有容器的日志文件以及标准输入输出，启动容器的 init 进程并等待它退出，
+// 退出后记录退出码，退出时间，是否 OOM，并清理容器的 cgroup
+// 运行期间监听容器的 attach socket，attach 的客户端通过它读写容器的标准输入输出
+// 文件描述符 3 用于返回 init 进程的 pid，4 是 init 进程读取命令的管道
+func Shim(containerId string) error {
+	// 写已经关闭的管道时返回错误，而不是退出 shim 进程
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGPIPE, syscall.SIGHUP)
+	syncPipe := os.NewFile(uintptr(3), "sync")
+	readPipe := os.NewFile(uintptr(4), "pipe")
+	defer readPipe.Close()
+	info, err := containers.GetContainerInfo(containerId)
+	if err != nil {
+		writeShimResult(syncPipe, &containers.ShimResult{Message: err.Error()})
+		return err
+	}
+	stdio, err := newContainerIO(info)
+	if err != nil {
+		writeShimResult(syncPipe, &containers.ShimResult{Message: err.Error()})
+		return err
+	}
+	var env []string
+	if info.Config != nil {
+		env = info.Config.Env
+	}
+	parent, err := containers.NewInitProcess(info, readPipe, stdio.files, env)
+	if err == nil {
+		stdio.setTerminal(parent)
+		err = parent.Start()
+	}
+	// init 进程已经持有这些文件
+	readPipe.Close()
+	stdio.closeFiles()
+	if err != nil {
+		stdio.close()
+		writeShimResult(syncPipe, &containers.ShimResult{Message: err.Error()})
+		return err
+	}
+	stdio.start()
+	writeShimResult(syncPipe, &containers.ShimResult{Pid: parent.Process.Pid})
+	if err := parent.Wait(); err != nil {
+		log.Printf("容器 %s 退出: %v\n", containerId, err)
+	}
+	exitCode := ExitCode(parent.ProcessState)
+	recordExit(containerId, exitCode)
+	// 先记录退出信息，attach 的客户端结束时容器的状态已经是退出
+	stdio.finish(exitCode)
+	return nil
+}
+
+// ShimRunning 容器的 shim 进程是否还在运行
+func ShimRunning(info *containers.ContainerInfo) bool {
+	return info.ShimAlive()
+}
+
+// MarkExited shim 进程已经不存在时，将运行中的容器标记为退出，例如 shim 被杀死或者宿主机重启
+// 无法获取容器的退出码，记录为 -1
+func MarkExited(containerId string) {
+	recordExit(containerId, -1)
+}
+
+// 记录容器的退出信息，清理容器的 cgroup 以及 overlay 文件系统和卷的挂载
+func recordExit(containerId string, exitCode int) {
+	if _, err := containers.RecordExit(containerId, exitCode); err != nil {
+		log.Printf("记录容器 %s 的退出信息失败: %v\n", containerId, err)
+	}
+}
+
+func writeShimResult(pipe *os.File, result *containers.ShimResult) {
+	if err := json.NewEncoder(pipe).Encode(result); err != nil {
+		log.Printf("返回 shim 启动结果失败: %v\n", err)
+	}
+	pipe.Close()
+}